@@ -1,6 +1,7 @@
 package apperrs
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
@@ -29,4 +30,17 @@ func NewUnprocessableEntity(message string) error {
 
 func NewBadRequestError(message string) error {
 	return echo.NewHTTPError(http.StatusBadRequest, message)
-}
\ No newline at end of file
+}
+
+func NewConflictError(message string) error {
+	return echo.NewHTTPError(http.StatusConflict, message)
+}
+
+// Message is the message of an error without the status code echo puts in
+// front of it.
+func Message(err error) string {
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return fmt.Sprint(httpErr.Message)
+	}
+	return err.Error()
+}
@@ -1,6 +1,7 @@
 package apperrs
 
 import (
+	"errors"
 	"net/http"
 	"testing"
 
@@ -55,3 +56,20 @@ func TestNewBadRequestError(t *testing.T) {
 	assert.Equal(t, expectedCode, echoErr.Code, "HTTP status code should match")
 	assert.Equal(t, expectedMessage, echoErr.Message, "Message should match")
 }
+
+func TestNewConflictError(t *testing.T) {
+	expectedMessage := "Conflict"
+	expectedCode := http.StatusConflict
+
+	err := NewConflictError(expectedMessage)
+	echoErr, ok := err.(*echo.HTTPError)
+
+	assert.True(t, ok, "error should be an echo.HTTPError")
+	assert.Equal(t, expectedCode, echoErr.Code, "HTTP status code should match")
+	assert.Equal(t, expectedMessage, echoErr.Message, "Message should match")
+}
+
+func TestMessage(t *testing.T) {
+	assert.Equal(t, "Bad request", Message(NewBadRequestError("Bad request")))
+	assert.Equal(t, "plain error", Message(errors.New("plain error")))
+}
@@ -4,10 +4,12 @@ import
 	(
 		"os"
 		"github.com/labstack/echo/v4"
+		"github.com/meteedev/assessment-tax/constant"
 	)
 
 func AuthMiddleware(username, password string, c echo.Context) (bool, error) {
 	if username == os.Getenv("ADMIN_USERNAME") && password == os.Getenv("ADMIN_PASSWORD") {
+		c.Set(constant.CONTEXT_KEY_ADMIN_USERNAME, username)
 		return true, nil
 	}
 	return false, nil
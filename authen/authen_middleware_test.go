@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,6 +31,7 @@ func TestAuthMiddleware(t *testing.T) {
 	// Check the result
 	assert.NoError(t, err)
 	assert.True(t, result)
+	assert.Equal(t, "user", c.Get(constant.CONTEXT_KEY_ADMIN_USERNAME))
 
 	// Test with incorrect username/password
 	req = httptest.NewRequest(http.MethodGet, "/", nil)
@@ -40,4 +42,5 @@ func TestAuthMiddleware(t *testing.T) {
 	result, err = AuthMiddleware("u", "p", c)
 	assert.NoError(t, err)
 	assert.False(t, result)
+	assert.Nil(t, c.Get(constant.CONTEXT_KEY_ADMIN_USERNAME))
 }
@@ -21,20 +21,61 @@ const (
 
 	MSG_BU_INVALID_TOTAL_INCOME_LESS_THAN_OR_EQUAL_ZERO = "totalIncome must greater than 0 "
 	
+	MSG_BU_INVALID_TOTAL_INCOME_NOT_SUM_OF_INCOMES = "totalIncome must equal the sum of incomes"
+	
 	MSG_BU_INVALID_WHT_LESS_THAN_ZERO = "wht must not be less than 0 "
 	MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME = "wht can not greater than Total income"
 	
-	MSG_BU_INVALID_PERSONAL_ALLOW_LESS_THAN_ZERO = "personal allowance must not be less than 0 "
-	MSG_BU_INVALID_PERSONAL_ALLOW_MININUM = "personal deductibles start at "
+	MSG_BU_INVALID_DEDUCT_AMOUNT_LESS_THAN_ZERO = "deduction amount must not be less than 0 "
+	MSG_BU_INVALID_DEDUCT_TYPE = "deductType must be lower case letters, digits and dashes"
+	MSG_BU_INVALID_DEDUCT_MIN_MAX = "minAmount can not greater than maxAmount"
+	MSG_BU_INVALID_DEDUCT_CAP_RULE = "capRule must be one of: "
+	MSG_BU_INVALID_DEDUCT_RATE = "rate must be greater than 0 and not greater than 1 for capRule percent-of-net"
+	MSG_BU_INVALID_DEDUCT_MULTIPLIER = "multiplier must not be less than 0"
+	MSG_BU_INVALID_EFFECTIVE_FROM_IN_PAST = "effectiveFrom must not be in the past"
+
+	MSG_BU_DEDUCT_UPD_FAILED = "update deduction failed" 
+	MSG_BU_DEDUCT_CREATE_FAILED = "create deduction failed"
+	MSG_BU_DEDUCT_LOAD_FAILED = "load deduction config failed"
+	MSG_BU_DEDUCT_CONFIG_NOT_FOUND = "deduction config not found for type "
+	MSG_BU_DEDUCT_CONFIG_EXISTS = "deduction config already exists for type "
+
+	MSG_BU_PREVIEW_INCOMES_EMPTY = "incomes must not be empty"
+
+	MSG_BU_INVALID_NET_INCOME_LESS_THAN_ZERO = "netIncome must not be less than 0 "
+	MSG_BU_INVALID_NET_INCOME_TOO_LARGE = "netIncome must not greater than 1,000,000,000,000"
+	MSG_BU_COMPARE_SCENARIOS_EMPTY = "scenarios must not be empty"
+	MSG_BU_COMPARE_SCENARIO_NAME_EMPTY = "scenario name must not be empty"
+	MSG_BU_COMPARE_SCENARIO_NAME_DUPLICATE = "scenario name is duplicated: "
+	MSG_BU_GROSS_UP_NOT_SOLVABLE = "netIncome can not be reached with the tax brackets of the tax year"
 
-	MSG_BU_INVALID_K_RECEIPT_ALLOW_LESS_THAN_ZERO = "k-receipt allowance must not be less than 0 "
-	MSG_BU_INVALID_K_RECEIPT_ALLOW_MININUM = "k-receipt deductibles start at "
+	MSG_BU_INVALID_FILING_STATUS = "filingStatus must be one of: single, joint, separate"
+	MSG_BU_SPOUSE_REQUIRED = "spouse is required for filingStatus joint and separate"
+	MSG_BU_SPOUSE_NOT_ALLOWED = "spouse is only allowed for filingStatus joint and separate"
+	MSG_BU_INVALID_SPOUSE_TOTAL_INCOME_LESS_THAN_ZERO = "spouse totalIncome must not be less than 0"
+	MSG_BU_DEDUCT_SPOUSE_CONFIG_NOT_FOUND = "spouse allowance is not configured for tax year "
+
+	MSG_BU_DEPENDENT_RULE_LOAD_FAILED = "load dependent rules failed"
+	MSG_BU_EXPENSE_RULE_LOAD_FAILED = "load expense rules failed"
 
-	MSG_BU_DEDUCT_UPD_PERSONAL_FAILED = "update personal allowance failed" 
 	MSG_BU_DEDUCT_PERSONAL_CONFIG_NOT_FOUND = "personal allowance config not found in database"
 
-	MSG_BU_DEDUCT_UPD_K_RECEIPT_FAILED = "update k-receipt allowance failed" 
-	MSG_BU_DEDUCT_K_RECEIPT_CONFIG_NOT_FOUND = "k-receipt allowance config not found in database"
+	MSG_BU_TAX_BRACKET_CONFIG_NOT_FOUND = "tax bracket config not found in database"
+	MSG_BU_TAX_RULE_NOT_FOUND_FOR_YEAR = "tax rules not found for tax year "
+	MSG_BU_INVALID_TAX_YEAR = "taxYear must greater than 0 "
+
+	MSG_BU_TAX_FILING_SAVE_FAILED = "save tax filing failed"
+	MSG_BU_TAX_FILING_NOT_FOUND = "tax filing not found"
+	MSG_BU_INVALID_FILING_DATE_RANGE = "from must be before to"
+	MSG_BU_INVALID_FILING_INCOME_RANGE = "minIncome can not greater than maxIncome"
+	MSG_BU_INVALID_FILING_CURSOR = "cursor must not be less than 0"
+
+	MSG_BU_TAX_BATCH_CREATE_FAILED = "create tax batch failed"
+	MSG_BU_TAX_BATCH_LOAD_FAILED = "load tax batch failed"
+	MSG_BU_TAX_BATCH_SAVE_FAILED = "save tax batch rows failed"
+	MSG_BU_TAX_BATCH_NOT_FOUND = "tax batch not found"
+	MSG_BU_TAX_BATCH_NOT_FINISHED = "tax batch is not finished yet"
+	MSG_BU_TAX_BATCH_FAILED = "tax batch failed: "
 
 )
 
@@ -42,9 +83,19 @@ const(
 	MSG_HANDLER_ERR_LOADING_SCHEMA = "error loading schema"
 	MSG_HANDLER_ERR_VALIDATE_SCHEMA = "error validating schema"
 	MSG_HANDLER_ERR_INVALID_PAYLOAD = "invalid payload"
+	MSG_HANDLER_ERR_INVALID_DATE = " must be a date (2006-01-02) or RFC3339 timestamp"
+	MSG_HANDLER_ERR_INVALID_NUMBER = " must be a number"
+	MSG_HANDLER_ERR_INVALID_FILING_ID = "filing id must be a positive number"
+	MSG_HANDLER_ERR_INVALID_UPLOAD_MODE = "mode must be one of: strict, partial"
+	MSG_HANDLER_ERR_INVALID_UPLOAD_FORMAT = "format must be one of: json, ndjson, csv, xlsx"
+	MSG_HANDLER_ERR_INVALID_BATCH_TOKEN = "batch token must be a uuid"
+	MSG_HANDLER_ERR_INVALID_BATCH_FORMAT = "format must be one of: json, csv, xlsx"
 )
 
 
 const(
 	MSG_UPLOAD_CSV_WRONG_FORMAT  = "csv wrong format"
+	MSG_UPLOAD_MISSING_COLUMN = "upload header must have totalIncome and wht columns"
+	MSG_UPLOAD_DUPLICATE_COLUMN = "upload header has duplicate column "
+	MSG_UPLOAD_XLSX_INVALID = "xlsx file can not be read"
 )
\ No newline at end of file
@@ -1,23 +1,91 @@
 package constant
 
 const (
-	MAX_ALLOWANCE_DONATION_DEDUCT = 100000.0
-	
-	MIN_ALLOWANCE_PERSONAL = 10000.0
-	MAX_ALLOWANCE_PERSONAL = 100000.0
+	DEDUCT_PERSONAL_ID = "personal"
+	DEDUCT_K_RECEIPT_ID = "k-receipt" 
+	DEDUCT_DONATION_ID = "donation"
+	DEDUCT_SPOUSE_ID = "spouse"
+)
 
-	MIN_ALLOWANCE_K_RECEIPT = 1.0
-	MAX_ALLOWANCE_K_RECEIPT = 100000.0
+// echo context keys
+const (
+	CONTEXT_KEY_ADMIN_USERNAME = "admin_username"
+)
 
+// cap rules of tax_deduct_config
+const (
+	DEDUCT_CAP_RULE_FIXED = "fixed"
+	DEDUCT_CAP_RULE_MAX = "max"
+	DEDUCT_CAP_RULE_PERCENT_OF_NET = "percent-of-net"
 )
 
+
 const (
-	DEDUCT_PERSONAL_ID = "personal"
-	DEDUCT_K_RECEIPT_ID = "k-receipt" 
-	DEDUCT_DONATION_ID = "donation"
+	CSV_COLUMN_TOTAL_INCOME = "totalIncome"
+	CSV_COLUMN_WHT = "wht"
+
+	TAX_UPLOAD_MODE_STRICT = "strict"
+	TAX_UPLOAD_MODE_PARTIAL = "partial"
+
+	TAX_UPLOAD_FORMAT_JSON = "json"
+	TAX_UPLOAD_FORMAT_NDJSON = "ndjson"
+	TAX_UPLOAD_FORMAT_CSV = "csv"
+	TAX_UPLOAD_FORMAT_XLSX = "xlsx"
+
+	MIME_CSV = "text/csv"
+	MIME_NDJSON = "application/x-ndjson"
+	MIME_XLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
 )
 
 
 const (
-	CSV_UPLOAD_COLUMN = 3
+	TAX_FILING_OUTCOME_PAYABLE = "payable"
+	TAX_FILING_OUTCOME_REFUND = "refund"
+
+	TAX_FILING_PAGE_SIZE_DEFAULT = 20
+	TAX_FILING_PAGE_SIZE_MAX = 100
+)
+
+
+// filing status of a tax request, joint and separate need a spouse
+const (
+	FILING_STATUS_SINGLE = "single"
+	FILING_STATUS_JOINT = "joint"
+	FILING_STATUS_SEPARATE = "separate"
+)
+
+
+// income categories of section 40 the service treats specially
+const (
+	INCOME_CATEGORY_SALARY = "40(1)"
+)
+
+
+// methods the tax is worked out with. The gross-income method taxes the income
+// other than salary at GROSS_INCOME_TAX_RATE once it is above
+// GROSS_INCOME_TAX_MIN_INCOME, it is waived when the result is not above
+// GROSS_INCOME_TAX_EXEMPT. The higher tax of both methods is due.
+const (
+	TAX_METHOD_PROGRESSIVE = "progressive"
+	TAX_METHOD_GROSS_INCOME = "gross-income"
+
+	GROSS_INCOME_TAX_RATE = 0.005
+	GROSS_INCOME_TAX_MIN_INCOME = 12_000_000 // 120,000 baht in satang
+	GROSS_INCOME_TAX_EXEMPT = 500_000 // 5,000 baht in satang
+)
+
+
+// most scenarios a comparison calculates
+const TAX_COMPARE_SCENARIOS_MAX = 20
+
+// highest income in satang the gross-up searches, 1,000,000,000,000 baht
+const GROSS_UP_MAX_INCOME = 100_000_000_000_000
+
+
+// status of tax_batch jobs
+const (
+	TAX_BATCH_STATUS_QUEUED = "queued"
+	TAX_BATCH_STATUS_RUNNING = "running"
+	TAX_BATCH_STATUS_COMPLETED = "completed"
+	TAX_BATCH_STATUS_FAILED = "failed"
 )
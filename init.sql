@@ -1,10 +1,150 @@
 CREATE TABLE tax_deduct_config (
-    deduct_id CHARACTER(10) PRIMARY KEY,
+    deduct_id CHARACTER VARYING(50),
+    tax_year INTEGER NOT NULL,
     amount DECIMAL(15, 2), -- Assuming maximum precision of 15 digits with 2 decimal places
-    description CHARACTER(100)
+    min_amount DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    max_amount DECIMAL(15, 2) NOT NULL,
+    cap_rule CHARACTER VARYING(20) NOT NULL DEFAULT 'max', -- 'fixed' is always deducted at amount, claimed or not, 'max' is claimable up to amount, 'percent-of-net' up to rate of the net income
+    rate DECIMAL(5, 4) NOT NULL DEFAULT 0, -- share of the net income 'percent-of-net' caps at
+    multiplier DECIMAL(5, 2) NOT NULL DEFAULT 1, -- claimed amounts count this many times
+    description CHARACTER VARYING(100),
+    PRIMARY KEY (deduct_id, tax_year)
 ); 
 
 -- Inserting sample data into tax_deduct_config table
-INSERT INTO tax_deduct_config (deduct_id, amount, description) VALUES
-    ('personal', 60000.00, 'Personal allowance'),
-    ('k-receipt', 50000.00, 'k-receipt allowance');
+-- percent-of-net donations have no flat limit, their amount is 0
+INSERT INTO tax_deduct_config (deduct_id, tax_year, amount, min_amount, max_amount, cap_rule, rate, multiplier, description) VALUES
+    ('personal', 2024, 60000.00, 10000.00, 100000.00, 'fixed', 0, 1, 'Personal allowance'),
+    ('spouse', 2024, 60000.00, 0.00, 100000.00, 'fixed', 0, 1, 'Spouse allowance'),
+    ('k-receipt', 2024, 50000.00, 1.00, 100000.00, 'max', 0, 1, 'k-receipt allowance'),
+    ('donation', 2024, 0.00, 0.00, 100000.00, 'percent-of-net', 0.1000, 1, 'Donation allowance'),
+    ('donation-education', 2024, 0.00, 0.00, 100000.00, 'percent-of-net', 0.1000, 2, 'Education and hospital donation allowance');
+
+
+-- Append-only log of deduction amount changes
+CREATE TABLE tax_deduct_config_history (
+    history_id BIGSERIAL PRIMARY KEY,
+    deduct_id CHARACTER VARYING(50) NOT NULL,
+    tax_year INTEGER NOT NULL,
+    old_amount DECIMAL(15, 2), -- NULL when the deduction was created
+    new_amount DECIMAL(15, 2) NOT NULL,
+    changed_by CHARACTER VARYING(100) NOT NULL,
+    effective_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (deduct_id, tax_year) REFERENCES tax_deduct_config (deduct_id, tax_year)
+);
+
+CREATE INDEX tax_deduct_config_history_deduct_idx ON tax_deduct_config_history (deduct_id, tax_year, effective_from);
+
+INSERT INTO tax_deduct_config_history (deduct_id, tax_year, old_amount, new_amount, changed_by, effective_from) VALUES
+    ('personal', 2024, NULL, 60000.00, 'init', '2024-01-01T00:00:00+07:00'),
+    ('spouse', 2024, NULL, 60000.00, 'init', '2024-01-01T00:00:00+07:00'),
+    ('k-receipt', 2024, NULL, 50000.00, 'init', '2024-01-01T00:00:00+07:00'),
+    ('donation', 2024, NULL, 0.00, 'init', '2024-01-01T00:00:00+07:00'),
+    ('donation-education', 2024, NULL, 0.00, 'init', '2024-01-01T00:00:00+07:00');
+
+
+
+-- Allowance per dependent, a dependent gets the highest amount of the rules
+-- of its type it meets
+CREATE TABLE tax_dependent_rule (
+    rule_id SERIAL PRIMARY KEY,
+    dependent_type CHARACTER VARYING(50) NOT NULL,
+    tax_year INTEGER NOT NULL,
+    amount DECIMAL(15, 2) NOT NULL,
+    min_rank INTEGER NOT NULL DEFAULT 1, -- rank of the dependent among its type, oldest first
+    born_from_year INTEGER, -- NULL means any birth year
+    max_count INTEGER, -- NULL means no limit on the number of dependents
+    description CHARACTER VARYING(100)
+);
+
+CREATE INDEX tax_dependent_rule_tax_year_idx ON tax_dependent_rule (tax_year, dependent_type);
+
+INSERT INTO tax_dependent_rule (dependent_type, tax_year, amount, min_rank, born_from_year, max_count, description) VALUES
+    ('child', 2024, 30000.00, 1, NULL, NULL, 'Child allowance'),
+    ('child', 2024, 60000.00, 2, 2018, NULL, 'Child allowance from the second child born from 2018'),
+    ('parent', 2024, 30000.00, 1, NULL, 4, 'Parental care allowance'),
+    ('disabled', 2024, 60000.00, 1, NULL, NULL, 'Disabled dependent allowance');
+
+
+-- Expense deducted from the income of a category before the allowances
+CREATE TABLE tax_expense_rule (
+    category CHARACTER VARYING(20),
+    tax_year INTEGER NOT NULL,
+    rate DECIMAL(5, 4) NOT NULL,
+    max_amount DECIMAL(15, 2), -- NULL means no limit
+    cap_group CHARACTER VARYING(20), -- categories of a group share the limit
+    description CHARACTER VARYING(100),
+    PRIMARY KEY (category, tax_year)
+);
+
+INSERT INTO tax_expense_rule (category, tax_year, rate, max_amount, cap_group, description) VALUES
+    ('40(1)', 2024, 0.5000, 100000.00, '40(1)-40(2)', 'Salary and wages'),
+    ('40(2)', 2024, 0.5000, 100000.00, '40(1)-40(2)', 'Fees and commissions'),
+    ('40(5)', 2024, 0.3000, NULL, NULL, 'Rental of property'),
+    ('40(8)', 2024, 0.6000, NULL, NULL, 'Business and commerce');
+
+CREATE TABLE tax_bracket (
+    bracket_id SERIAL PRIMARY KEY,
+    tax_year INTEGER NOT NULL,
+    level CHARACTER VARYING(100) NOT NULL,
+    lower_bound DECIMAL(15, 2) NOT NULL,
+    upper_bound DECIMAL(15, 2), -- NULL means the bracket has no upper limit
+    tax_rate DECIMAL(5, 4) NOT NULL
+);
+
+-- Inserting progressive tax brackets into tax_bracket table
+INSERT INTO tax_bracket (tax_year, level, lower_bound, upper_bound, tax_rate) VALUES
+    (2024, '0-150,000', 0.00, 150000.00, 0.0000),
+    (2024, '150,001-500,000', 150000.00, 500000.00, 0.1000),
+    (2024, '500,001-1,000,000', 500000.00, 1000000.00, 0.1500),
+    (2024, '1,000,001-2,000,000', 1000000.00, 2000000.00, 0.2000),
+    (2024, '2,000,001 ขึ้นไป', 2000000.00, NULL, 0.3500);
+
+
+CREATE TABLE tax_filing (
+    filing_id BIGSERIAL PRIMARY KEY,
+    tax_year INTEGER NOT NULL,
+    total_income DECIMAL(15, 2) NOT NULL,
+    tax DECIMAL(15, 2) NOT NULL,
+    tax_refund DECIMAL(15, 2) NOT NULL,
+    request JSONB NOT NULL,
+    response JSONB NOT NULL,
+    tax_steps JSONB NOT NULL,
+    deduct_config JSONB NOT NULL, -- brackets and deduction values active at calculation time
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX tax_filing_created_at_idx ON tax_filing (created_at);
+
+
+-- Uploads calculated in the background, the file is kept so a job
+-- interrupted by a shutdown is calculated again on the next start
+CREATE TABLE tax_batch (
+    batch_id BIGSERIAL PRIMARY KEY,
+    token UUID NOT NULL UNIQUE, -- random id the job is polled by, batch_id can be guessed
+    status CHARACTER VARYING(20) NOT NULL, -- queued, running, completed or failed
+    tax_year INTEGER NOT NULL,
+    partial BOOLEAN NOT NULL DEFAULT FALSE,
+    content_type CHARACTER VARYING(100) NOT NULL DEFAULT '',
+    file BYTEA NOT NULL,
+    total_rows INTEGER NOT NULL,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    failed_rows INTEGER NOT NULL DEFAULT 0,
+    result JSONB, -- summary set once the job is completed, the rows are in tax_batch_row
+    error TEXT, -- set when the job failed
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    claimed_by CHARACTER VARYING(200), -- server running the job
+    lease_expires_at TIMESTAMP WITH TIME ZONE -- renewed while running, the job is requeued once passed
+);
+
+CREATE INDEX tax_batch_status_idx ON tax_batch (status, batch_id);
+
+CREATE TABLE tax_batch_row (
+    batch_id BIGINT NOT NULL REFERENCES tax_batch (batch_id) ON DELETE CASCADE,
+    row_no INTEGER NOT NULL, -- position of the row in the file, from 1
+    result JSONB NOT NULL, -- the row with its tax or its errors
+    PRIMARY KEY (batch_id, row_no)
+);
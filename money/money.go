@@ -0,0 +1,185 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of Thai baht held as a whole number of satang
+// (1 baht = 100 satang) so that sums never pick up binary rounding drift.
+type Money int64
+
+const satangPerBaht = 100
+
+// rateScale is the precision a rate is applied with, matching DECIMAL(5, 4)
+const rateScale = 10000
+
+var ErrInvalidAmount = errors.New("invalid money amount")
+
+// FromBaht returns a whole baht amount.
+func FromBaht(baht int64) Money {
+	return Money(baht * satangPerBaht)
+}
+
+// FromFloat converts a float amount of baht, rounding to the nearest satang.
+func FromFloat(baht float64) Money {
+	return Money(math.Round(baht * satangPerBaht))
+}
+
+// Parse reads a decimal amount of baht such as "200000.35" without going
+// through float64. Digits beyond satang are rounded half away from zero.
+func Parse(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	r.Mul(r, big.NewRat(satangPerBaht, 1))
+
+	satang, ok := roundRat(r)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return Money(satang), nil
+}
+
+// roundRat rounds r half away from zero and reports whether it fits in int64
+func roundRat(r *big.Rat) (int64, bool) {
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+
+	// |2 * remainder| >= denominator means the fraction is at least one half
+	rem.Abs(rem).Lsh(rem, 1)
+	if rem.Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+
+	if !q.IsInt64() {
+		return 0, false
+	}
+	return q.Int64(), true
+}
+
+// Satang returns the amount in satang.
+func (m Money) Satang() int64 {
+	return int64(m)
+}
+
+// Float64 returns the amount in baht, for ratios and display only.
+func (m Money) Float64() float64 {
+	return float64(m) / satangPerBaht
+}
+
+// MulRate multiplies by a rate such as 0.15, rounding half away from zero
+// to the satang. The rate is applied with four decimal places, a product
+// beyond the range of Money saturates at its limit.
+func (m Money) MulRate(rate float64) Money {
+	scaledRate := big.NewInt(int64(math.Round(rate * rateScale)))
+	product := new(big.Int).Mul(big.NewInt(int64(m)), scaledRate)
+
+	quotient, ok := roundRat(new(big.Rat).SetFrac(product, big.NewInt(rateScale)))
+	if !ok {
+		if product.Sign() < 0 {
+			return Money(math.MinInt64)
+		}
+		return Money(math.MaxInt64)
+	}
+	return Money(quotient)
+}
+
+// Min returns the smaller of m and other.
+func (m Money) Min(other Money) Money {
+	if other < m {
+		return other
+	}
+	return m
+}
+
+// Max returns the larger of m and other.
+func (m Money) Max(other Money) Money {
+	if other > m {
+		return other
+	}
+	return m
+}
+
+// Abs returns the absolute amount.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// String formats the amount with two decimal places, e.g. "200000.35".
+func (m Money) String() string {
+	sign := ""
+	satang := int64(m)
+	if satang < 0 {
+		sign = "-"
+		satang = -satang
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, satang/satangPerBaht, satang%satangPerBaht)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+
+	// amounts are JSON numbers, a quoted amount is accepted as well
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a DECIMAL column, which the postgres driver returns as text.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		*m = FromBaht(v)
+		return nil
+	case float64:
+		*m = FromFloat(v)
+		return nil
+	}
+	return fmt.Errorf("%w: cannot scan %T", ErrInvalidAmount, src)
+}
+
+// Value writes the amount as a decimal string so DECIMAL columns stay exact.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,123 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Money
+		err      bool
+	}{
+		{"Whole baht", "500000", 50000000, false},
+		{"Satang", "200000.35", 20000035, false},
+		{"Trailing zero", "0.1", 10, false},
+		{"Negative", "-1", -100, false},
+		{"Exponent", "5e5", 50000000, false},
+		{"Round half up", "0.005", 1, false},
+		{"Round down", "0.004", 0, false},
+		{"Round half away from zero", "-0.005", -1, false},
+		{"Surrounding spaces", " 100 ", 10000, false},
+		{"Not a number", "abc", 0, true},
+		{"Empty", "", 0, true},
+		{"Overflow", "1e30", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Parse(test.input)
+			if test.err {
+				assert.ErrorIs(t, err, ErrInvalidAmount)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, m)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "200000.35", Money(20000035).String())
+	assert.Equal(t, "0.05", Money(5).String())
+	assert.Equal(t, "-1.50", Money(-150).String())
+	assert.Equal(t, "0.00", Money(0).String())
+}
+
+func TestMulRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Money
+		rate     float64
+		expected Money
+	}{
+		{"Ten percent", FromBaht(290000), 0.1, FromBaht(29000)},
+		{"Fifteen percent", FromBaht(100000), 0.15, FromBaht(15000)},
+		{"Round half up", Money(5), 0.1, Money(1)},
+		{"Round down", Money(4), 0.1, Money(0)},
+		{"Half percent", FromBaht(1000000), 0.005, FromBaht(5000)},
+		{"Negative", Money(-5), 0.1, Money(-1)},
+		{"Zero rate", FromBaht(150000), 0, 0},
+		{"Large amount", Money(math.MaxInt64 / 2), 0.1, Money(461168601842738790)},
+		{"Large negative amount", Money(math.MinInt64 / 2), 0.1, Money(-461168601842738790)},
+		{"Saturates", Money(math.MaxInt64), 2, Money(math.MaxInt64)},
+		{"Saturates negative", Money(math.MinInt64), 2, Money(math.MinInt64)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.amount.MulRate(test.rate))
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var payload struct {
+		Amount Money `json:"amount"`
+	}
+
+	err := json.Unmarshal([]byte(`{"amount": 200000.35}`), &payload)
+	assert.NoError(t, err)
+	assert.Equal(t, Money(20000035), payload.Amount)
+
+	err = json.Unmarshal([]byte(`{"amount": "60000"}`), &payload)
+	assert.NoError(t, err)
+	assert.Equal(t, FromBaht(60000), payload.Amount)
+
+	err = json.Unmarshal([]byte(`{"amount": true}`), &payload)
+	assert.Error(t, err)
+
+	out, err := json.Marshal(payload)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": 60000}`, string(out))
+}
+
+func TestScanAndValue(t *testing.T) {
+	var m Money
+
+	assert.NoError(t, m.Scan([]byte("60000.00")))
+	assert.Equal(t, FromBaht(60000), m)
+
+	assert.NoError(t, m.Scan("0.35"))
+	assert.Equal(t, Money(35), m)
+
+	assert.NoError(t, m.Scan(100.5))
+	assert.Equal(t, Money(10050), m)
+
+	assert.NoError(t, m.Scan(int64(7)))
+	assert.Equal(t, FromBaht(7), m)
+
+	assert.NoError(t, m.Scan(nil))
+	assert.Equal(t, Money(0), m)
+
+	assert.Error(t, m.Scan(true))
+
+	value, err := Money(20000035).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "200000.35", value)
+}
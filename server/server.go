@@ -35,12 +35,15 @@ func New(){
 
 	// inject db to repository
 	taxDeductConfigRepo := repository.NewTaxDeductConfigRepo(db)
+	taxBracketRepo := repository.NewTaxBracketRepo(db)
+	taxFilingRepo := repository.NewTaxFilingRepo(db)
+	taxBatchRepo := repository.NewTaxBatchRepo(db)
 
 	// inject csv reader 
 	csvParser := &service.CSVParserImpl{}
 
 	// Inject the logger into TaxService
-	taxService := service.NewTaxService(&logger,taxDeductConfigRepo,csvParser)
+	taxService := service.NewTaxService(&logger,taxDeductConfigRepo,taxBracketRepo,taxFilingRepo,taxBatchRepo,csvParser)
 
 	//add service to handler
 	handler := handler.NewTaxHandler(taxService)
@@ -53,11 +56,22 @@ func New(){
 	//register rest api route
 	registerRoutes(e,handler)
 	
+	// calculate queued batches in the background
+	batchCtx, stopBatches := context.WithCancel(context.Background())
+	batchDone := make(chan struct{})
+	go func() {
+		defer close(batchDone)
+		taxService.RunTaxBatches(batchCtx)
+	}()
+
 	// start servert
 	go startServer(e)
 	
 	//config graceful shutdown
-	gracefulShutdownServer(e)
+	gracefulShutdownServer(e, func() {
+		stopBatches()
+		<-batchDone
+	})
 }
 
 
@@ -68,7 +82,9 @@ func startServer(e *echo.Echo) {
 	}
 }
 
-func gracefulShutdownServer(e *echo.Echo) {
+// gracefulShutdownServer stops the background work once the server is
+// down, a batch still running is put back in the queue.
+func gracefulShutdownServer(e *echo.Echo, stopBackground func()) {
 	// Listen for OS signals for graceful shutdown
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -82,24 +98,43 @@ func gracefulShutdownServer(e *echo.Echo) {
 		e.Logger.Fatal(err)
 	}
 
+	stopBackground()
+
 	//<-ctx.Done()
 	fmt.Println(constant.MSG_SERVER_GRACEFUL_SHUTDOWN)
 }
 
 // registerRoutes registers all the routes for the application.
 func registerRoutes(e *echo.Echo,handler *handler.TaxHandler) {
+
+	adminAuth := middleware.BasicAuth(authen.AuthMiddleware)
 	
 	// Tax routes
 	taxGroup := e.Group("/tax")
 	taxGroup.POST("/calculations", handler.TaxCalculation)
+	taxGroup.POST("/calculations/gross-up", handler.TaxGrossUp)
+	taxGroup.POST("/calculations/compare", handler.TaxCompare)
 	taxGroup.POST("/calculations/upload-csv", handler.TaxUploadCalculation)
+	// the filings of every taxpayer are for support staff only
+	taxGroup.GET("/filings", handler.TaxFilings, adminAuth)
+	taxGroup.GET("/filings/:id", handler.TaxFiling, adminAuth)
+	taxGroup.GET("/allowances", handler.AllowanceTypes)
+	taxGroup.POST("/batches", handler.CreateTaxBatch)
+	taxGroup.GET("/batches/:token", handler.TaxBatch)
+	taxGroup.GET("/batches/:token/result", handler.TaxBatchResult)
 	
 
 	// Admin routes
 	adminGroup := e.Group("/admin")
-	adminGroup.Use(middleware.BasicAuth(authen.AuthMiddleware))
+	adminGroup.Use(adminAuth)
 	adminGroup.POST("/deductions/personal", handler.DeductionsPersonal)
 	adminGroup.POST("/deductions/k-receipt", handler.DeductionsKreceipt)
+	adminGroup.GET("/deductions", handler.Deductions)
+	adminGroup.POST("/deductions", handler.CreateDeduction)
+	adminGroup.GET("/deductions/:type", handler.Deduction)
+	adminGroup.PUT("/deductions/:type", handler.UpdateDeduction)
+	adminGroup.GET("/deductions/:type/history", handler.DeductionHistory)
+	adminGroup.POST("/deductions/:type/preview", handler.PreviewDeduction)
 
 }
 
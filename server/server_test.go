@@ -66,3 +66,18 @@ func TestAdminRoutes(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
+
+func TestFilingRoutes(t *testing.T) {
+	e := echo.New()
+	handler := &handler.TaxHandler{}
+	registerRoutes(e, handler)
+
+	// the stored filings are not readable without admin credentials
+	for _, target := range []string{"/tax/filings", "/tax/filings/1"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, target)
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+)
+
+// CreateTaxBatch takes the same form as TaxUploadCalculation and answers as
+// soon as the file is queued, the status is then polled at the Location.
+func (h *TaxHandler) CreateTaxBatch(c echo.Context) error {
+
+	file, err := c.FormFile("taxFile")
+	if err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to open file")
+	}
+	defer src.Close()
+
+	uploadOptions, err := parseUploadOptions(c, file)
+	if err != nil {
+		return err
+	}
+
+	batchResponse, err := h.service.CreateTaxBatch(src, uploadOptions)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/tax/batches/%s", batchResponse.Token))
+	return c.JSON(http.StatusAccepted, batchResponse)
+}
+
+func (h *TaxHandler) TaxBatch(c echo.Context) error {
+
+	token, err := parseTaxBatchToken(c)
+	if err != nil {
+		return err
+	}
+
+	batchResponse, err := h.service.GetTaxBatch(token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, batchResponse)
+}
+
+// TaxBatchResult sends the result of a completed job in the formats of
+// TaxUploadCalculation, except ndjson.
+func (h *TaxHandler) TaxBatchResult(c echo.Context) error {
+
+	token, err := parseTaxBatchToken(c)
+	if err != nil {
+		return err
+	}
+
+	format, err := parseUploadFormat(c)
+	if err != nil || format == constant.TAX_UPLOAD_FORMAT_NDJSON {
+		return apperrs.NewBadRequestError(constant.MSG_HANDLER_ERR_INVALID_BATCH_FORMAT)
+	}
+
+	uploadTaxResponse, err := h.service.GetTaxBatchResult(token)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case constant.TAX_UPLOAD_FORMAT_CSV:
+		return writeTaxUploadSheet(c, constant.MIME_CSV, "csv", uploadTaxResponse.Sheet.WriteCSV)
+	case constant.TAX_UPLOAD_FORMAT_XLSX:
+		return writeTaxUploadSheet(c, constant.MIME_XLSX, "xlsx", uploadTaxResponse.Sheet.WriteXLSX)
+	}
+
+	return c.JSON(http.StatusOK, uploadTaxResponse)
+}
+
+// taxBatchTokenPattern matches the UUID a job is created with.
+var taxBatchTokenPattern = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func parseTaxBatchToken(c echo.Context) (string, error) {
+	token := c.Param("token")
+	if !taxBatchTokenPattern.MatchString(token) {
+		return "", apperrs.NewBadRequestError(constant.MSG_HANDLER_ERR_INVALID_BATCH_TOKEN)
+	}
+	return token, nil
+}
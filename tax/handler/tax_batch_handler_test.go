@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testTaxBatchToken = "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b"
+
+func newTaxBatchContext(target string, token string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("token")
+	c.SetParamValues(token)
+	return c, rec
+}
+
+func TestCreateTaxBatchHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	batchResponse := &service.TaxBatchResponse{Token: testTaxBatchToken, Status: constant.TAX_BATCH_STATUS_QUEUED, TaxYear: 2024, Mode: constant.TAX_UPLOAD_MODE_STRICT, TotalRows: 1, CreatedAt: createdAt}
+	mockService.On("CreateTaxBatch", mock.Anything, &service.TaxUploadOptions{ContentType: "application/octet-stream"}).Return(batchResponse, nil)
+
+	c, rec := newTaxUploadContext(t, "/tax/batches", "")
+	err := handler.CreateTaxBatch(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/tax/batches/"+testTaxBatchToken, rec.Header().Get(echo.HeaderLocation))
+	assert.JSONEq(t, `{"token":"3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b","status":"queued","taxYear":2024,"mode":"strict","totalRows":1,"processedRows":0,"failedRows":0,"progress":0,"createdAt":"2024-03-01T10:00:00Z"}`, rec.Body.String())
+	mockService.AssertNotCalled(t, "UploadCalculationTax", mock.Anything, mock.Anything)
+}
+
+func TestCreateTaxBatchHandler_Error(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	mockService.On("CreateTaxBatch", mock.Anything, mock.Anything).Return((*service.TaxBatchResponse)(nil), apperrs.NewBadRequestError(constant.MSG_UPLOAD_MISSING_COLUMN))
+
+	c, _ := newTaxUploadContext(t, "/tax/batches", "")
+	err := handler.CreateTaxBatch(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+}
+
+func TestTaxBatchHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	batchResponse := &service.TaxBatchResponse{Token: testTaxBatchToken, Status: constant.TAX_BATCH_STATUS_RUNNING, TotalRows: 400, ProcessedRows: 100, Progress: 25}
+	mockService.On("GetTaxBatch", testTaxBatchToken).Return(batchResponse, nil)
+
+	c, rec := newTaxBatchContext("/tax/batches/"+testTaxBatchToken, testTaxBatchToken)
+	err := handler.TaxBatch(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response service.TaxBatchResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, *batchResponse, response)
+}
+
+func TestTaxBatchHandler_InvalidToken(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	for _, token := range []string{"7", "abc", "3f2b8c1e9a4d4e6f8b7a1c2d3e4f5a6b", testTaxBatchToken + "0"} {
+		c, _ := newTaxBatchContext("/tax/batches/"+token, token)
+		err := handler.TaxBatch(c)
+
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Equal(t, constant.MSG_HANDLER_ERR_INVALID_BATCH_TOKEN, err.(*echo.HTTPError).Message)
+	}
+	mockService.AssertNotCalled(t, "GetTaxBatch", mock.Anything)
+}
+
+func TestTaxBatchResultHandler(t *testing.T) {
+	uploadResponse := &service.TaxUploadResponse{
+		Taxes: []service.TaxUpload{{TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000)}},
+		Sheet: &service.TaxUploadSheet{
+			Header: []string{"totalIncome", "wht"},
+			Levels: []string{"0-150,000"},
+			Rows:   []service.TaxUploadSheetRow{{Record: []string{"500000", "0"}, TaxResponse: &service.TaxResponse{Tax: money.FromBaht(29000), TaxStep: []service.TaxStep{{Level: "0-150,000"}}}}},
+		},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		mockService := new(MockService)
+		handler := NewTaxHandler(mockService)
+		mockService.On("GetTaxBatchResult", testTaxBatchToken).Return(uploadResponse, nil)
+
+		c, rec := newTaxBatchContext("/tax/batches/"+testTaxBatchToken+"/result", testTaxBatchToken)
+		err := handler.TaxBatchResult(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"taxes":[{"totalIncome":500000.00,"tax":29000.00,"taxRefund":0.00}]}`, rec.Body.String())
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		mockService := new(MockService)
+		handler := NewTaxHandler(mockService)
+		mockService.On("GetTaxBatchResult", testTaxBatchToken).Return(uploadResponse, nil)
+
+		c, rec := newTaxBatchContext("/tax/batches/"+testTaxBatchToken+"/result?format=csv", testTaxBatchToken)
+		err := handler.TaxBatchResult(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "text/csv", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename="tax-results.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, "totalIncome,wht,tax,taxRefund,\"0-150,000\"\n500000,0,29000.00,0.00,0.00\n", rec.Body.String())
+	})
+
+	t.Run("NDJSON is not supported", func(t *testing.T) {
+		mockService := new(MockService)
+		handler := NewTaxHandler(mockService)
+
+		c, _ := newTaxBatchContext("/tax/batches/"+testTaxBatchToken+"/result?format=ndjson", testTaxBatchToken)
+		err := handler.TaxBatchResult(c)
+
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Equal(t, constant.MSG_HANDLER_ERR_INVALID_BATCH_FORMAT, err.(*echo.HTTPError).Message)
+		mockService.AssertNotCalled(t, "GetTaxBatchResult", mock.Anything)
+	})
+}
+
+func TestTaxBatchResultHandler_NotFinished(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+	mockService.On("GetTaxBatchResult", testTaxBatchToken).Return((*service.TaxUploadResponse)(nil), apperrs.NewConflictError(constant.MSG_BU_TAX_BATCH_NOT_FINISHED))
+
+	c, _ := newTaxBatchContext("/tax/batches/"+testTaxBatchToken+"/result", testTaxBatchToken)
+	err := handler.TaxBatchResult(c)
+
+	assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/service"
+)
+
+func (h *TaxHandler) Deductions(c echo.Context) error {
+
+	taxYear, err := parseTaxYear(c.QueryParam("taxYear"))
+	if err != nil {
+		return err
+	}
+
+	deductionsResponse, err := h.service.GetDeductions(taxYear)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, deductionsResponse)
+}
+
+func (h *TaxHandler) Deduction(c echo.Context) error {
+
+	taxYear, err := parseTaxYear(c.QueryParam("taxYear"))
+	if err != nil {
+		return err
+	}
+
+	deductionResponse, err := h.service.GetDeduction(c.Param("type"), taxYear)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, deductionResponse)
+}
+
+func (h *TaxHandler) AllowanceTypes(c echo.Context) error {
+
+	taxYear, err := parseTaxYear(c.QueryParam("taxYear"))
+	if err != nil {
+		return err
+	}
+
+	allowanceTypesResponse, err := h.service.GetAllowanceTypes(taxYear)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, allowanceTypesResponse)
+}
+
+func (h *TaxHandler) CreateDeduction(c echo.Context) error {
+
+	body, err := h.validateSchema(c, CREATE_DEDUCT_REQUEST)
+	if err != nil {
+		return err
+	}
+
+	var createRequest service.CreateDeductRequest
+	if err := json.Unmarshal(body, &createRequest); err != nil {
+		return err
+	}
+	createRequest.CreatedBy = adminUsername(c)
+
+	deductionResponse, err := h.service.CreateDeduction(&createRequest)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, deductionResponse)
+}
+
+func (h *TaxHandler) UpdateDeduction(c echo.Context) error {
+
+	body, err := h.validateSchema(c, UPDATE_DEDUCT_REQUEST)
+	if err != nil {
+		return err
+	}
+
+	var deductRequest service.UpdateDeductRequest
+	if err := json.Unmarshal(body, &deductRequest); err != nil {
+		return err
+	}
+	deductRequest.UpdatedBy = adminUsername(c)
+
+	updateResponse, err := h.service.UpdateDeduction(c.Param("type"), &deductRequest)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, updateResponse)
+}
+
+func (h *TaxHandler) DeductionHistory(c echo.Context) error {
+
+	taxYear, err := parseTaxYear(c.QueryParam("taxYear"))
+	if err != nil {
+		return err
+	}
+
+	historyResponse, err := h.service.GetDeductionHistory(c.Param("type"), taxYear)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, historyResponse)
+}
+
+// PreviewDeduction takes the sample incomes either as JSON or as a csv file
+// in the upload format, with amount and taxYear as form values.
+func (h *TaxHandler) PreviewDeduction(c echo.Context) error {
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return h.uploadPreviewDeduction(c)
+	}
+
+	body, err := h.validateSchema(c, PREVIEW_DEDUCT_REQUEST)
+	if err != nil {
+		return err
+	}
+
+	var previewRequest service.DeductPreviewRequest
+	if err := json.Unmarshal(body, &previewRequest); err != nil {
+		return err
+	}
+
+	previewResponse, err := h.service.PreviewDeduction(c.Param("type"), &previewRequest)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, previewResponse)
+}
+
+func (h *TaxHandler) uploadPreviewDeduction(c echo.Context) error {
+
+	file, err := c.FormFile("taxFile")
+	if err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to open file")
+	}
+	defer src.Close()
+
+	amount, err := money.Parse(c.FormValue("amount"))
+	if err != nil {
+		return apperrs.NewBadRequestError("amount" + constant.MSG_HANDLER_ERR_INVALID_NUMBER)
+	}
+
+	taxYear, err := parseTaxYear(c.FormValue("taxYear"))
+	if err != nil {
+		return err
+	}
+
+	previewRequest := service.DeductPreviewRequest{TaxYear: taxYear, Amount: amount}
+	previewResponse, err := h.service.UploadPreviewDeduction(c.Param("type"), src, &previewRequest)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, previewResponse)
+}
+
+// adminUsername returns the user the admin BasicAuth middleware let through
+func adminUsername(c echo.Context) string {
+	username, _ := c.Get(constant.CONTEXT_KEY_ADMIN_USERNAME).(string)
+	return username
+}
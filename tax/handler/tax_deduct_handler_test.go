@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeductionsHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/admin/deductions?taxYear=2024", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	deductions := &service.DeductionListResponse{Deductions: []service.DeductionResponse{
+		{DeductType: "personal", TaxYear: 2024, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000), CapRule: "fixed", Description: "Personal allowance"},
+	}}
+	mockService.On("GetDeductions", 2024).Return(deductions, nil)
+
+	err := handler.Deductions(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"deductions":[{"deductType":"personal","taxYear":2024,"amount":60000.00,"minAmount":10000.00,"maxAmount":100000.00,"capRule":"fixed","description":"Personal allowance"}]}`, rec.Body.String())
+}
+
+func TestDeductionHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/admin/deductions/:type")
+	c.SetParamNames("type")
+	c.SetParamValues("k-receipt")
+
+	mockService.On("GetDeduction", "k-receipt", 0).Return(&service.DeductionResponse{DeductType: "k-receipt", TaxYear: 2024, Amount: money.FromBaht(50000)}, nil)
+
+	err := handler.Deduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockService.AssertCalled(t, "GetDeduction", "k-receipt", 0)
+}
+
+func TestCreateDeductionHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	reqBody := `{"deductType":"life-insurance","taxYear":2024,"amount":100000,"maxAmount":100000,"description":"Life insurance premium"}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/deductions", strings.NewReader(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(constant.CONTEXT_KEY_ADMIN_USERNAME, "admin")
+
+	expectedRequest := &service.CreateDeductRequest{DeductType: "life-insurance", TaxYear: 2024, Amount: money.FromBaht(100000), MaxAmount: money.FromBaht(100000), Description: "Life insurance premium", CreatedBy: "admin"}
+	mockService.On("CreateDeduction", expectedRequest).Return(&service.DeductionResponse{DeductType: "life-insurance", TaxYear: 2024}, nil)
+
+	err := handler.CreateDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	mockService.AssertCalled(t, "CreateDeduction", expectedRequest)
+}
+
+func TestCreateDeductionHandler_InvalidPayload(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/admin/deductions", strings.NewReader(`{"deductType":"life-insurance"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	err := handler.CreateDeduction(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	mockService.AssertNotCalled(t, "CreateDeduction", mock.Anything)
+}
+
+func TestUpdateDeductionHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"amount":80000}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/admin/deductions/:type")
+	c.SetParamNames("type")
+	c.SetParamValues("life-insurance")
+	c.Set(constant.CONTEXT_KEY_ADMIN_USERNAME, "admin")
+
+	expectedRequest := &service.UpdateDeductRequest{Amount: money.FromBaht(80000), UpdatedBy: "admin"}
+	mockService.On("UpdateDeduction", "life-insurance", expectedRequest).Return(&service.UpdateDeductResponse{Amount: money.FromBaht(80000)}, nil)
+
+	err := handler.UpdateDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"amount":80000.00}`, rec.Body.String())
+}
+
+func TestAllowanceTypesHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/tax/allowances", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	allowanceTypes := &service.AllowanceTypeListResponse{TaxYear: 2024, AllowanceTypes: []service.AllowanceRule{
+		{AllowanceType: "donation", CapRule: "max", Amount: money.FromBaht(100000), Description: "Donation allowance"},
+	}}
+	mockService.On("GetAllowanceTypes", 0).Return(allowanceTypes, nil)
+
+	err := handler.AllowanceTypes(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"taxYear":2024,"allowanceTypes":[{"allowanceType":"donation","capRule":"max","amount":100000.00,"description":"Donation allowance"}]}`, rec.Body.String())
+}
+
+func TestDeductionHistoryHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/?taxYear=2024", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/admin/deductions/:type/history")
+	c.SetParamNames("type")
+	c.SetParamValues("k-receipt")
+
+	changedAt := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	oldAmount := money.FromBaht(50000)
+	historyResponse := &service.DeductionHistoryResponse{DeductType: "k-receipt", TaxYear: 2024, History: []service.DeductionChange{
+		{OldAmount: &oldAmount, NewAmount: money.FromBaht(70000), ChangedBy: "admin", EffectiveFrom: changedAt, ChangedAt: changedAt},
+	}}
+	mockService.On("GetDeductionHistory", "k-receipt", 2024).Return(historyResponse, nil)
+
+	err := handler.DeductionHistory(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"deductType":"k-receipt","taxYear":2024,"history":[{"oldAmount":50000.00,"newAmount":70000.00,"changedBy":"admin","effectiveFrom":"2024-03-01T09:30:00Z","changedAt":"2024-03-01T09:30:00Z"}]}`, rec.Body.String())
+}
+
+func TestUpdateDeductionHandler_EffectiveFrom(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"amount":70000,"effectiveFrom":"2025-01-01T00:00:00+07:00"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/admin/deductions/:type")
+	c.SetParamNames("type")
+	c.SetParamValues("k-receipt")
+
+	effectiveFrom := time.Date(2025, 1, 1, 0, 0, 0, 0, time.FixedZone("", 7*60*60))
+	mockService.On("UpdateDeduction", "k-receipt", mock.Anything).Return(&service.UpdateDeductResponse{Amount: money.FromBaht(70000), EffectiveFrom: &effectiveFrom}, nil)
+
+	err := handler.UpdateDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"amount":70000.00,"effectiveFrom":"2025-01-01T00:00:00+07:00"}`, rec.Body.String())
+
+	updateRequest := mockService.Calls[0].Arguments.Get(1).(*service.UpdateDeductRequest)
+	assert.True(t, effectiveFrom.Equal(*updateRequest.EffectiveFrom))
+}
+
+func TestUpdateDeductionHandler_InvalidEffectiveFrom(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"amount":70000,"effectiveFrom":"next monday"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	err := handler.UpdateDeduction(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	mockService.AssertNotCalled(t, "UpdateDeduction", mock.Anything, mock.Anything)
+}
+
+func TestPreviewDeductionHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	reqBody := `{"amount":100000,"incomes":[{"totalIncome":500000,"wht":0,"allowances":[]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("type")
+	c.SetParamValues("personal")
+
+	previewResponse := &service.DeductPreviewResponse{DeductType: "personal", TaxYear: 2024, Summary: service.DeductPreviewSummary{Count: 1, TaxDelta: money.FromBaht(-4000), RevenueDelta: money.FromBaht(-4000)}}
+	expectedRequest := &service.DeductPreviewRequest{Amount: money.FromBaht(100000), Incomes: []service.TaxRequest{{TotalIncome: money.FromBaht(500000), Allowances: []service.Allowance{}}}}
+	mockService.On("PreviewDeduction", "personal", expectedRequest).Return(previewResponse, nil)
+
+	err := handler.PreviewDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"revenueDelta":-4000.00`)
+}
+
+func TestPreviewDeductionHandler_InvalidPayload(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount":100000,"incomes":[]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	err := handler.PreviewDeduction(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	mockService.AssertNotCalled(t, "PreviewDeduction", mock.Anything, mock.Anything)
+}
+
+func TestPreviewDeductionHandler_Upload(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("taxFile", "incomes.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("totalIncome,wht,donation\n500000,0,0\n"))
+	writer.WriteField("amount", "100000")
+	writer.WriteField("taxYear", "2024")
+	writer.Close()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("type")
+	c.SetParamValues("personal")
+
+	previewResponse := &service.DeductPreviewResponse{DeductType: "personal", TaxYear: 2024}
+	expectedRequest := &service.DeductPreviewRequest{TaxYear: 2024, Amount: money.FromBaht(100000)}
+	mockService.On("UploadPreviewDeduction", "personal", mock.Anything, expectedRequest).Return(previewResponse, nil)
+
+	err = handler.PreviewDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockService.AssertCalled(t, "UploadPreviewDeduction", "personal", mock.Anything, expectedRequest)
+}
+
+func TestPreviewDeductionHandler_UploadInvalidAmount(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("taxFile", "incomes.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("totalIncome,wht,donation\n500000,0,0\n"))
+	writer.WriteField("amount", "a lot")
+	writer.Close()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	err = handler.PreviewDeduction(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/tax/service"
+)
+
+func (h *TaxHandler) TaxFilings(c echo.Context) error {
+
+	query, err := parseTaxFilingQuery(c)
+	if err != nil {
+		return err
+	}
+
+	filingsResponse, err := h.service.GetTaxFilings(query)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, filingsResponse)
+}
+
+func (h *TaxHandler) TaxFiling(c echo.Context) error {
+
+	filingId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || filingId <= 0 {
+		return apperrs.NewBadRequestError(constant.MSG_HANDLER_ERR_INVALID_FILING_ID)
+	}
+
+	filingResponse, err := h.service.GetTaxFiling(filingId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, filingResponse)
+}
+
+func parseTaxFilingQuery(c echo.Context) (*service.TaxFilingQuery, error) {
+	var err error
+	query := service.TaxFilingQuery{
+		Outcome: c.QueryParam("outcome"),
+	}
+
+	if query.From, err = parseTimeQuery(c, "from", false); err != nil {
+		return nil, err
+	}
+	if query.To, err = parseTimeQuery(c, "to", true); err != nil {
+		return nil, err
+	}
+	if query.MinIncome, err = parseMoneyQuery(c, "minIncome"); err != nil {
+		return nil, err
+	}
+	if query.MaxIncome, err = parseMoneyQuery(c, "maxIncome"); err != nil {
+		return nil, err
+	}
+
+	cursor, err := parseIntQuery(c, "cursor")
+	if err != nil {
+		return nil, err
+	}
+	query.Cursor = int64(cursor)
+
+	if query.Limit, err = parseIntQuery(c, "limit"); err != nil {
+		return nil, err
+	}
+
+	return &query, nil
+}
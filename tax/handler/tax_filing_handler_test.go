@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTaxFilingsHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/tax/filings?from=2024-03-01&to=2024-03-31&minIncome=100000&outcome=refund&cursor=50&limit=10", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	minIncome := money.FromBaht(100000)
+	expectedQuery := &service.TaxFilingQuery{From: &from, To: &to, MinIncome: &minIncome, Outcome: "refund", Cursor: 50, Limit: 10}
+
+	mockService.On("GetTaxFilings", expectedQuery).Return(&service.TaxFilingListResponse{Filings: []service.TaxFilingSummary{}}, nil)
+
+	err := handler.TaxFilings(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"filings":[]}`, rec.Body.String())
+	mockService.AssertCalled(t, "GetTaxFilings", expectedQuery)
+}
+
+func TestTaxFilingsHandler_InvalidQuery(t *testing.T) {
+	tests := []string{
+		"/tax/filings?from=yesterday",
+		"/tax/filings?minIncome=lots",
+		"/tax/filings?limit=ten",
+	}
+
+	for _, target := range tests {
+		t.Run(target, func(t *testing.T) {
+			mockService := new(MockService)
+			handler := NewTaxHandler(mockService)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			err := handler.TaxFilings(c)
+
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+			mockService.AssertNotCalled(t, "GetTaxFilings", mock.Anything)
+		})
+	}
+}
+
+func TestTaxFilingHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/tax/filings/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("42")
+
+	mockService.On("GetTaxFiling", int64(42)).Return(&service.TaxFilingResponse{FilingId: 42, Response: []byte(`{"tax":29000.00}`)}, nil)
+
+	err := handler.TaxFiling(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"response":{"tax":29000.00}`)
+}
+
+func TestTaxFilingHandler_InvalidId(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.SetParamNames("id")
+	c.SetParamValues("abc")
+
+	err := handler.TaxFiling(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+}
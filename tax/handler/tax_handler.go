@@ -1,10 +1,16 @@
 package handler
 
 import (
-	"net/http"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
 	"github.com/meteedev/assessment-tax/tax/service"
 
 )
@@ -51,6 +57,7 @@ func (h *TaxHandler) DeductionsPersonal(c echo.Context) error {
 	if err := json.Unmarshal(body, &deductRequest); err != nil {
 		return err
 	}
+	deductRequest.UpdatedBy = adminUsername(c)
 
 	updateResponse , err :=h.service.UpdatePersonalAllowance(&deductRequest)
 	if err != nil{
@@ -70,6 +77,7 @@ func (h *TaxHandler) DeductionsKreceipt(c echo.Context) error {
 	if err := json.Unmarshal(body, &deductRequest); err != nil {
 		return err
 	}
+	deductRequest.UpdatedBy = adminUsername(c)
 
 	updateResponse , err :=h.service.UpdateKreceiptAllowance(&deductRequest)
 	if err != nil{
@@ -79,8 +87,53 @@ func (h *TaxHandler) DeductionsKreceipt(c echo.Context) error {
 	return c.JSON(http.StatusOK, updateResponse)
 }
 
+func (h *TaxHandler) TaxGrossUp(c echo.Context) error {
+
+	body, err := h.validateSchema(c, GROSS_UP_REQUEST_SCHEMA)
+	if err != nil {
+		return err
+	}
+
+	var grossUpRequest service.GrossUpRequest
+	if err := json.Unmarshal(body, &grossUpRequest); err != nil {
+		return err
+	}
+
+	grossUpResponse, err := h.service.GrossUp(&grossUpRequest)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, grossUpResponse)
+}
+
+func (h *TaxHandler) TaxCompare(c echo.Context) error {
+
+	body, err := h.validateSchema(c, TAX_COMPARE_REQUEST_SCHEMA)
+	if err != nil {
+		return err
+	}
+
+	var compareRequest service.TaxCompareRequest
+	if err := json.Unmarshal(body, &compareRequest); err != nil {
+		return err
+	}
+
+	compareResponse, err := h.service.CompareTax(&compareRequest)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, compareResponse)
+}
+
 func (h *TaxHandler) TaxUploadCalculation(c echo.Context) error {	
 	
+	format, err := parseUploadFormat(c)
+	if err != nil {
+		return err
+	}
+
 	file, err := c.FormFile("taxFile")
 	if err != nil {
 		return err
@@ -93,13 +146,79 @@ func (h *TaxHandler) TaxUploadCalculation(c echo.Context) error {
 	}
 	defer src.Close()
 
-	uploadTaxResponse , err := h.service.UploadCalculationTax(src)
+	uploadOptions, err := parseUploadOptions(c, file)
+	if err != nil {
+		return err
+	}
+
+	if format == constant.TAX_UPLOAD_FORMAT_NDJSON {
+		return h.streamTaxUploadCalculation(c, src, uploadOptions)
+	}
+
+	uploadTaxResponse , err := h.service.UploadCalculationTax(src,uploadOptions)
 
 	if err != nil {
 		return err
 	}
 
+	switch format {
+	case constant.TAX_UPLOAD_FORMAT_CSV:
+		return writeTaxUploadSheet(c, constant.MIME_CSV, "csv", uploadTaxResponse.Sheet.WriteCSV)
+	case constant.TAX_UPLOAD_FORMAT_XLSX:
+		return writeTaxUploadSheet(c, constant.MIME_XLSX, "xlsx", uploadTaxResponse.Sheet.WriteXLSX)
+	}
+
 	return c.JSON(http.StatusOK, uploadTaxResponse)
 
 }
 
+// streamTaxUploadCalculation writes a result line per row as soon as it is
+// calculated. Once the first line is out the status can not change anymore,
+// a later error is sent as the last line.
+func (h *TaxHandler) streamTaxUploadCalculation(c echo.Context, src io.Reader, uploadOptions *service.TaxUploadOptions) error {
+	response := c.Response()
+	encoder := json.NewEncoder(response)
+
+	startResponse := func() {
+		if !response.Committed {
+			response.Header().Set(echo.HeaderContentType, constant.MIME_NDJSON)
+			response.WriteHeader(http.StatusOK)
+		}
+	}
+
+	err := h.service.StreamCalculationTax(c.Request().Context(), src, uploadOptions, func(result *service.TaxUploadResult) error {
+		startResponse()
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		response.Flush()
+		return nil
+	})
+
+	if err != nil && !response.Committed {
+		return err
+	}
+
+	startResponse()
+	switch e := err.(type) {
+	case nil:
+	case *echo.HTTPError:
+		encoder.Encode(apperrs.CustomError{Code: e.Code, Message: fmt.Sprint(e.Message)})
+	default:
+		log.Println(err)
+		encoder.Encode(apperrs.CustomError{Code: http.StatusInternalServerError, Message: constant.MSG_APP_ERR_UNEXPECTED_ERROR})
+	}
+	response.Flush()
+	return nil
+}
+
+// writeTaxUploadSheet sends the upload results as a file download
+func writeTaxUploadSheet(c echo.Context, contentType string, extension string, write func(io.Writer) error) error {
+	var buffer bytes.Buffer
+	if err := write(&buffer); err != nil {
+		return apperrs.NewInternalServerError(err.Error())
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="tax-results.%s"`, extension))
+	return c.Blob(http.StatusOK, contentType, buffer.Bytes())
+}
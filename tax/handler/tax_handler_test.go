@@ -2,7 +2,9 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"mime/multipart"
 	"io"
 	"net/http"
@@ -11,6 +13,8 @@ import (
 	"testing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
 	"github.com/meteedev/assessment-tax/tax/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -35,11 +39,101 @@ func (m *MockService) UpdateKreceiptAllowance(updateDeductRequest *service.Updat
 	return args.Get(0).(*service.UpdateDeductResponse), args.Error(1)
 }
 
-func (m *MockService) UploadCalculationTax(file io.Reader)(*service.TaxUploadResponse,error){
-	args := m.Called(file)
+func (m *MockService) GetDeductions(taxYear int)(*service.DeductionListResponse,error){
+	args := m.Called(taxYear)
+	return args.Get(0).(*service.DeductionListResponse), args.Error(1)
+}
+
+func (m *MockService) GetDeduction(deductType string,taxYear int)(*service.DeductionResponse,error){
+	args := m.Called(deductType,taxYear)
+	return args.Get(0).(*service.DeductionResponse), args.Error(1)
+}
+
+func (m *MockService) CreateDeduction(createDeductRequest *service.CreateDeductRequest)(*service.DeductionResponse,error){
+	args := m.Called(createDeductRequest)
+	return args.Get(0).(*service.DeductionResponse), args.Error(1)
+}
+
+func (m *MockService) UpdateDeduction(deductType string,updateDeductRequest *service.UpdateDeductRequest)(*service.UpdateDeductResponse,error){
+	args := m.Called(deductType,updateDeductRequest)
+	return args.Get(0).(*service.UpdateDeductResponse), args.Error(1)
+}
+
+func (m *MockService) GetAllowanceTypes(taxYear int)(*service.AllowanceTypeListResponse,error){
+	args := m.Called(taxYear)
+	return args.Get(0).(*service.AllowanceTypeListResponse), args.Error(1)
+}
+
+func (m *MockService) GetDeductionHistory(deductType string,taxYear int)(*service.DeductionHistoryResponse,error){
+	args := m.Called(deductType,taxYear)
+	return args.Get(0).(*service.DeductionHistoryResponse), args.Error(1)
+}
+
+func (m *MockService) PreviewDeduction(deductType string,previewRequest *service.DeductPreviewRequest)(*service.DeductPreviewResponse,error){
+	args := m.Called(deductType,previewRequest)
+	return args.Get(0).(*service.DeductPreviewResponse), args.Error(1)
+}
+
+func (m *MockService) UploadPreviewDeduction(deductType string,file io.Reader,previewRequest *service.DeductPreviewRequest)(*service.DeductPreviewResponse,error){
+	args := m.Called(deductType,file,previewRequest)
+	return args.Get(0).(*service.DeductPreviewResponse), args.Error(1)
+}
+
+func (m *MockService) UploadCalculationTax(file io.Reader,options *service.TaxUploadOptions)(*service.TaxUploadResponse,error){
+	args := m.Called(file,options)
 	return args.Get(0).(*service.TaxUploadResponse), args.Error(1)
 }
 
+// StreamCalculationTax emits the results the mock returns before its error
+func (m *MockService) StreamCalculationTax(ctx context.Context,file io.Reader,options *service.TaxUploadOptions,emit func(*service.TaxUploadResult) error) error {
+	args := m.Called(file,options)
+	for _, result := range args.Get(0).([]*service.TaxUploadResult) {
+		if err := emit(result); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockService) GrossUp(grossUpReq *service.GrossUpRequest)(*service.GrossUpResponse,error){
+	args := m.Called(grossUpReq)
+	return args.Get(0).(*service.GrossUpResponse), args.Error(1)
+}
+
+func (m *MockService) CompareTax(compareReq *service.TaxCompareRequest)(*service.TaxCompareResponse,error){
+	args := m.Called(compareReq)
+	return args.Get(0).(*service.TaxCompareResponse), args.Error(1)
+}
+
+func (m *MockService) CreateTaxBatch(file io.Reader,options *service.TaxUploadOptions)(*service.TaxBatchResponse,error){
+	args := m.Called(file,options)
+	return args.Get(0).(*service.TaxBatchResponse), args.Error(1)
+}
+
+func (m *MockService) GetTaxBatch(token string)(*service.TaxBatchResponse,error){
+	args := m.Called(token)
+	return args.Get(0).(*service.TaxBatchResponse), args.Error(1)
+}
+
+func (m *MockService) GetTaxBatchResult(token string)(*service.TaxUploadResponse,error){
+	args := m.Called(token)
+	return args.Get(0).(*service.TaxUploadResponse), args.Error(1)
+}
+
+func (m *MockService) RunTaxBatches(ctx context.Context){
+	m.Called(ctx)
+}
+
+func (m *MockService) GetTaxFilings(query *service.TaxFilingQuery)(*service.TaxFilingListResponse,error){
+	args := m.Called(query)
+	return args.Get(0).(*service.TaxFilingListResponse), args.Error(1)
+}
+
+func (m *MockService) GetTaxFiling(id int64)(*service.TaxFilingResponse,error){
+	args := m.Called(id)
+	return args.Get(0).(*service.TaxFilingResponse), args.Error(1)
+}
+
 func TestTaxCalculationsHandler(t *testing.T) {
 	// Create a new instance of the mock service
 	mockService := new(MockService)
@@ -56,7 +150,7 @@ func TestTaxCalculationsHandler(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	// Mock the service method
-	expectedResponse := &service.TaxResponse{Tax: 15000.0}
+	expectedResponse := &service.TaxResponse{Tax: money.FromBaht(15000)}
 	mockService.On("CalculationTax", mock.Anything).Return(expectedResponse, nil)
 
 	// Call the handler method
@@ -75,6 +169,144 @@ func TestTaxCalculationsHandler(t *testing.T) {
 	mockService.AssertCalled(t, "CalculationTax", mock.Anything)
 }
 
+func TestTaxCalculationsHandler_InvalidFilingStatus(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	reqBody := []byte(`{"totalIncome":100000,"wht":0,"allowances":[],"filingStatus":"married","spouse":{"totalIncome":0,"wht":0,"allowances":[]}}`)
+	req := httptest.NewRequest(http.MethodPost, "/tax/calculations", bytes.NewBuffer(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	err := handler.TaxCalculation(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	mockService.AssertNotCalled(t, "CalculationTax", mock.Anything)
+}
+
+func TestTaxCalculationsHandler_Incomes(t *testing.T) {
+	testCases := []struct {
+		name         string
+		reqBody      string
+		expectedCode int
+	}{
+		{name: "IncomesWithoutTotalIncome", reqBody: `{"incomes":[{"category":"40(1)","amount":600000}],"wht":0,"allowances":[]}`, expectedCode: http.StatusOK},
+		{name: "NoIncome", reqBody: `{"wht":0,"allowances":[]}`, expectedCode: http.StatusBadRequest},
+		{name: "EmptyIncomes", reqBody: `{"incomes":[],"wht":0,"allowances":[]}`, expectedCode: http.StatusBadRequest},
+		{name: "SpouseIncomes", reqBody: `{"totalIncome":600000,"wht":0,"allowances":[],"filingStatus":"joint","spouse":{"incomes":[{"category":"40(1)","amount":300000}],"wht":0,"allowances":[]}}`, expectedCode: http.StatusOK},
+		{name: "SpouseNoIncome", reqBody: `{"totalIncome":600000,"wht":0,"allowances":[],"filingStatus":"joint","spouse":{"wht":0,"allowances":[]}}`, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(MockService)
+			mockService.On("CalculationTax", mock.Anything).Return(&service.TaxResponse{}, nil)
+			handler := NewTaxHandler(mockService)
+
+			req := httptest.NewRequest(http.MethodPost, "/tax/calculations", strings.NewReader(tc.reqBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			err := handler.TaxCalculation(c)
+
+			if tc.expectedCode == http.StatusOK {
+				assert.NoError(t, err)
+				assert.Equal(t, http.StatusOK, rec.Code)
+			} else {
+				assert.Equal(t, tc.expectedCode, err.(*echo.HTTPError).Code)
+				mockService.AssertNotCalled(t, "CalculationTax", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestTaxGrossUpHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	reqBody := []byte(`{"netIncome":471000,"allowances":[{"allowanceType":"donation","amount":0}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/gross-up", bytes.NewBuffer(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	expectedRequest := &service.GrossUpRequest{NetIncome: money.FromBaht(471000), Allowances: []service.Allowance{{AllowanceType: "donation", Amount: 0}}}
+	grossUpResponse := &service.GrossUpResponse{
+		NetIncome:   money.FromBaht(471000),
+		TotalIncome: money.FromBaht(500000),
+		TaxResponse: service.TaxResponse{TaxYear: 2024, Tax: money.FromBaht(29000), TaxStep: []service.TaxStep{}},
+	}
+	mockService.On("GrossUp", expectedRequest).Return(grossUpResponse, nil)
+
+	err := handler.TaxGrossUp(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"netIncome":471000.00,"totalIncome":500000.00,"taxYear":2024,"tax":29000.00,"taxRefund":0.00,"taxLevel":[]}`, rec.Body.String())
+}
+
+func TestTaxGrossUpHandler_InvalidBody(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	reqBody := []byte(`{"netIncome":-1,"allowances":[]}`)
+	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/gross-up", bytes.NewBuffer(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	err := handler.TaxGrossUp(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	mockService.AssertNotCalled(t, "GrossUp", mock.Anything)
+}
+
+func TestTaxCompareHandler(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	reqBody := []byte(`{"base":{"totalIncome":500000,"wht":0,"allowances":[]},"scenarios":[{"name":"donate 100k more","allowances":[{"allowanceType":"donation","amount":100000}]},{"name":"raise","totalIncome":600000}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/compare", bytes.NewBuffer(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	raisedIncome := money.FromBaht(600000)
+	expectedRequest := &service.TaxCompareRequest{
+		Base: service.TaxRequest{TotalIncome: money.FromBaht(500000), Allowances: []service.Allowance{}},
+		Scenarios: []service.TaxScenario{
+			{Name: "donate 100k more", Allowances: []service.Allowance{{AllowanceType: "donation", Amount: money.FromBaht(100000)}}},
+			{Name: "raise", TotalIncome: &raisedIncome},
+		},
+	}
+	compareResponse := &service.TaxCompareResponse{BestScenario: "donate 100k more"}
+	mockService.On("CompareTax", expectedRequest).Return(compareResponse, nil)
+
+	err := handler.TaxCompare(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response service.TaxCompareResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "donate 100k more", response.BestScenario)
+}
+
+func TestTaxCompareHandler_InvalidBody(t *testing.T) {
+	mockService := new(MockService)
+	handler := NewTaxHandler(mockService)
+
+	reqBody := []byte(`{"base":{"totalIncome":500000,"wht":0,"allowances":[]},"scenarios":[]}`)
+	req := httptest.NewRequest(http.MethodPost, "/tax/calculations/compare", bytes.NewBuffer(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	err := handler.TaxCompare(c)
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	mockService.AssertNotCalled(t, "CompareTax", mock.Anything)
+}
+
 
 func TestDeductionsPersonalHandler(t *testing.T) {
 	// Create a new instance of the mock service
@@ -92,7 +324,7 @@ func TestDeductionsPersonalHandler(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	// Mock the service method
-	expectedResponse := &service.UpdateDeductResponse{Amount: 60000.0}
+	expectedResponse := &service.UpdateDeductResponse{Amount: money.FromBaht(60000)}
 	mockService.On("UpdatePersonalAllowance", mock.Anything).Return(expectedResponse, nil)
 
 	// Call the handler method
@@ -127,7 +359,7 @@ func TestDeductionsKreceiptHandler(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	// Mock the service method
-	expectedResponse := &service.UpdateDeductResponse{Amount: 70000.0}
+	expectedResponse := &service.UpdateDeductResponse{Amount: money.FromBaht(70000)}
 	mockService.On("UpdateKreceiptAllowance", mock.Anything).Return(expectedResponse, nil)
 
 	// Call the handler method
@@ -178,7 +410,7 @@ func TestTaxHandler_TaxUploadCalculation(t *testing.T) {
 
 	// Mock the UploadCalculationTax method of the service
 	mockResponse := &service.TaxUploadResponse{}
-	mockService.On("UploadCalculationTax", mock.Anything).Return(mockResponse, nil).Run(func(args mock.Arguments) {
+	mockService.On("UploadCalculationTax", mock.Anything, &service.TaxUploadOptions{ContentType: "application/octet-stream"}).Return(mockResponse, nil).Run(func(args mock.Arguments) {
 		// Assert that the file passed to the service is the same as the one received by the handler
 		file := args.Get(0).(io.Reader)
 		fileBytes, err := io.ReadAll(file)
@@ -197,5 +429,257 @@ func TestTaxHandler_TaxUploadCalculation(t *testing.T) {
 
 
 	// Assert that the UploadCalculationTax method was called with the correct argument
-	mockService.AssertCalled(t, "UploadCalculationTax", mock.Anything)
-}
\ No newline at end of file
+	mockService.AssertCalled(t, "UploadCalculationTax", mock.Anything, &service.TaxUploadOptions{ContentType: "application/octet-stream"})
+}
+func TestTaxHandler_TaxUploadCalculation_TaxYear(t *testing.T) {
+	e := echo.New()
+	mockService := new(MockService)
+	taxHandler := NewTaxHandler(mockService)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("taxFile", "test.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(part, strings.NewReader("totalIncome,wht,donation\n500000,0,0\n")); err != nil {
+		t.Fatal(err)
+	}
+	writer.WriteField("taxYear", "2023")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockService.On("UploadCalculationTax", mock.Anything, &service.TaxUploadOptions{TaxYear: 2023, ContentType: "application/octet-stream"}).Return(&service.TaxUploadResponse{}, nil)
+
+	err = taxHandler.TaxUploadCalculation(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockService.AssertCalled(t, "UploadCalculationTax", mock.Anything, &service.TaxUploadOptions{TaxYear: 2023, ContentType: "application/octet-stream"})
+}
+
+func TestParseTaxYear(t *testing.T) {
+	taxYear, err := parseTaxYear("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, taxYear)
+
+	taxYear, err = parseTaxYear("2024")
+	assert.NoError(t, err)
+	assert.Equal(t, 2024, taxYear)
+
+	_, err = parseTaxYear("two thousand")
+	assert.Error(t, err)
+
+	_, err = parseTaxYear("-1")
+	assert.Error(t, err)
+}
+
+func TestTaxHandler_TaxUploadCalculation_PartialMode(t *testing.T) {
+	e := echo.New()
+	mockService := new(MockService)
+	taxHandler := NewTaxHandler(mockService)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("taxFile", "test.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(part, strings.NewReader("totalIncome,wht,donation\n500000,0,0\n600000,700000,0\n")); err != nil {
+		t.Fatal(err)
+	}
+	writer.WriteField("mode", "partial")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	uploadResponse := &service.TaxUploadResponse{
+		Taxes:  []service.TaxUpload{{TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000)}},
+		Errors: []service.TaxUploadError{{Line: 3, Column: "wht", Reason: "wht can not greater than Total income"}},
+	}
+	mockService.On("UploadCalculationTax", mock.Anything, &service.TaxUploadOptions{Partial: true, ContentType: "application/octet-stream"}).Return(uploadResponse, nil)
+
+	err = taxHandler.TaxUploadCalculation(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"taxes":[{"totalIncome":500000.00,"tax":29000.00,"taxRefund":0.00}],"errors":[{"line":3,"column":"wht","reason":"wht can not greater than Total income"}]}`, rec.Body.String())
+}
+
+func TestParseUploadMode(t *testing.T) {
+	partial, err := parseUploadMode("")
+	assert.NoError(t, err)
+	assert.False(t, partial)
+
+	partial, err = parseUploadMode("strict")
+	assert.NoError(t, err)
+	assert.False(t, partial)
+
+	partial, err = parseUploadMode("partial")
+	assert.NoError(t, err)
+	assert.True(t, partial)
+
+	_, err = parseUploadMode("lenient")
+	assert.Error(t, err)
+}
+
+// newTaxUploadContext builds an upload request of a small csv file
+func newTaxUploadContext(t *testing.T, target string, accept string) (echo.Context, *httptest.ResponseRecorder) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("taxFile", "test.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(part, strings.NewReader("totalIncome,wht\n500000,0\n")); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if accept != "" {
+		req.Header.Set(echo.HeaderAccept, accept)
+	}
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestTaxHandler_TaxUploadCalculation_Download(t *testing.T) {
+	uploadResponse := &service.TaxUploadResponse{
+		Taxes: []service.TaxUpload{{TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000)}},
+		Sheet: &service.TaxUploadSheet{
+			Header: []string{"totalIncome", "wht"},
+			Levels: []string{"0-150,000"},
+			Rows:   []service.TaxUploadSheetRow{{Record: []string{"500000", "0"}, TaxResponse: &service.TaxResponse{Tax: money.FromBaht(29000), TaxStep: []service.TaxStep{{Level: "0-150,000"}}}}},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		target      string
+		accept      string
+		contentType string
+	}{
+		{name: "Format query csv", target: "/?format=csv", contentType: "text/csv"},
+		{name: "Accept csv", target: "/", accept: "text/csv", contentType: "text/csv"},
+		{name: "Accept xlsx", target: "/", accept: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{name: "Format query wins over Accept", target: "/?format=json", accept: "text/csv", contentType: echo.MIMEApplicationJSON},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(MockService)
+			taxHandler := NewTaxHandler(mockService)
+			mockService.On("UploadCalculationTax", mock.Anything, mock.Anything).Return(uploadResponse, nil)
+
+			c, rec := newTaxUploadContext(t, tc.target, tc.accept)
+			err := taxHandler.TaxUploadCalculation(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tc.contentType, rec.Header().Get(echo.HeaderContentType))
+		})
+	}
+}
+
+func TestTaxHandler_TaxUploadCalculation_DownloadCSV(t *testing.T) {
+	mockService := new(MockService)
+	taxHandler := NewTaxHandler(mockService)
+
+	uploadResponse := &service.TaxUploadResponse{
+		Sheet: &service.TaxUploadSheet{
+			Header: []string{"totalIncome", "wht"},
+			Levels: []string{"0-150,000"},
+			Rows:   []service.TaxUploadSheetRow{{Record: []string{"500000", "0"}, TaxResponse: &service.TaxResponse{Tax: money.FromBaht(29000), TaxStep: []service.TaxStep{{Level: "0-150,000"}}}}},
+		},
+	}
+	mockService.On("UploadCalculationTax", mock.Anything, mock.Anything).Return(uploadResponse, nil)
+
+	c, rec := newTaxUploadContext(t, "/?format=csv", "")
+	err := taxHandler.TaxUploadCalculation(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `attachment; filename="tax-results.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+	assert.Equal(t, "totalIncome,wht,tax,taxRefund,\"0-150,000\"\n500000,0,29000.00,0.00,0.00\n", rec.Body.String())
+}
+
+func TestParseUploadFormat(t *testing.T) {
+	c, _ := newTaxUploadContext(t, "/?format=pdf", "")
+	_, err := parseUploadFormat(c)
+	assert.Error(t, err)
+
+	c, _ = newTaxUploadContext(t, "/", "application/json")
+	format, err := parseUploadFormat(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "json", format)
+}
+
+func TestTaxHandler_TaxUploadCalculation_Stream(t *testing.T) {
+	mockService := new(MockService)
+	taxHandler := NewTaxHandler(mockService)
+
+	results := []*service.TaxUploadResult{
+		{Line: 2, Id: "E001", TaxUpload: &service.TaxUpload{TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000)}},
+		{Line: 3, Errors: []service.TaxUploadError{{Line: 3, Column: "wht", Reason: "wht must not be less than 0 "}}},
+	}
+	mockService.On("StreamCalculationTax", mock.Anything, mock.Anything).Return(results, nil)
+
+	c, rec := newTaxUploadContext(t, "/", "application/x-ndjson")
+	err := taxHandler.TaxUploadCalculation(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `{"line":2,"id":"E001","totalIncome":500000.00,"tax":29000.00,"taxRefund":0.00}`+"\n"+
+		`{"line":3,"errors":[{"line":3,"column":"wht","reason":"wht must not be less than 0 "}]}`+"\n", rec.Body.String())
+	mockService.AssertNotCalled(t, "UploadCalculationTax", mock.Anything, mock.Anything)
+}
+
+func TestTaxHandler_TaxUploadCalculation_StreamErrors(t *testing.T) {
+	t.Run("Before the first line", func(t *testing.T) {
+		mockService := new(MockService)
+		taxHandler := NewTaxHandler(mockService)
+		mockService.On("StreamCalculationTax", mock.Anything, mock.Anything).Return([]*service.TaxUploadResult{}, echo.NewHTTPError(http.StatusBadRequest, "upload header must have totalIncome and wht columns"))
+
+		c, _ := newTaxUploadContext(t, "/?format=ndjson", "")
+		err := taxHandler.TaxUploadCalculation(c)
+
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("After the first line", func(t *testing.T) {
+		mockService := new(MockService)
+		taxHandler := NewTaxHandler(mockService)
+		results := []*service.TaxUploadResult{{Line: 2, TaxUpload: &service.TaxUpload{TotalIncome: money.FromBaht(500000)}}}
+		mockService.On("StreamCalculationTax", mock.Anything, mock.Anything).Return(results, echo.NewHTTPError(http.StatusBadRequest, "xlsx file can not be read"))
+
+		c, rec := newTaxUploadContext(t, "/?format=ndjson", "")
+		err := taxHandler.TaxUploadCalculation(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"line":2,"totalIncome":500000.00,"tax":0.00,"taxRefund":0.00}`+"\n"+`{"code":400,"message":"xlsx file can not be read"}`+"\n", rec.Body.String())
+	})
+
+	t.Run("Unexpected error after the first line", func(t *testing.T) {
+		mockService := new(MockService)
+		taxHandler := NewTaxHandler(mockService)
+		results := []*service.TaxUploadResult{{Line: 2, TaxUpload: &service.TaxUpload{TotalIncome: money.FromBaht(500000)}}}
+		mockService.On("StreamCalculationTax", mock.Anything, mock.Anything).Return(results, errors.New("connection reset"))
+
+		c, rec := newTaxUploadContext(t, "/?format=ndjson", "")
+		err := taxHandler.TaxUploadCalculation(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"line":2,"totalIncome":500000.00,"tax":0.00,"taxRefund":0.00}`+"\n"+`{"code":500,"message":"`+constant.MSG_APP_ERR_UNEXPECTED_ERROR+`"}`+"\n", rec.Body.String())
+	})
+}
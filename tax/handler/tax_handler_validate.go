@@ -2,11 +2,17 @@ package handler
 
 import (
 	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/xeipuuv/gojsonschema"
 	"github.com/labstack/echo/v4"
 	"github.com/meteedev/assessment-tax/apperrs"
 	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/service"
 )
 
 
@@ -40,3 +46,121 @@ func (h *TaxHandler) validateSchema(c echo.Context, schema string) ([]byte,error
 
 	return body,nil
 }
+
+
+// parseTaxYear reads an optional tax year form value, 0 means not specified
+func parseTaxYear(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	taxYear, err := strconv.Atoi(value)
+	if err != nil || taxYear <= 0 {
+		return 0, apperrs.NewBadRequestError(constant.MSG_BU_INVALID_TAX_YEAR)
+	}
+
+	return taxYear, nil
+}
+
+
+// parseUploadMode reports whether an upload runs in partial mode, strict is
+// the default
+func parseUploadMode(value string) (bool, error) {
+	switch value {
+	case "", constant.TAX_UPLOAD_MODE_STRICT:
+		return false, nil
+	case constant.TAX_UPLOAD_MODE_PARTIAL:
+		return true, nil
+	}
+	return false, apperrs.NewBadRequestError(constant.MSG_HANDLER_ERR_INVALID_UPLOAD_MODE)
+}
+
+
+// parseUploadOptions reads the form fields sent along with an upload file.
+func parseUploadOptions(c echo.Context, file *multipart.FileHeader) (*service.TaxUploadOptions, error) {
+	taxYear, err := parseTaxYear(c.FormValue("taxYear"))
+	if err != nil {
+		return nil, err
+	}
+
+	partial, err := parseUploadMode(c.FormValue("mode"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &service.TaxUploadOptions{TaxYear: taxYear, Partial: partial, ContentType: file.Header.Get(echo.HeaderContentType)}, nil
+}
+
+// parseUploadFormat picks the response format of an upload from the format
+// query parameter or else the Accept header, JSON is the default
+func parseUploadFormat(c echo.Context) (string, error) {
+	switch format := c.QueryParam("format"); format {
+	case "":
+	case constant.TAX_UPLOAD_FORMAT_JSON, constant.TAX_UPLOAD_FORMAT_NDJSON, constant.TAX_UPLOAD_FORMAT_CSV, constant.TAX_UPLOAD_FORMAT_XLSX:
+		return format, nil
+	default:
+		return "", apperrs.NewBadRequestError(constant.MSG_HANDLER_ERR_INVALID_UPLOAD_FORMAT)
+	}
+
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	switch {
+	case strings.Contains(accept, constant.MIME_NDJSON):
+		return constant.TAX_UPLOAD_FORMAT_NDJSON, nil
+	case strings.Contains(accept, constant.MIME_XLSX):
+		return constant.TAX_UPLOAD_FORMAT_XLSX, nil
+	case strings.Contains(accept, constant.MIME_CSV):
+		return constant.TAX_UPLOAD_FORMAT_CSV, nil
+	}
+	return constant.TAX_UPLOAD_FORMAT_JSON, nil
+}
+
+
+// parseTimeQuery accepts a RFC3339 timestamp or a plain date. A plain date
+// used as an exclusive upper bound is moved to the next day so the whole
+// date is included.
+func parseTimeQuery(c echo.Context, name string, endOfRange bool) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return &parsed, nil
+	}
+
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(name + constant.MSG_HANDLER_ERR_INVALID_DATE)
+	}
+
+	if endOfRange {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return &parsed, nil
+}
+
+func parseMoneyQuery(c echo.Context, name string) (*money.Money, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	amount, err := money.Parse(value)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(name + constant.MSG_HANDLER_ERR_INVALID_NUMBER)
+	}
+	return &amount, nil
+}
+
+func parseIntQuery(c echo.Context, name string) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, apperrs.NewBadRequestError(name + constant.MSG_HANDLER_ERR_INVALID_NUMBER)
+	}
+	return number, nil
+}
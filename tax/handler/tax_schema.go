@@ -7,6 +7,10 @@ const TAX_REQUEST_SCHEMA = `
   "title": "Tax Request Schema",
   "type": "object",
   "properties": {
+    "taxYear": {
+      "type": "integer",
+      "minimum": 1
+    },
     "totalIncome": {
       "type": "number",
       "minimum": 0
@@ -15,6 +19,132 @@ const TAX_REQUEST_SCHEMA = `
       "type": "number",
       "minimum": 0
     },
+    "allowances": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "allowanceType": {
+            "type": "string"
+          },
+          "amount": {
+            "type": "number",
+            "minimum": 0
+          }
+        },
+        "required": ["allowanceType", "amount"]
+      }
+    },
+    "incomes": {
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "properties": {
+          "category": {
+            "type": "string"
+          },
+          "amount": {
+            "type": "number",
+            "minimum": 0
+          }
+        },
+        "required": ["category", "amount"]
+      }
+    },
+    "dependents": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "dependentType": {
+            "type": "string"
+          },
+          "birthYear": {
+            "type": "integer",
+            "minimum": 1
+          }
+        },
+        "required": ["dependentType"]
+      }
+    },
+    "filingStatus": {
+      "type": "string",
+      "enum": ["single", "joint", "separate"]
+    },
+    "spouse": {
+      "type": "object",
+      "properties": {
+        "totalIncome": {
+          "type": "number",
+          "minimum": 0
+        },
+        "wht": {
+          "type": "number",
+          "minimum": 0
+        },
+        "allowances": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "properties": {
+              "allowanceType": {
+                "type": "string"
+              },
+              "amount": {
+                "type": "number",
+                "minimum": 0
+              }
+            },
+            "required": ["allowanceType", "amount"]
+          }
+        },
+        "incomes": {
+          "type": "array",
+          "minItems": 1,
+          "items": {
+            "type": "object",
+            "properties": {
+              "category": {
+                "type": "string"
+              },
+              "amount": {
+                "type": "number",
+                "minimum": 0
+              }
+            },
+            "required": ["category", "amount"]
+          }
+        }
+      },
+      "required": ["wht", "allowances"],
+      "anyOf": [
+        { "required": ["totalIncome"] },
+        { "required": ["incomes"] }
+      ]
+    }
+  },
+  "required": ["wht", "allowances"],
+  "anyOf": [
+    { "required": ["totalIncome"] },
+    { "required": ["incomes"] }
+  ]
+}
+`
+const GROSS_UP_REQUEST_SCHEMA = `
+{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Gross Up Request Schema",
+  "type": "object",
+  "properties": {
+    "taxYear": {
+      "type": "integer",
+      "minimum": 1
+    },
+    "netIncome": {
+      "type": "number",
+      "minimum": 0
+    },
     "allowances": {
       "type": "array",
       "items": {
@@ -32,7 +162,89 @@ const TAX_REQUEST_SCHEMA = `
       }
     }
   },
-  "required": ["totalIncome", "wht", "allowances"]
+  "required": ["netIncome", "allowances"]
+}
+`
+const TAX_COMPARE_REQUEST_SCHEMA = `
+{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Tax Compare Request Schema",
+  "type": "object",
+  "properties": {
+    "base": {
+      "type": "object",
+      "properties": {
+        "taxYear": {
+          "type": "integer",
+          "minimum": 1
+        },
+        "totalIncome": {
+          "type": "number",
+          "minimum": 0
+        },
+        "wht": {
+          "type": "number",
+          "minimum": 0
+        },
+        "allowances": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "properties": {
+              "allowanceType": {
+                "type": "string"
+              },
+              "amount": {
+                "type": "number",
+                "minimum": 0
+              }
+            },
+            "required": ["allowanceType", "amount"]
+          }
+        }
+      },
+      "required": ["totalIncome", "wht", "allowances"]
+    },
+    "scenarios": {
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "properties": {
+          "name": {
+            "type": "string",
+            "minLength": 1
+          },
+          "totalIncome": {
+            "type": "number",
+            "minimum": 0
+          },
+          "wht": {
+            "type": "number",
+            "minimum": 0
+          },
+          "allowances": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "allowanceType": {
+                  "type": "string"
+                },
+                "amount": {
+                  "type": "number",
+                  "minimum": 0
+                }
+              },
+              "required": ["allowanceType", "amount"]
+            }
+          }
+        },
+        "required": ["name"]
+      }
+    }
+  },
+  "required": ["base", "scenarios"]
 }
 `
 const UPDATE_DEDUCT_REQUEST = `
@@ -41,10 +253,115 @@ const UPDATE_DEDUCT_REQUEST = `
   "title": "Update Deduct Request Schema",
   "type": "object",
   "properties": {
+    "taxYear": {
+      "type": "integer",
+      "minimum": 1
+    },
     "amount": {
       "type": "number"
+    },
+    "effectiveFrom": {
+      "type": "string",
+      "format": "date-time"
     }
   },
   "required": ["amount"]
 }
-`
\ No newline at end of file
+`
+const CREATE_DEDUCT_REQUEST = `
+{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Create Deduct Request Schema",
+  "type": "object",
+  "properties": {
+    "deductType": {
+      "type": "string",
+      "minLength": 1
+    },
+    "taxYear": {
+      "type": "integer",
+      "minimum": 1
+    },
+    "amount": {
+      "type": "number",
+      "minimum": 0
+    },
+    "minAmount": {
+      "type": "number",
+      "minimum": 0
+    },
+    "maxAmount": {
+      "type": "number",
+      "minimum": 0
+    },
+    "capRule": {
+      "type": "string"
+    },
+    "rate": {
+      "type": "number",
+      "minimum": 0,
+      "maximum": 1
+    },
+    "multiplier": {
+      "type": "number",
+      "minimum": 0
+    },
+    "description": {
+      "type": "string",
+      "maxLength": 100
+    }
+  },
+  "required": ["deductType", "amount", "maxAmount"]
+}
+`
+const PREVIEW_DEDUCT_REQUEST = `
+{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Preview Deduct Request Schema",
+  "type": "object",
+  "properties": {
+    "taxYear": {
+      "type": "integer",
+      "minimum": 1
+    },
+    "amount": {
+      "type": "number"
+    },
+    "incomes": {
+      "type": "array",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "properties": {
+          "totalIncome": {
+            "type": "number",
+            "minimum": 0
+          },
+          "wht": {
+            "type": "number",
+            "minimum": 0
+          },
+          "allowances": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "allowanceType": {
+                  "type": "string"
+                },
+                "amount": {
+                  "type": "number",
+                  "minimum": 0
+                }
+              },
+              "required": ["allowanceType", "amount"]
+            }
+          }
+        },
+        "required": ["totalIncome", "wht", "allowances"]
+      }
+    }
+  },
+  "required": ["amount", "incomes"]
+}
+`
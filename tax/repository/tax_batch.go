@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// TaxBatch is an upload calculated in the background. File is the upload as
+// it was sent, so a job interrupted by a restart can be calculated again, and
+// Result is the JSON summary of the finished calculation, its rows are
+// stored in tax_batch_row. Token is the random id the job is looked up by
+// from outside, BatchId stays internal as it can be guessed.
+type TaxBatch struct {
+	BatchId       int64           `json:"batch_id"`
+	Token         string          `json:"token"`
+	Status        string          `json:"status"`
+	TaxYear       int             `json:"tax_year"`
+	Partial       bool            `json:"partial"`
+	ContentType   string          `json:"content_type"`
+	File          []byte          `json:"-"`
+	TotalRows     int             `json:"total_rows"`
+	ProcessedRows int             `json:"processed_rows"`
+	FailedRows    int             `json:"failed_rows"`
+	Result        json.RawMessage `json:"-"`
+	Error         string          `json:"error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	StartedAt     *time.Time      `json:"started_at"`
+	FinishedAt    *time.Time      `json:"finished_at"`
+}
+
+var ErrTaxBatchNotFound = errors.New("tax batch not found")
+
+// ErrTaxBatchLeaseLost is returned when a server updates a job it no longer
+// holds, its lease ran out and the job was requeued.
+var ErrTaxBatchLeaseLost = errors.New("tax batch lease lost")
+
+type TaxBatchPort interface {
+	Create(batch *TaxBatch) (int64, error)
+	// FindByToken loads the job state without its file and result
+	FindByToken(token string) (*TaxBatch, error)
+	FindResultById(id int64) (json.RawMessage, error)
+	// FindRowsById loads the calculated rows of a job in file order
+	FindRowsById(id int64) ([]json.RawMessage, error)
+	// ClaimNext marks the oldest queued job as running by claimedBy for the
+	// length of the lease and returns it with its file, nil when no job is
+	// queued
+	ClaimNext(claimedBy string, lease time.Duration) (*TaxBatch, error)
+	// RenewLease extends the lease of a running job. It, SaveRows,
+	// UpdateProgress, Complete and Fail return ErrTaxBatchLeaseLost when the job is no longer
+	// held by claimedBy
+	RenewLease(id int64, claimedBy string, lease time.Duration) error
+	// SaveRows stores calculated rows numbered from firstRowNo, rows saved
+	// by an earlier run of the job are overwritten
+	SaveRows(id int64, claimedBy string, firstRowNo int, rows []json.RawMessage) error
+	UpdateProgress(id int64, claimedBy string, processedRows int, failedRows int) error
+	Complete(id int64, claimedBy string, processedRows int, failedRows int, result json.RawMessage) error
+	Fail(id int64, claimedBy string, processedRows int, failedRows int, message string) error
+	// Requeue puts a running job back in the queue, RequeueExpired does so
+	// for every job whose lease ran out, left behind by a stopped server
+	Requeue(id int64, claimedBy string) error
+	RequeueExpired() (int64, error)
+}
@@ -0,0 +1,330 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/meteedev/assessment-tax/constant"
+)
+
+type TaxBatchRepo struct {
+	Db *sql.DB
+}
+
+func NewTaxBatchRepo(db *sql.DB) TaxBatchPort {
+	return &TaxBatchRepo{Db: db}
+}
+
+func (t *TaxBatchRepo) Create(batch *TaxBatch) (int64, error) {
+
+	query := `
+				INSERT INTO tax_batch 
+					( token , status , tax_year , partial , content_type , file , total_rows , created_at ) 
+				VALUES 
+					( $1 , $2 , $3 , $4 , $5 , $6 , $7 , $8 ) 
+				RETURNING 
+					batch_id `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var batchId int64
+	err = stmt.QueryRow(
+		batch.Token,
+		batch.Status,
+		batch.TaxYear,
+		batch.Partial,
+		batch.ContentType,
+		batch.File,
+		batch.TotalRows,
+		batch.CreatedAt,
+	).Scan(&batchId)
+	if err != nil {
+		return 0, err
+	}
+
+	return batchId, nil
+}
+
+func (t *TaxBatchRepo) FindByToken(token string) (*TaxBatch, error) {
+
+	query := `
+				SELECT 
+					batch_id , token , status , tax_year , partial , content_type , total_rows , processed_rows , failed_rows , 
+					COALESCE(error, '') , created_at , started_at , finished_at 
+				FROM 
+					tax_batch 
+				WHERE 
+					token = $1 `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var batch TaxBatch
+	err = stmt.QueryRow(token).Scan(
+		&batch.BatchId,
+		&batch.Token,
+		&batch.Status,
+		&batch.TaxYear,
+		&batch.Partial,
+		&batch.ContentType,
+		&batch.TotalRows,
+		&batch.ProcessedRows,
+		&batch.FailedRows,
+		&batch.Error,
+		&batch.CreatedAt,
+		&batch.StartedAt,
+		&batch.FinishedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTaxBatchNotFound
+		}
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+func (t *TaxBatchRepo) FindResultById(id int64) (json.RawMessage, error) {
+
+	query := `
+				SELECT 
+					result 
+				FROM 
+					tax_batch 
+				WHERE 
+					batch_id = $1 AND result IS NOT NULL `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var result json.RawMessage
+	err = stmt.QueryRow(id).Scan(&result)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTaxBatchNotFound
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (t *TaxBatchRepo) FindRowsById(id int64) ([]json.RawMessage, error) {
+
+	query := `
+				SELECT 
+					result 
+				FROM 
+					tax_batch_row 
+				WHERE 
+					batch_id = $1 
+				ORDER BY 
+					row_no `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []json.RawMessage
+	for rows.Next() {
+		var result json.RawMessage
+		if err := rows.Scan(&result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// ClaimNext skips jobs locked by another server, so several servers can
+// share the queue.
+func (t *TaxBatchRepo) ClaimNext(claimedBy string, lease time.Duration) (*TaxBatch, error) {
+
+	query := `
+				UPDATE tax_batch 
+				SET 
+					status = $1 , started_at = NOW() , processed_rows = 0 , failed_rows = 0 , 
+					claimed_by = $2 , lease_expires_at = NOW() + $3 * INTERVAL '1 second' 
+				WHERE batch_id = (
+					SELECT batch_id 
+					FROM tax_batch 
+					WHERE status = $4 
+					ORDER BY batch_id 
+					LIMIT 1 
+					FOR UPDATE SKIP LOCKED 
+				) 
+				RETURNING 
+					batch_id , token , status , tax_year , partial , content_type , file , total_rows , created_at , started_at `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var batch TaxBatch
+	err = stmt.QueryRow(constant.TAX_BATCH_STATUS_RUNNING, claimedBy, lease.Seconds(), constant.TAX_BATCH_STATUS_QUEUED).Scan(
+		&batch.BatchId,
+		&batch.Token,
+		&batch.Status,
+		&batch.TaxYear,
+		&batch.Partial,
+		&batch.ContentType,
+		&batch.File,
+		&batch.TotalRows,
+		&batch.CreatedAt,
+		&batch.StartedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+func (t *TaxBatchRepo) RenewLease(id int64, claimedBy string, lease time.Duration) error {
+
+	query := `
+				UPDATE tax_batch 
+				SET 
+					lease_expires_at = NOW() + $1 * INTERVAL '1 second' 
+				WHERE 
+					batch_id = $2 AND status = $3 AND claimed_by = $4 `
+
+	return leaseResult(t.Db.Exec(query, lease.Seconds(), id, constant.TAX_BATCH_STATUS_RUNNING, claimedBy))
+}
+
+// SaveRows inserts the rows in one statement, only while the job is still
+// held by claimedBy.
+func (t *TaxBatchRepo) SaveRows(id int64, claimedBy string, firstRowNo int, rows []json.RawMessage) error {
+
+	query := `
+				INSERT INTO tax_batch_row 
+					( batch_id , row_no , result ) 
+				SELECT 
+					$1 , $2 + rows.ordinality - 1 , rows.result::jsonb 
+				FROM 
+					unnest( $3::text[] ) WITH ORDINALITY AS rows ( result , ordinality ) 
+				WHERE EXISTS (
+					SELECT 1 
+					FROM tax_batch 
+					WHERE batch_id = $1 AND status = $4 AND claimed_by = $5 
+				) 
+				ON CONFLICT ( batch_id , row_no ) DO UPDATE 
+				SET 
+					result = EXCLUDED.result `
+
+	results := make([]string, len(rows))
+	for i, row := range rows {
+		results[i] = string(row)
+	}
+
+	return leaseResult(t.Db.Exec(query, id, firstRowNo, pq.Array(results), constant.TAX_BATCH_STATUS_RUNNING, claimedBy))
+}
+
+func (t *TaxBatchRepo) UpdateProgress(id int64, claimedBy string, processedRows int, failedRows int) error {
+
+	query := `
+				UPDATE tax_batch 
+				SET 
+					processed_rows = $1 , failed_rows = $2 
+				WHERE 
+					batch_id = $3 AND status = $4 AND claimed_by = $5 `
+
+	return leaseResult(t.Db.Exec(query, processedRows, failedRows, id, constant.TAX_BATCH_STATUS_RUNNING, claimedBy))
+}
+
+func (t *TaxBatchRepo) Complete(id int64, claimedBy string, processedRows int, failedRows int, result json.RawMessage) error {
+
+	query := `
+				UPDATE tax_batch 
+				SET 
+					status = $1 , processed_rows = $2 , failed_rows = $3 , result = $4 , finished_at = NOW() , lease_expires_at = NULL 
+				WHERE 
+					batch_id = $5 AND status = $6 AND claimed_by = $7 `
+
+	return leaseResult(t.Db.Exec(query, constant.TAX_BATCH_STATUS_COMPLETED, processedRows, failedRows, []byte(result), id, constant.TAX_BATCH_STATUS_RUNNING, claimedBy))
+}
+
+func (t *TaxBatchRepo) Fail(id int64, claimedBy string, processedRows int, failedRows int, message string) error {
+
+	query := `
+				UPDATE tax_batch 
+				SET 
+					status = $1 , processed_rows = $2 , failed_rows = $3 , error = $4 , finished_at = NOW() , lease_expires_at = NULL 
+				WHERE 
+					batch_id = $5 AND status = $6 AND claimed_by = $7 `
+
+	return leaseResult(t.Db.Exec(query, constant.TAX_BATCH_STATUS_FAILED, processedRows, failedRows, message, id, constant.TAX_BATCH_STATUS_RUNNING, claimedBy))
+}
+
+func (t *TaxBatchRepo) Requeue(id int64, claimedBy string) error {
+
+	query := `
+				UPDATE tax_batch 
+				SET 
+					status = $1 , started_at = NULL , claimed_by = NULL , lease_expires_at = NULL 
+				WHERE 
+					batch_id = $2 AND status = $3 AND claimed_by = $4 `
+
+	_, err := t.Db.Exec(query, constant.TAX_BATCH_STATUS_QUEUED, id, constant.TAX_BATCH_STATUS_RUNNING, claimedBy)
+	return err
+}
+
+// RequeueExpired leaves jobs alone while the server running them keeps
+// renewing their lease.
+func (t *TaxBatchRepo) RequeueExpired() (int64, error) {
+
+	query := `
+				UPDATE tax_batch 
+				SET 
+					status = $1 , started_at = NULL , claimed_by = NULL , lease_expires_at = NULL 
+				WHERE 
+					status = $2 AND lease_expires_at < NOW() `
+
+	result, err := t.Db.Exec(query, constant.TAX_BATCH_STATUS_QUEUED, constant.TAX_BATCH_STATUS_RUNNING)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// leaseResult turns an update that matched no job into ErrTaxBatchLeaseLost.
+func leaseResult(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrTaxBatchLeaseLost
+	}
+	return nil
+}
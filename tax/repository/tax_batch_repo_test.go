@@ -0,0 +1,424 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTaxBatch() *TaxBatch {
+	return &TaxBatch{
+		Token:       "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b",
+		Status:      constant.TAX_BATCH_STATUS_QUEUED,
+		TaxYear:     2024,
+		Partial:     true,
+		ContentType: "text/csv",
+		File:        []byte("totalIncome,wht\n500000,0\n"),
+		TotalRows:   1,
+		CreatedAt:   time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestTaxBatchRepo_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+	batch := newTestTaxBatch()
+
+	mock.ExpectPrepare(`INSERT INTO tax_batch`).
+		ExpectQuery().
+		WithArgs(batch.Token, constant.TAX_BATCH_STATUS_QUEUED, 2024, true, "text/csv", batch.File, 1, batch.CreatedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"batch_id"}).AddRow(int64(7)))
+
+	batchId, err := repo.Create(batch)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), batchId)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_Create_Error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectPrepare(`INSERT INTO tax_batch`).
+		ExpectQuery().
+		WillReturnError(errors.New("insert failed"))
+
+	_, err = repo.Create(newTestTaxBatch())
+
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_FindByToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	startedAt := createdAt.Add(time.Second)
+
+	rows := sqlmock.NewRows([]string{"batch_id", "token", "status", "tax_year", "partial", "content_type", "total_rows", "processed_rows", "failed_rows", "error", "created_at", "started_at", "finished_at"}).
+		AddRow(int64(7), "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b", constant.TAX_BATCH_STATUS_RUNNING, 2024, false, "", 100, 40, 2, "", createdAt, startedAt, nil)
+
+	mock.ExpectPrepare(`SELECT batch_id .* FROM tax_batch\s*WHERE token = \$1`).
+		ExpectQuery().
+		WithArgs("3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b").
+		WillReturnRows(rows)
+
+	batch, err := repo.FindByToken("3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &TaxBatch{
+		BatchId:       7,
+		Token:         "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b",
+		Status:        constant.TAX_BATCH_STATUS_RUNNING,
+		TaxYear:       2024,
+		TotalRows:     100,
+		ProcessedRows: 40,
+		FailedRows:    2,
+		CreatedAt:     createdAt,
+		StartedAt:     &startedAt,
+	}, batch)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_FindByToken_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectPrepare(`SELECT batch_id .* FROM tax_batch`).
+		ExpectQuery().
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"batch_id"}))
+
+	batch, err := repo.FindByToken("unknown")
+
+	assert.Nil(t, batch)
+	assert.ErrorIs(t, err, ErrTaxBatchNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_FindResultById(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectPrepare(`SELECT result FROM tax_batch\s*WHERE batch_id = \$1 AND result IS NOT NULL`).
+		ExpectQuery().
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow([]byte(`{"taxes":[]}`)))
+
+	result, err := repo.FindResultById(7)
+
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`{"taxes":[]}`), result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_FindRowsById(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectPrepare(`SELECT result FROM tax_batch_row\s*WHERE batch_id = \$1\s*ORDER BY row_no`).
+		ExpectQuery().
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow([]byte(`{"tax":{}}`)).AddRow([]byte(`{"sheet":{}}`)))
+
+	rows, err := repo.FindRowsById(7)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`{"tax":{}}`), json.RawMessage(`{"sheet":{}}`)}, rows)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_ClaimNext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+	expected := newTestTaxBatch()
+	expected.BatchId = 7
+	expected.Status = constant.TAX_BATCH_STATUS_RUNNING
+	expected.Partial = false
+	startedAt := expected.CreatedAt.Add(time.Minute)
+	expected.StartedAt = &startedAt
+
+	rows := sqlmock.NewRows([]string{"batch_id", "token", "status", "tax_year", "partial", "content_type", "file", "total_rows", "created_at", "started_at"}).
+		AddRow(int64(7), "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b", constant.TAX_BATCH_STATUS_RUNNING, 2024, false, "text/csv", expected.File, 1, expected.CreatedAt, startedAt)
+
+	mock.ExpectPrepare(`UPDATE tax_batch .* claimed_by = \$2 , lease_expires_at = NOW\(\) \+ \$3 .* WHERE batch_id = \(.*FOR UPDATE SKIP LOCKED.*\)\s*RETURNING`).
+		ExpectQuery().
+		WithArgs(constant.TAX_BATCH_STATUS_RUNNING, "server-1", float64(60), constant.TAX_BATCH_STATUS_QUEUED).
+		WillReturnRows(rows)
+
+	batch, err := repo.ClaimNext("server-1", time.Minute)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, batch)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_ClaimNext_Empty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectPrepare(`UPDATE tax_batch`).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"batch_id"}))
+
+	batch, err := repo.ClaimNext("server-1", time.Minute)
+
+	assert.NoError(t, err)
+	assert.Nil(t, batch)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_RenewLease(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`UPDATE tax_batch SET lease_expires_at = NOW\(\) \+ \$1 .* WHERE batch_id = \$2 AND status = \$3 AND claimed_by = \$4`).
+		WithArgs(float64(60), int64(7), constant.TAX_BATCH_STATUS_RUNNING, "server-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.RenewLease(7, "server-1", time.Minute)
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_RenewLease_Lost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	// the lease ran out and the job was requeued or claimed by another server
+	mock.ExpectExec(`UPDATE tax_batch SET lease_expires_at`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.RenewLease(7, "server-1", time.Minute)
+
+	assert.ErrorIs(t, err, ErrTaxBatchLeaseLost)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_SaveRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`INSERT INTO tax_batch_row .* unnest\( \$3::text\[\] \) .* claimed_by = \$5 .* ON CONFLICT \( batch_id , row_no \) DO UPDATE`).
+		WithArgs(int64(7), 101, pq.Array([]string{`{"tax":{}}`, `{"sheet":{}}`}), constant.TAX_BATCH_STATUS_RUNNING, "server-1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err = repo.SaveRows(7, "server-1", 101, []json.RawMessage{json.RawMessage(`{"tax":{}}`), json.RawMessage(`{"sheet":{}}`)})
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_SaveRows_LeaseLost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`INSERT INTO tax_batch_row`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.SaveRows(7, "server-1", 1, []json.RawMessage{json.RawMessage(`{}`)})
+
+	assert.ErrorIs(t, err, ErrTaxBatchLeaseLost)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_UpdateProgress(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`UPDATE tax_batch SET processed_rows = \$1 , failed_rows = \$2 WHERE batch_id = \$3 AND status = \$4 AND claimed_by = \$5`).
+		WithArgs(100, 3, int64(7), constant.TAX_BATCH_STATUS_RUNNING, "server-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.UpdateProgress(7, "server-1", 100, 3)
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_Complete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+	result := json.RawMessage(`{"taxes":[]}`)
+
+	mock.ExpectExec(`UPDATE tax_batch SET status = \$1 .* result = \$4 .* WHERE batch_id = \$5 AND status = \$6 AND claimed_by = \$7`).
+		WithArgs(constant.TAX_BATCH_STATUS_COMPLETED, 10, 1, []byte(result), int64(7), constant.TAX_BATCH_STATUS_RUNNING, "server-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.Complete(7, "server-1", 10, 1, result)
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_Complete_LeaseLost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`UPDATE tax_batch SET status = \$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.Complete(7, "server-1", 10, 1, json.RawMessage(`{}`))
+
+	assert.ErrorIs(t, err, ErrTaxBatchLeaseLost)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_Fail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`UPDATE tax_batch SET status = \$1 .* error = \$4 .* WHERE batch_id = \$5 AND status = \$6 AND claimed_by = \$7`).
+		WithArgs(constant.TAX_BATCH_STATUS_FAILED, 2, 1, "line 3, wht: invalid", int64(7), constant.TAX_BATCH_STATUS_RUNNING, "server-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.Fail(7, "server-1", 2, 1, "line 3, wht: invalid")
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_Requeue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`UPDATE tax_batch SET status = \$1 , started_at = NULL , claimed_by = NULL , lease_expires_at = NULL WHERE batch_id = \$2 AND status = \$3 AND claimed_by = \$4`).
+		WithArgs(constant.TAX_BATCH_STATUS_QUEUED, int64(7), constant.TAX_BATCH_STATUS_RUNNING, "server-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repo.Requeue(7, "server-1")
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBatchRepo_RequeueExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBatchRepo(db)
+
+	mock.ExpectExec(`UPDATE tax_batch SET status = \$1 .* WHERE status = \$2 AND lease_expires_at < NOW\(\)`).
+		WithArgs(constant.TAX_BATCH_STATUS_QUEUED, constant.TAX_BATCH_STATUS_RUNNING).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	requeued, err := repo.RequeueExpired()
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), requeued)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,16 @@
+package repository
+
+import "github.com/meteedev/assessment-tax/money"
+
+type TaxBracket struct {
+	TaxYear    int     `json:"tax_year"`
+	Level      string  `json:"level"`
+	LowerBound money.Money `json:"lower_bound"`
+	UpperBound money.Money `json:"upper_bound"` // 0 means the bracket has no upper limit
+	TaxRate    float64 `json:"tax_rate"`
+}
+
+type TaxBracketPort interface {
+	FindByTaxYear(taxYear int) ([]TaxBracket, error)
+	FindLatestTaxYear() (int, error)
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type TaxBracketRepo struct {
+	Db *sql.DB
+}
+
+func NewTaxBracketRepo(db *sql.DB) TaxBracketPort {
+	return &TaxBracketRepo{Db: db}
+}
+
+func (t *TaxBracketRepo) FindByTaxYear(taxYear int) ([]TaxBracket, error) {
+
+	query := `
+				SELECT 
+					tax_year , level , lower_bound , upper_bound , tax_rate 
+				FROM 
+					tax_bracket 
+				WHERE 
+					tax_year = $1 
+				ORDER BY 
+					lower_bound `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(taxYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var brackets []TaxBracket
+	for rows.Next() {
+		var tb TaxBracket
+
+		// the highest bracket is stored with a NULL upper bound, which scans to 0
+		err = rows.Scan(&tb.TaxYear, &tb.Level, &tb.LowerBound, &tb.UpperBound, &tb.TaxRate)
+		if err != nil {
+			return nil, err
+		}
+
+		brackets = append(brackets, tb)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return brackets, nil
+}
+
+func (t *TaxBracketRepo) FindLatestTaxYear() (int, error) {
+
+	query := `
+				SELECT 
+					MAX(tax_year) 
+				FROM 
+					tax_bracket `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var taxYear sql.NullInt64
+	err = stmt.QueryRow().Scan(&taxYear)
+	if err != nil {
+		return 0, err
+	}
+
+	// MAX over an empty table yields NULL
+	if !taxYear.Valid {
+		return 0, errors.New("tax bracket not found for any tax year")
+	}
+
+	return int(taxYear.Int64), nil
+}
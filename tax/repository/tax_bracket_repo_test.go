@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaxBracketRepo_FindByTaxYear(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBracketRepo(db)
+
+	rows := sqlmock.NewRows([]string{"tax_year", "level", "lower_bound", "upper_bound", "tax_rate"}).
+		AddRow(2024, "0-150,000", []byte("0.00"), []byte("150000.00"), 0.0).
+		AddRow(2024, "2,000,001 ขึ้นไป", []byte("2000000.00"), nil, 0.35)
+
+	mock.ExpectPrepare(`SELECT tax_year\s*,\s*level\s*,\s*lower_bound\s*,\s*upper_bound\s*,\s*tax_rate\s*FROM tax_bracket\s*WHERE tax_year = \$1\s*ORDER BY lower_bound`).
+		ExpectQuery().
+		WithArgs(2024).
+		WillReturnRows(rows)
+
+	brackets, err := repo.FindByTaxYear(2024)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxBracket{
+		{TaxYear: 2024, Level: "0-150,000", LowerBound: 0, UpperBound: money.FromBaht(150000), TaxRate: 0},
+		{TaxYear: 2024, Level: "2,000,001 ขึ้นไป", LowerBound: money.FromBaht(2000000), UpperBound: 0, TaxRate: 0.35},
+	}, brackets)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBracketRepo_FindByTaxYear_QueryError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBracketRepo(db)
+
+	mock.ExpectPrepare(`SELECT tax_year\s*,\s*level\s*,\s*lower_bound\s*,\s*upper_bound\s*,\s*tax_rate\s*FROM tax_bracket\s*WHERE tax_year = \$1\s*ORDER BY lower_bound`).
+		ExpectQuery().
+		WithArgs(2024).
+		WillReturnError(errors.New("connection refused"))
+
+	brackets, err := repo.FindByTaxYear(2024)
+
+	assert.Error(t, err)
+	assert.Nil(t, brackets)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBracketRepo_FindLatestTaxYear(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBracketRepo(db)
+
+	mock.ExpectPrepare(`SELECT MAX\(tax_year\)\s*FROM tax_bracket`).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(2024))
+
+	taxYear, err := repo.FindLatestTaxYear()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2024, taxYear)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxBracketRepo_FindLatestTaxYear_Empty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxBracketRepo(db)
+
+	mock.ExpectPrepare(`SELECT MAX\(tax_year\)\s*FROM tax_bracket`).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+
+	_, err = repo.FindLatestTaxYear()
+
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
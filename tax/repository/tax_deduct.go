@@ -1,12 +1,74 @@
 package repository
 
+import (
+    "errors"
+    "time"
+
+    "github.com/meteedev/assessment-tax/money"
+)
+
 type TaxDeductConfig struct {
     DeductId  string  `json:"deduct_type"`
-    Amount      float64 `json:"amount"`
+    TaxYear     int     `json:"tax_year"`
+    Amount      money.Money `json:"amount"`
+    MinAmount   money.Money `json:"min_amount"`
+    MaxAmount   money.Money `json:"max_amount"`
+    CapRule     string  `json:"cap_rule"`
+    Rate        float64 `json:"rate"`
+    Multiplier  float64 `json:"multiplier"`
     Description string  `json:"description"`
 }
 
+// TaxDeductConfigHistory is one change of a deduction amount, OldAmount is
+// nil for the change that created the deduction.
+type TaxDeductConfigHistory struct {
+    HistoryId     int64        `json:"history_id"`
+    DeductId      string       `json:"deduct_id"`
+    TaxYear       int          `json:"tax_year"`
+    OldAmount     *money.Money `json:"old_amount"`
+    NewAmount     money.Money  `json:"new_amount"`
+    ChangedBy     string       `json:"changed_by"`
+    EffectiveFrom time.Time    `json:"effective_from"`
+    CreatedAt     time.Time    `json:"created_at"`
+}
+
+// TaxDependentRule is the allowance for one dependent of DependentType. A rule
+// only applies to the dependents ranked MinRank or later among their type,
+// oldest first, born in BornFromYear or later and within the first MaxCount
+// dependents. Nil bounds do not limit.
+type TaxDependentRule struct {
+    RuleId        int64       `json:"rule_id"`
+    DependentType string      `json:"dependent_type"`
+    TaxYear       int         `json:"tax_year"`
+    Amount        money.Money `json:"amount"`
+    MinRank       int         `json:"min_rank"`
+    BornFromYear  *int        `json:"born_from_year"`
+    MaxCount      *int        `json:"max_count"`
+    Description   string      `json:"description"`
+}
+
+// TaxExpenseRule is the expense deducted from the income of one category,
+// Rate of the income up to MaxAmount. The categories sharing a CapGroup share
+// the lowest MaxAmount of the group, a nil MaxAmount does not limit.
+type TaxExpenseRule struct {
+    Category    string       `json:"category"`
+    TaxYear     int          `json:"tax_year"`
+    Rate        float64      `json:"rate"`
+    MaxAmount   *money.Money `json:"max_amount"`
+    CapGroup    string       `json:"cap_group"`
+    Description string       `json:"description"`
+}
+
+var ErrTaxDeductConfigNotFound = errors.New("deduct config not found")
+var ErrTaxDeductConfigExists = errors.New("deduct config already exists")
+
 type TaxDeductConfigPort interface {
-	FindById(id string) (*TaxDeductConfig,error)
-    UpdateById(id string,amount float64) (int64,error)
+	FindById(id string,taxYear int,asOf time.Time) (*TaxDeductConfig,error)
+	FindByTaxYear(taxYear int,asOf time.Time) ([]TaxDeductConfig,error)
+	Create(config *TaxDeductConfig,changedBy string) error
+    UpdateById(id string,taxYear int,amount money.Money,changedBy string,effectiveFrom time.Time) (int64,error)
+    ScheduleById(id string,taxYear int,amount money.Money,changedBy string,effectiveFrom time.Time) (int64,error)
+    FindHistoryById(id string,taxYear int) ([]TaxDeductConfigHistory,error)
+    FindDependentRules(taxYear int) ([]TaxDependentRule,error)
+    FindExpenseRules(taxYear int) ([]TaxExpenseRule,error)
 }
\ No newline at end of file
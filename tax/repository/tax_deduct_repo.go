@@ -3,6 +3,9 @@ package repository
 import (
 	"database/sql"
 	"fmt"
+	"time"
+
+	"github.com/meteedev/assessment-tax/money"
 )
 
 type TaxDeductConfigRepo struct {
@@ -16,50 +19,109 @@ func NewTaxDeductConfigRepo(db *sql.DB) TaxDeductConfigPort {
 
 
 
-func (t *TaxDeductConfigRepo) UpdateById(id string , amount float64) (int64,error){
-	
+// effectiveAmountColumn selects the amount of tax_deduct_config c in effect at
+// $1: the latest change in tax_deduct_config_history effective by then, or the
+// stored amount when there is none.
+const effectiveAmountColumn = ` COALESCE( ( 
+					SELECT 
+						h.new_amount 
+					FROM 
+						tax_deduct_config_history h 
+					WHERE 
+						h.deduct_id = c.deduct_id AND h.tax_year = c.tax_year AND h.effective_from <= $1 
+					ORDER BY 
+						h.effective_from DESC , h.history_id DESC 
+					LIMIT 1 
+				) , c.amount ) `
+
+// UpdateById changes the amount right away and appends the change to
+// tax_deduct_config_history in the same transaction.
+func (t *TaxDeductConfigRepo) UpdateById(id string , taxYear int , amount money.Money , changedBy string , effectiveFrom time.Time) (int64,error){
+	return t.changeAmount(id, taxYear, amount, changedBy, effectiveFrom, true)
+}
+
+// ScheduleById only appends the change to tax_deduct_config_history, the
+// amount is picked up once effectiveFrom has passed.
+func (t *TaxDeductConfigRepo) ScheduleById(id string , taxYear int , amount money.Money , changedBy string , effectiveFrom time.Time) (int64,error){
+	return t.changeAmount(id, taxYear, amount, changedBy, effectiveFrom, false)
+}
+
+func (t *TaxDeductConfigRepo) changeAmount(id string, taxYear int, amount money.Money, changedBy string, effectiveFrom time.Time, updateStored bool) (int64, error) {
+
+	tx, err := t.Db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the old amount is the one in effect until this change
+	selectQuery := `
+				SELECT 
+					` + effectiveAmountColumn + ` 
+				FROM 
+					tax_deduct_config c 
+				WHERE 
+					c.deduct_id = $2 AND c.tax_year = $3 
+				FOR UPDATE OF c `
+
+	var oldAmount money.Money
+	err = tx.QueryRow(selectQuery, effectiveFrom, id, taxYear).Scan(&oldAmount)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
 
-	query := ` UPDATE  
+	if updateStored {
+		updateQuery := ` UPDATE  
 					tax_deduct_config
 				
 				SET
 					amount = $1
 					
 				WHERE 
-					deduct_id = $2 `
+					deduct_id = $2 AND tax_year = $3 `
 
-	
-	stmt , err :=  t.Db.Prepare(query)
+		_, err = tx.Exec(updateQuery, amount, id, taxYear)
+		if err != nil {
+			return 0, err
+		}
+	}
 
-	if err !=nil {
+	err = insertHistory(tx, id, taxYear, &oldAmount, amount, changedBy, effectiveFrom)
+	if err != nil {
 		return 0, err
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(amount,id)
-	
-	if err != nil {
-        return 0, err
-    }
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
 
-    // Get the number of rows affected
-    numRows, err := res.RowsAffected()
-    if err != nil {
-        return 0, err
-    }
+func insertHistory(tx *sql.Tx, id string, taxYear int, oldAmount *money.Money, newAmount money.Money, changedBy string, effectiveFrom time.Time) error {
 
-    return numRows, nil
+	query := ` INSERT INTO 
+					tax_deduct_config_history ( deduct_id , tax_year , old_amount , new_amount , changed_by , effective_from ) 
+				VALUES 
+					( $1 , $2 , $3 , $4 , $5 , $6 ) `
+
+	_, err := tx.Exec(query, id, taxYear, oldAmount, newAmount, changedBy, effectiveFrom)
+	return err
 }
 
-func (t *TaxDeductConfigRepo) FindById(id string) (*TaxDeductConfig,error){
+// FindById returns the deduction config with the amount in effect at asOf.
+func (t *TaxDeductConfigRepo) FindById(id string , taxYear int , asOf time.Time) (*TaxDeductConfig,error){
 
 	query := `
 				SELECT 
-					deduct_id , amount , description 
+					c.deduct_id , c.tax_year , ` + effectiveAmountColumn + ` , c.min_amount , c.max_amount , c.cap_rule , c.rate , c.multiplier , c.description 
 				FROM 
-					tax_deduct_config 
+					tax_deduct_config c 
 				WHERE 
-					deduct_id = $1 `
+					c.deduct_id = $2 AND c.tax_year = $3 `
 
 	stmt , err :=  t.Db.Prepare(query)
 
@@ -69,16 +131,16 @@ func (t *TaxDeductConfigRepo) FindById(id string) (*TaxDeductConfig,error){
 	defer stmt.Close()
 
 	// Execute the query using the QueryRow method of the DB object
-	row := stmt.QueryRow(id)
+	row := stmt.QueryRow(asOf,id,taxYear)
 
 	var  tdc TaxDeductConfig
 
 	// Scan the values returned by the query into the fields of the wallet struct
-	err = row.Scan(&tdc.DeductId, &tdc.Amount, &tdc.Description)
+	err = row.Scan(&tdc.DeductId, &tdc.TaxYear, &tdc.Amount, &tdc.MinAmount, &tdc.MaxAmount, &tdc.CapRule, &tdc.Rate, &tdc.Multiplier, &tdc.Description)
 	if err != nil {
 		// If no rows are returned, check for sql.ErrNoRows error
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("deduct config not found for ID: %s", id)
+			return nil, fmt.Errorf("%w for ID: %s tax year: %d", ErrTaxDeductConfigNotFound, id, taxYear)
 		}
 		// Otherwise, return any other error
 		return nil, err
@@ -89,5 +151,208 @@ func (t *TaxDeductConfigRepo) FindById(id string) (*TaxDeductConfig,error){
 
 }
 
+// FindByTaxYear returns the deduction configs of a tax year with the amounts
+// in effect at asOf.
+func (t *TaxDeductConfigRepo) FindByTaxYear(taxYear int , asOf time.Time) ([]TaxDeductConfig,error){
+
+	query := `
+				SELECT 
+					c.deduct_id , c.tax_year , ` + effectiveAmountColumn + ` , c.min_amount , c.max_amount , c.cap_rule , c.rate , c.multiplier , c.description 
+				FROM 
+					tax_deduct_config c 
+				WHERE 
+					c.tax_year = $2 
+				ORDER BY 
+					c.deduct_id `
+
+	stmt , err :=  t.Db.Prepare(query)
+	if err !=nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(asOf, taxYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []TaxDeductConfig
+	for rows.Next() {
+		var tdc TaxDeductConfig
+		err = rows.Scan(&tdc.DeductId, &tdc.TaxYear, &tdc.Amount, &tdc.MinAmount, &tdc.MaxAmount, &tdc.CapRule, &tdc.Rate, &tdc.Multiplier, &tdc.Description)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, tdc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return configs, nil
+}
+
+func (t *TaxDeductConfigRepo) Create(config *TaxDeductConfig, changedBy string) error {
+
+	tx, err := t.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := ` INSERT INTO 
+					tax_deduct_config ( deduct_id , tax_year , amount , min_amount , max_amount , cap_rule , rate , multiplier , description ) 
+				VALUES 
+					( $1 , $2 , $3 , $4 , $5 , $6 , $7 , $8 , $9 ) 
+				ON CONFLICT DO NOTHING `
+
+	res, err := tx.Exec(query, config.DeductId, config.TaxYear, config.Amount, config.MinAmount, config.MaxAmount, config.CapRule, config.Rate, config.Multiplier, config.Description)
+	if err != nil {
+		return err
+	}
+
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// the primary key (deduct_id, tax_year) is already taken
+	if numRows == 0 {
+		return ErrTaxDeductConfigExists
+	}
+
+	err = insertHistory(tx, config.DeductId, config.TaxYear, nil, config.Amount, changedBy, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (t *TaxDeductConfigRepo) FindHistoryById(id string, taxYear int) ([]TaxDeductConfigHistory, error) {
+
+	query := `
+				SELECT 
+					history_id , deduct_id , tax_year , old_amount , new_amount , changed_by , effective_from , created_at 
+				FROM 
+					tax_deduct_config_history 
+				WHERE 
+					deduct_id = $1 AND tax_year = $2 
+				ORDER BY 
+					effective_from , history_id `
+
+	stmt , err :=  t.Db.Prepare(query)
+	if err !=nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(id, taxYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []TaxDeductConfigHistory
+	for rows.Next() {
+		var h TaxDeductConfigHistory
+		err = rows.Scan(&h.HistoryId, &h.DeductId, &h.TaxYear, &h.OldAmount, &h.NewAmount, &h.ChangedBy, &h.EffectiveFrom, &h.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// FindDependentRules returns the dependent allowance rules of a tax year.
+func (t *TaxDeductConfigRepo) FindDependentRules(taxYear int) ([]TaxDependentRule, error) {
+
+	query := `
+				SELECT 
+					rule_id , dependent_type , tax_year , amount , min_rank , born_from_year , max_count , description 
+				FROM 
+					tax_dependent_rule 
+				WHERE 
+					tax_year = $1 
+				ORDER BY 
+					dependent_type , rule_id `
 
+	stmt , err :=  t.Db.Prepare(query)
+	if err !=nil {
+		return nil, err
+	}
+	defer stmt.Close()
 
+	rows, err := stmt.Query(taxYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []TaxDependentRule
+	for rows.Next() {
+		var r TaxDependentRule
+		err = rows.Scan(&r.RuleId, &r.DependentType, &r.TaxYear, &r.Amount, &r.MinRank, &r.BornFromYear, &r.MaxCount, &r.Description)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// FindExpenseRules returns the expense rules of the income categories of a
+// tax year.
+func (t *TaxDeductConfigRepo) FindExpenseRules(taxYear int) ([]TaxExpenseRule, error) {
+
+	query := `
+				SELECT 
+					category , tax_year , rate , max_amount , COALESCE( cap_group , '' ) , description 
+				FROM 
+					tax_expense_rule 
+				WHERE 
+					tax_year = $1 
+				ORDER BY 
+					category `
+
+	stmt , err :=  t.Db.Prepare(query)
+	if err !=nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(taxYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []TaxExpenseRule
+	for rows.Next() {
+		var r TaxExpenseRule
+		err = rows.Scan(&r.Category, &r.TaxYear, &r.Rate, &r.MaxAmount, &r.CapGroup, &r.Description)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
@@ -3,7 +3,10 @@ package repository
 import (
 	"fmt"
 	"testing"
+	"time"
+
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/meteedev/assessment-tax/money"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,14 +20,77 @@ func TestTaxDeductConfigRepo_UpdateById(t *testing.T) {
 	repo := NewTaxDeductConfigRepo(db)
 
 	expectedID := "1"
-	expectedAmount := 100.0
+	expectedAmount := money.FromBaht(100)
+	oldAmount := money.FromBaht(50)
+	effectiveFrom := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
 
-	mock.ExpectPrepare(`UPDATE tax_deduct_config SET amount = \$1 WHERE deduct_id = \$2`).
-		ExpectExec().
-		WithArgs(expectedAmount, expectedID).
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COALESCE\(.*FROM tax_deduct_config_history h.*FROM tax_deduct_config c\s*WHERE c.deduct_id = \$2 AND c.tax_year = \$3\s*FOR UPDATE OF c`).
+		WithArgs(effectiveFrom, expectedID, 2024).
+		WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow([]byte("50.00")))
+	mock.ExpectExec(`UPDATE tax_deduct_config SET amount = \$1 WHERE deduct_id = \$2 AND tax_year = \$3`).
+		WithArgs(expectedAmount, expectedID, 2024).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO tax_deduct_config_history`).
+		WithArgs(expectedID, 2024, &oldAmount, expectedAmount, "admin", effectiveFrom).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	numRows, err := repo.UpdateById(expectedID, expectedAmount)
+	numRows, err := repo.UpdateById(expectedID, 2024, expectedAmount, "admin", effectiveFrom)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), numRows)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxDeductConfigRepo_UpdateById_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COALESCE`).
+		WithArgs(sqlmock.AnyArg(), "unknown", 2024).
+		WillReturnRows(sqlmock.NewRows([]string{"amount"}))
+	mock.ExpectRollback()
+
+	numRows, err := repo.UpdateById("unknown", 2024, money.FromBaht(100), "admin", time.Now())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), numRows)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxDeductConfigRepo_ScheduleById(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	amount := money.FromBaht(70000)
+	oldAmount := money.FromBaht(50000)
+	effectiveFrom := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// only the history is written, the stored amount stays until effectiveFrom
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COALESCE\(.*FOR UPDATE OF c`).
+		WithArgs(effectiveFrom, "k-receipt", 2024).
+		WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow([]byte("50000.00")))
+	mock.ExpectExec(`INSERT INTO tax_deduct_config_history`).
+		WithArgs("k-receipt", 2024, &oldAmount, amount, "admin", effectiveFrom).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	numRows, err := repo.ScheduleById("k-receipt", 2024, amount, "admin", effectiveFrom)
 
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), numRows)
@@ -33,6 +99,7 @@ func TestTaxDeductConfigRepo_UpdateById(t *testing.T) {
 }
 
 func TestTaxDeductConfigRepo_FindById(t *testing.T) {
+	asOf := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
@@ -43,17 +110,21 @@ func TestTaxDeductConfigRepo_FindById(t *testing.T) {
 
 	expectedID := "1"
 
-	rows := sqlmock.NewRows([]string{"deduct_id", "amount", "description"}).
-		AddRow(expectedID, 100.0, "Description")
+	rows := sqlmock.NewRows([]string{"deduct_id", "tax_year", "amount", "min_amount", "max_amount", "cap_rule", "rate", "multiplier", "description"}).
+		AddRow(expectedID, 2024, []byte("100.00"), []byte("1.00"), []byte("1000.00"), "max", 0.0, 1.0, "Description")
 
-	mock.ExpectPrepare(`SELECT deduct_id\s*,\s*amount\s*,\s*description\s*FROM tax_deduct_config\s*WHERE deduct_id = \$1`).
+	mock.ExpectPrepare(`SELECT c.deduct_id\s*,\s*c.tax_year\s*,\s*COALESCE\(.*h.effective_from <= \$1.*\)\s*,\s*c.min_amount\s*,\s*c.max_amount\s*,\s*c.cap_rule\s*,\s*c.rate\s*,\s*c.multiplier\s*,\s*c.description\s*FROM tax_deduct_config c\s*WHERE c.deduct_id = \$2 AND c.tax_year = \$3`).
 		ExpectQuery().
-		WithArgs(expectedID).
+		WithArgs(asOf, expectedID, 2024).
 		WillReturnRows(rows)
 
-	_, err = repo.FindById(expectedID)
+	tdc, err := repo.FindById(expectedID, 2024, asOf)
 
 	assert.NoError(t, err)
+	assert.Equal(t, money.FromBaht(100), tdc.Amount)
+	assert.Equal(t, money.FromBaht(1), tdc.MinAmount)
+	assert.Equal(t, money.FromBaht(1000), tdc.MaxAmount)
+	assert.Equal(t, "max", tdc.CapRule)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -70,20 +141,191 @@ func TestTaxDeductConfigRepo_FindById_NotFound(t *testing.T) {
     expectedID := "1"
 
     // Expecting the prepare query
-    rows := sqlmock.NewRows([]string{"deduct_id", "amount", "description"})
-    mock.ExpectPrepare(`SELECT deduct_id\s*,\s*amount\s*,\s*description\s*FROM tax_deduct_config\s*WHERE deduct_id = \$1`).
+    rows := sqlmock.NewRows([]string{"deduct_id", "tax_year", "amount", "min_amount", "max_amount", "cap_rule", "rate", "multiplier", "description"})
+    mock.ExpectPrepare(`SELECT c.deduct_id\s*,\s*c.tax_year\s*,\s*COALESCE\(.*h.effective_from <= \$1.*\)\s*,\s*c.min_amount\s*,\s*c.max_amount\s*,\s*c.cap_rule\s*,\s*c.rate\s*,\s*c.multiplier\s*,\s*c.description\s*FROM tax_deduct_config c\s*WHERE c.deduct_id = \$2 AND c.tax_year = \$3`).
         ExpectQuery().
-        WithArgs(expectedID).
+        WithArgs(sqlmock.AnyArg(), expectedID, 2024).
         WillReturnRows(rows)
 
     // Call the method under test
-    _, err = repo.FindById(expectedID)
+    _, err = repo.FindById(expectedID, 2024, time.Now())
 
     // Assert the error message
-    expectedErrorMsg := fmt.Sprintf("deduct config not found for ID: %s", expectedID)
+    assert.ErrorIs(t, err, ErrTaxDeductConfigNotFound)
+    expectedErrorMsg := fmt.Sprintf("deduct config not found for ID: %s tax year: %d", expectedID, 2024)
     if err.Error() != expectedErrorMsg {
         t.Errorf("Expected error message '%s', got '%s'", expectedErrorMsg, err.Error())
     }
 
     assert.NoError(t, mock.ExpectationsWereMet())
-}
\ No newline at end of file
+}
+
+func TestTaxDeductConfigRepo_FindByTaxYear(t *testing.T) {
+	asOf := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	rows := sqlmock.NewRows([]string{"deduct_id", "tax_year", "amount", "min_amount", "max_amount", "cap_rule", "rate", "multiplier", "description"}).
+		AddRow("k-receipt", 2024, []byte("50000.00"), []byte("1.00"), []byte("100000.00"), "max", 0.0, 1.0, "k-receipt allowance").
+		AddRow("personal", 2024, []byte("60000.00"), []byte("10000.00"), []byte("100000.00"), "fixed", 0.0, 1.0, "Personal allowance")
+
+	mock.ExpectPrepare(`SELECT c.deduct_id\s*,\s*c.tax_year\s*,\s*COALESCE\(.*\)\s*,\s*c.min_amount\s*,\s*c.max_amount\s*,\s*c.cap_rule\s*,\s*c.rate\s*,\s*c.multiplier\s*,\s*c.description\s*FROM tax_deduct_config c\s*WHERE c.tax_year = \$2\s*ORDER BY c.deduct_id`).
+		ExpectQuery().
+		WithArgs(asOf, 2024).
+		WillReturnRows(rows)
+
+	configs, err := repo.FindByTaxYear(2024, asOf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxDeductConfig{
+		{DeductId: "k-receipt", TaxYear: 2024, Amount: money.FromBaht(50000), MinAmount: money.FromBaht(1), MaxAmount: money.FromBaht(100000), CapRule: "max", Multiplier: 1, Description: "k-receipt allowance"},
+		{DeductId: "personal", TaxYear: 2024, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000), CapRule: "fixed", Multiplier: 1, Description: "Personal allowance"},
+	}, configs)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxDeductConfigRepo_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	config := &TaxDeductConfig{DeductId: "life-insurance", TaxYear: 2024, Amount: money.FromBaht(100000), MinAmount: 0, MaxAmount: money.FromBaht(100000), CapRule: "max", Multiplier: 1, Description: "Life insurance premium"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO tax_deduct_config \(`).
+		WithArgs("life-insurance", 2024, config.Amount, config.MinAmount, config.MaxAmount, "max", 0.0, 1.0, "Life insurance premium").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO tax_deduct_config_history`).
+		WithArgs("life-insurance", 2024, nil, config.Amount, "admin", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = repo.Create(config, "admin")
+
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxDeductConfigRepo_Create_Exists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO tax_deduct_config \(`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repo.Create(&TaxDeductConfig{DeductId: "personal", TaxYear: 2024}, "admin")
+
+	assert.ErrorIs(t, err, ErrTaxDeductConfigExists)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxDeductConfigRepo_FindHistoryById(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	changed := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"history_id", "deduct_id", "tax_year", "old_amount", "new_amount", "changed_by", "effective_from", "created_at"}).
+		AddRow(1, "k-receipt", 2024, nil, []byte("50000.00"), "init", created, created).
+		AddRow(7, "k-receipt", 2024, []byte("50000.00"), []byte("70000.00"), "admin", changed, changed)
+
+	mock.ExpectPrepare(`SELECT history_id\s*,\s*deduct_id\s*,\s*tax_year\s*,\s*old_amount\s*,\s*new_amount\s*,\s*changed_by\s*,\s*effective_from\s*,\s*created_at\s*FROM tax_deduct_config_history\s*WHERE deduct_id = \$1 AND tax_year = \$2\s*ORDER BY effective_from , history_id`).
+		ExpectQuery().
+		WithArgs("k-receipt", 2024).
+		WillReturnRows(rows)
+
+	history, err := repo.FindHistoryById("k-receipt", 2024)
+
+	assert.NoError(t, err)
+	oldAmount := money.FromBaht(50000)
+	assert.Equal(t, []TaxDeductConfigHistory{
+		{HistoryId: 1, DeductId: "k-receipt", TaxYear: 2024, OldAmount: nil, NewAmount: money.FromBaht(50000), ChangedBy: "init", EffectiveFrom: created, CreatedAt: created},
+		{HistoryId: 7, DeductId: "k-receipt", TaxYear: 2024, OldAmount: &oldAmount, NewAmount: money.FromBaht(70000), ChangedBy: "admin", EffectiveFrom: changed, CreatedAt: changed},
+	}, history)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxDeductConfigRepo_FindDependentRules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	rows := sqlmock.NewRows([]string{"rule_id", "dependent_type", "tax_year", "amount", "min_rank", "born_from_year", "max_count", "description"}).
+		AddRow(1, "child", 2024, []byte("30000.00"), 1, nil, nil, "Child allowance").
+		AddRow(3, "parent", 2024, []byte("30000.00"), 1, nil, 4, "Parental care allowance")
+
+	mock.ExpectPrepare(`SELECT rule_id , dependent_type , tax_year , amount , min_rank , born_from_year , max_count , description\s*FROM tax_dependent_rule\s*WHERE tax_year = \$1\s*ORDER BY dependent_type , rule_id`).
+		ExpectQuery().
+		WithArgs(2024).
+		WillReturnRows(rows)
+
+	rules, err := repo.FindDependentRules(2024)
+
+	maxCount := 4
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxDependentRule{
+		{RuleId: 1, DependentType: "child", TaxYear: 2024, Amount: money.FromBaht(30000), MinRank: 1, Description: "Child allowance"},
+		{RuleId: 3, DependentType: "parent", TaxYear: 2024, Amount: money.FromBaht(30000), MinRank: 1, MaxCount: &maxCount, Description: "Parental care allowance"},
+	}, rules)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxDeductConfigRepo_FindExpenseRules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxDeductConfigRepo(db)
+
+	rows := sqlmock.NewRows([]string{"category", "tax_year", "rate", "max_amount", "cap_group", "description"}).
+		AddRow("40(1)", 2024, 0.5, []byte("100000.00"), "40(1)-40(2)", "Salary and wages").
+		AddRow("40(8)", 2024, 0.6, nil, "", "Business and commerce")
+
+	mock.ExpectPrepare(`SELECT category , tax_year , rate , max_amount , COALESCE\( cap_group , '' \) , description\s*FROM tax_expense_rule\s*WHERE tax_year = \$1\s*ORDER BY category`).
+		ExpectQuery().
+		WithArgs(2024).
+		WillReturnRows(rows)
+
+	rules, err := repo.FindExpenseRules(2024)
+
+	maxAmount := money.FromBaht(100000)
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxExpenseRule{
+		{Category: "40(1)", TaxYear: 2024, Rate: 0.5, MaxAmount: &maxAmount, CapGroup: "40(1)-40(2)", Description: "Salary and wages"},
+		{Category: "40(8)", TaxYear: 2024, Rate: 0.6, Description: "Business and commerce"},
+	}, rules)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
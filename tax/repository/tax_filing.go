@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/meteedev/assessment-tax/money"
+)
+
+// TaxFiling is the audit record of one tax calculation. The request,
+// response, tax steps and deduction config are kept as the JSON that was
+// produced at calculation time.
+type TaxFiling struct {
+	FilingId     int64           `json:"filing_id"`
+	TaxYear      int             `json:"tax_year"`
+	TotalIncome  money.Money     `json:"total_income"`
+	Tax          money.Money     `json:"tax"`
+	TaxRefund    money.Money     `json:"tax_refund"`
+	Request      json.RawMessage `json:"request"`
+	Response     json.RawMessage `json:"response"`
+	TaxSteps     json.RawMessage `json:"tax_steps"`
+	DeductConfig json.RawMessage `json:"deduct_config"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+var ErrTaxFilingNotFound = errors.New("tax filing not found")
+
+// TaxFilingFilter narrows a filing search, nil fields are not filtered on.
+// Results are ordered newest first and Cursor is the filing id to continue
+// after.
+type TaxFilingFilter struct {
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time // exclusive
+	MinIncome   *money.Money
+	MaxIncome   *money.Money
+	Outcome     string
+	Cursor      int64
+	Limit       int
+}
+
+type TaxFilingPort interface {
+	Create(filing *TaxFiling) (int64, error)
+	FindById(id int64) (*TaxFiling, error)
+	FindAll(filter TaxFilingFilter) ([]TaxFiling, error)
+}
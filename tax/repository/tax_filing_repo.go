@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/meteedev/assessment-tax/constant"
+)
+
+type TaxFilingRepo struct {
+	Db *sql.DB
+}
+
+func NewTaxFilingRepo(db *sql.DB) TaxFilingPort {
+	return &TaxFilingRepo{Db: db}
+}
+
+func (t *TaxFilingRepo) Create(filing *TaxFiling) (int64, error) {
+
+	query := `
+				INSERT INTO tax_filing 
+					( tax_year , total_income , tax , tax_refund , request , response , tax_steps , deduct_config , created_at ) 
+				VALUES 
+					( $1 , $2 , $3 , $4 , $5 , $6 , $7 , $8 , $9 ) 
+				RETURNING 
+					filing_id `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var filingId int64
+	err = stmt.QueryRow(
+		filing.TaxYear,
+		filing.TotalIncome,
+		filing.Tax,
+		filing.TaxRefund,
+		[]byte(filing.Request),
+		[]byte(filing.Response),
+		[]byte(filing.TaxSteps),
+		[]byte(filing.DeductConfig),
+		filing.CreatedAt,
+	).Scan(&filingId)
+	if err != nil {
+		return 0, err
+	}
+
+	return filingId, nil
+}
+
+func (t *TaxFilingRepo) FindById(id int64) (*TaxFiling, error) {
+
+	query := `
+				SELECT 
+					filing_id , tax_year , total_income , tax , tax_refund , request , response , tax_steps , deduct_config , created_at 
+				FROM 
+					tax_filing 
+				WHERE 
+					filing_id = $1 `
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var filing TaxFiling
+	err = stmt.QueryRow(id).Scan(
+		&filing.FilingId,
+		&filing.TaxYear,
+		&filing.TotalIncome,
+		&filing.Tax,
+		&filing.TaxRefund,
+		&filing.Request,
+		&filing.Response,
+		&filing.TaxSteps,
+		&filing.DeductConfig,
+		&filing.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTaxFilingNotFound
+		}
+		return nil, err
+	}
+
+	return &filing, nil
+}
+
+// FindAll lists filing summaries, the JSON columns are left empty.
+func (t *TaxFilingRepo) FindAll(filter TaxFilingFilter) ([]TaxFiling, error) {
+
+	conditions, args := filingConditions(filter)
+
+	query := `
+				SELECT 
+					filing_id , tax_year , total_income , tax , tax_refund , created_at 
+				FROM 
+					tax_filing `
+
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY filing_id DESC LIMIT $%d `, len(args))
+
+	stmt, err := t.Db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var filings []TaxFiling
+	for rows.Next() {
+		var filing TaxFiling
+		err = rows.Scan(&filing.FilingId, &filing.TaxYear, &filing.TotalIncome, &filing.Tax, &filing.TaxRefund, &filing.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		filings = append(filings, filing)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return filings, nil
+}
+
+func filingConditions(filter TaxFilingFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Cursor > 0 {
+		add("filing_id < $%d", filter.Cursor)
+	}
+	if filter.CreatedFrom != nil {
+		add("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		add("created_at < $%d", *filter.CreatedTo)
+	}
+	if filter.MinIncome != nil {
+		add("total_income >= $%d", *filter.MinIncome)
+	}
+	if filter.MaxIncome != nil {
+		add("total_income <= $%d", *filter.MaxIncome)
+	}
+
+	switch filter.Outcome {
+	case constant.TAX_FILING_OUTCOME_PAYABLE:
+		conditions = append(conditions, "tax_refund = 0")
+	case constant.TAX_FILING_OUTCOME_REFUND:
+		conditions = append(conditions, "tax_refund > 0")
+	}
+
+	return conditions, args
+}
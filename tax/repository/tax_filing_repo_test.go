@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTaxFiling() *TaxFiling {
+	return &TaxFiling{
+		TaxYear:      2024,
+		TotalIncome:  money.FromBaht(500000),
+		Tax:          money.FromBaht(29000),
+		TaxRefund:    0,
+		Request:      []byte(`{"totalIncome":500000.00}`),
+		Response:     []byte(`{"tax":29000.00}`),
+		TaxSteps:     []byte(`[]`),
+		DeductConfig: []byte(`{"personalAllowance":60000.00}`),
+		CreatedAt:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestTaxFilingRepo_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxFilingRepo(db)
+	filing := newTestTaxFiling()
+
+	mock.ExpectPrepare(`INSERT INTO tax_filing`).
+		ExpectQuery().
+		WithArgs(2024, filing.TotalIncome, filing.Tax, filing.TaxRefund, []byte(filing.Request), []byte(filing.Response), []byte(filing.TaxSteps), []byte(filing.DeductConfig), filing.CreatedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"filing_id"}).AddRow(int64(42)))
+
+	filingId, err := repo.Create(filing)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), filingId)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxFilingRepo_Create_Error(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxFilingRepo(db)
+
+	mock.ExpectPrepare(`INSERT INTO tax_filing`).
+		ExpectQuery().
+		WillReturnError(errors.New("insert failed"))
+
+	_, err = repo.Create(newTestTaxFiling())
+
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxFilingRepo_FindById(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxFilingRepo(db)
+	expected := newTestTaxFiling()
+	expected.FilingId = 42
+
+	rows := sqlmock.NewRows([]string{"filing_id", "tax_year", "total_income", "tax", "tax_refund", "request", "response", "tax_steps", "deduct_config", "created_at"}).
+		AddRow(int64(42), 2024, []byte("500000.00"), []byte("29000.00"), []byte("0.00"), []byte(expected.Request), []byte(expected.Response), []byte(expected.TaxSteps), []byte(expected.DeductConfig), expected.CreatedAt)
+
+	mock.ExpectPrepare(`SELECT filing_id .* FROM tax_filing\s*WHERE filing_id = \$1`).
+		ExpectQuery().
+		WithArgs(int64(42)).
+		WillReturnRows(rows)
+
+	filing, err := repo.FindById(42)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, filing)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxFilingRepo_FindById_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxFilingRepo(db)
+
+	mock.ExpectPrepare(`SELECT filing_id .* FROM tax_filing\s*WHERE filing_id = \$1`).
+		ExpectQuery().
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"filing_id"}))
+
+	filing, err := repo.FindById(7)
+
+	assert.Nil(t, filing)
+	assert.ErrorIs(t, err, ErrTaxFilingNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxFilingRepo_FindAll(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxFilingRepo(db)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	minIncome := money.FromBaht(100000)
+	filter := TaxFilingFilter{
+		CreatedFrom: &from,
+		MinIncome:   &minIncome,
+		Outcome:     constant.TAX_FILING_OUTCOME_REFUND,
+		Cursor:      50,
+		Limit:       2,
+	}
+
+	rows := sqlmock.NewRows([]string{"filing_id", "tax_year", "total_income", "tax", "tax_refund", "created_at"}).
+		AddRow(int64(49), 2024, []byte("150000.00"), []byte("0.00"), []byte("1000.00"), from).
+		AddRow(int64(47), 2024, []byte("200000.00"), []byte("0.00"), []byte("500.00"), from)
+
+	mock.ExpectPrepare(`SELECT filing_id , tax_year , total_income , tax , tax_refund , created_at\s*FROM tax_filing\s*WHERE filing_id < \$1 AND created_at >= \$2 AND total_income >= \$3 AND tax_refund > 0 ORDER BY filing_id DESC LIMIT \$4`).
+		ExpectQuery().
+		WithArgs(int64(50), from, minIncome, 2).
+		WillReturnRows(rows)
+
+	filings, err := repo.FindAll(filter)
+
+	assert.NoError(t, err)
+	assert.Len(t, filings, 2)
+	assert.Equal(t, int64(49), filings[0].FilingId)
+	assert.Equal(t, money.FromBaht(1000), filings[0].TaxRefund)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxFilingRepo_FindAll_NoFilter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewTaxFilingRepo(db)
+
+	mock.ExpectPrepare(`SELECT filing_id , tax_year , total_income , tax , tax_refund , created_at\s*FROM tax_filing\s*ORDER BY filing_id DESC LIMIT \$1`).
+		ExpectQuery().
+		WithArgs(20).
+		WillReturnRows(sqlmock.NewRows([]string{"filing_id", "tax_year", "total_income", "tax", "tax_refund", "created_at"}))
+
+	filings, err := repo.FindAll(TaxFilingFilter{Limit: 20})
+
+	assert.NoError(t, err)
+	assert.Empty(t, filings)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,67 +1,456 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"time"
+
+	"github.com/meteedev/assessment-tax/money"
 )
 
 type TaxServicePort interface{
 	CalculationTax(*TaxRequest)(*TaxResponse,error)
-	UploadCalculationTax(file io.Reader)(*TaxUploadResponse,error)
+	GrossUp(*GrossUpRequest)(*GrossUpResponse,error)
+	CompareTax(*TaxCompareRequest)(*TaxCompareResponse,error)
+	UploadCalculationTax(file io.Reader,options *TaxUploadOptions)(*TaxUploadResponse,error)
+	StreamCalculationTax(ctx context.Context,file io.Reader,options *TaxUploadOptions,emit func(*TaxUploadResult) error) error
 	UpdatePersonalAllowance(*UpdateDeductRequest)(*UpdateDeductResponse,error)
 	UpdateKreceiptAllowance(*UpdateDeductRequest)(*UpdateDeductResponse,error)
+	GetDeductions(taxYear int)(*DeductionListResponse,error)
+	GetDeduction(deductType string,taxYear int)(*DeductionResponse,error)
+	CreateDeduction(*CreateDeductRequest)(*DeductionResponse,error)
+	UpdateDeduction(deductType string,updateReq *UpdateDeductRequest)(*UpdateDeductResponse,error)
+	GetAllowanceTypes(taxYear int)(*AllowanceTypeListResponse,error)
+	GetDeductionHistory(deductType string,taxYear int)(*DeductionHistoryResponse,error)
+	PreviewDeduction(deductType string,previewReq *DeductPreviewRequest)(*DeductPreviewResponse,error)
+	UploadPreviewDeduction(deductType string,file io.Reader,previewReq *DeductPreviewRequest)(*DeductPreviewResponse,error)
+	GetTaxFilings(*TaxFilingQuery)(*TaxFilingListResponse,error)
+	GetTaxFiling(id int64)(*TaxFilingResponse,error)
+	CreateTaxBatch(file io.Reader,options *TaxUploadOptions)(*TaxBatchResponse,error)
+	GetTaxBatch(token string)(*TaxBatchResponse,error)
+	GetTaxBatchResult(token string)(*TaxUploadResponse,error)
+	RunTaxBatches(ctx context.Context)
 }
 
 type TaxRequest struct {
-	TotalIncome float64     `json:"totalIncome"`
-	WHT         float64     `json:"wht"`
+	TaxYear      int           `json:"taxYear"`
+	TotalIncome  money.Money   `json:"totalIncome"`
+	WHT          money.Money   `json:"wht"`
+	Allowances   []Allowance   `json:"allowances"`
+	Incomes      []Income      `json:"incomes,omitempty"`
+	Dependents   []Dependent   `json:"dependents,omitempty"`
+	FilingStatus string        `json:"filingStatus,omitempty"`
+	Spouse       *SpouseIncome `json:"spouse,omitempty"`
+}
+
+// SpouseIncome is the income of the spouse of a joint or separate filing, a
+// spouse without income has a TotalIncome of 0. Incomes by category get their
+// expenses deducted as those of the taxpayer.
+type SpouseIncome struct {
+	TotalIncome money.Money `json:"totalIncome"`
+	WHT         money.Money `json:"wht"`
 	Allowances  []Allowance `json:"allowances"`
+	Incomes     []Income    `json:"incomes,omitempty"`
+}
+
+// GrossUpRequest asks for the total income that leaves NetIncome after tax.
+type GrossUpRequest struct {
+	TaxYear    int         `json:"taxYear"`
+	NetIncome  money.Money `json:"netIncome"`
+	Allowances []Allowance `json:"allowances"`
+}
+
+// GrossUpResponse is the tax of the solved total income, NetIncome is what
+// is left of it after tax.
+type GrossUpResponse struct {
+	NetIncome   money.Money `json:"netIncome"`
+	TotalIncome money.Money `json:"totalIncome"`
+	TaxResponse
 }
 
 type Allowance struct {
-	AllowanceType string  `json:"allowanceType"`
-	Amount        float64 `json:"amount"`
+	AllowanceType string      `json:"allowanceType"`
+	Amount        money.Money `json:"amount"`
 }
 
+// Income is the income of one category of section 40, e.g. "40(1)" for
+// salary. The incomes of a request add up to its TotalIncome.
+type Income struct {
+	Category string      `json:"category"`
+	Amount   money.Money `json:"amount"`
+}
+
+// Dependent is a dependent the taxpayer claims an allowance for, BirthYear is
+// only needed for dependent types with rules by birth year.
+type Dependent struct {
+	DependentType string `json:"dependentType"`
+	BirthYear     int    `json:"birthYear,omitempty"`
+}
 
 type TaxResponse struct {
-	Tax 		float64 	`json:"tax"`
-	TaxRefund	float64		`json:"taxRefund"`
+	FilingId	int64		`json:"filingId,omitempty"`
+	TaxYear		int			`json:"taxYear"`
+	Tax 		money.Money	`json:"tax"`
+	TaxRefund	money.Money	`json:"taxRefund"`
 	TaxStep 	[]TaxStep 	`json:"taxLevel"`
+	Explanation	*TaxExplanation	`json:"explanation,omitempty"`
+	Rates		*TaxRates	`json:"rates,omitempty"`
+	FilingStatus	string		`json:"filingStatus,omitempty"`
+	Spouse		*TaxResponse	`json:"spouse,omitempty"`
+	FilingOptions	[]FilingOption	`json:"filingOptions,omitempty"`
+	RecommendedFilingStatus	string	`json:"recommendedFilingStatus,omitempty"`
+}
+
+// FilingOption is the tax of a couple under one filing status, summed over
+// the returns filed.
+type FilingOption struct {
+	FilingStatus string      `json:"filingStatus"`
+	Tax          money.Money `json:"tax"`
+	TaxRefund    money.Money `json:"taxRefund"`
+}
+
+// TaxRates are read off the tax brackets. EffectiveRate is the tax before
+// WHT over the total income, MarginalRate the rate of the bracket the taxable
+// income ends in and IncomeToNextBracket the income left before the next
+// bracket starts, nil in the top bracket.
+type TaxRates struct {
+	EffectiveRate       float64      `json:"effectiveRate"`
+	MarginalRate        float64      `json:"marginalRate"`
+	MarginalLevel       string       `json:"marginalLevel"`
+	IncomeToNextBracket *money.Money `json:"incomeToNextBracket"`
+}
+
+// TaxExplanation shows how the tax was worked out, step by step: the expenses
+// of the incomes by category and the allowances deducted from the total income
+// give the taxable income, the brackets give the gross tax and the WHT already
+// paid is credited against it. GrossIncomeTax is only set when the
+// gross-income method applies, TaxMethod is the method GrossTax comes from.
+// The spouse fields are only set on a return claiming the spouse allowance,
+// the spouse's incomes and allowances only on a joint return.
+type TaxExplanation struct {
+	TotalIncome       money.Money            `json:"totalIncome"`
+	Incomes           []IncomeExplanation    `json:"incomes,omitempty"`
+	SpouseIncomes     []IncomeExplanation    `json:"spouseIncomes,omitempty"`
+	PersonalAllowance money.Money            `json:"personalAllowance"`
+	SpouseAllowance   money.Money            `json:"spouseAllowance,omitempty"`
+	Allowances        []AllowanceExplanation `json:"allowances"`
+	SpouseAllowances  []AllowanceExplanation `json:"spouseAllowances,omitempty"`
+	Dependents        []DependentExplanation `json:"dependents,omitempty"`
+	TaxableIncome     money.Money            `json:"taxableIncome"`
+	GrossTax          money.Money            `json:"grossTax"`
+	TaxMethod         string                 `json:"taxMethod"`
+	GrossIncomeTax    *money.Money           `json:"grossIncomeTax,omitempty"`
+	WHT               money.Money            `json:"wht"`
+}
+
+// AllowanceExplanation is an allowance as claimed and as accepted after the
+// cap of its allowance type.
+type AllowanceExplanation struct {
+	AllowanceType string      `json:"allowanceType"`
+	Claimed       money.Money `json:"claimed"`
+	Accepted      money.Money `json:"accepted"`
+}
+
+// IncomeExplanation is the income of a category less the expense deducted
+// for it.
+type IncomeExplanation struct {
+	Category string      `json:"category"`
+	Amount   money.Money `json:"amount"`
+	Expense  money.Money `json:"expense"`
+	Net      money.Money `json:"net"`
+}
+
+// DependentExplanation is the allowance accepted for a dependent, Rank is its
+// place among the dependents of its type, oldest first.
+type DependentExplanation struct {
+	DependentType string      `json:"dependentType"`
+	BirthYear     int         `json:"birthYear,omitempty"`
+	Rank          int         `json:"rank"`
+	Accepted      money.Money `json:"accepted"`
 }
 
 
 type TaxBracket struct {
 	Level 		string		`json:"level"`	
-	LowerBound 	float64 	`json:"-"`
-	UpperBound 	float64 	`json:"-"`
+	LowerBound 	money.Money	`json:"-"`
+	UpperBound 	money.Money	`json:"-"`
 	TaxRate    	float64 	`json:"-"`
-	Tax 		float64 	`json:"tax"`
+	Tax 		money.Money	`json:"tax"`
 }
 
 type TaxStep struct {
 	Level     string	`json:"level"`
-	TaxAmount float64  	`json:"tax"`
+	TaxAmount money.Money	`json:"tax"`
 }
 
 
 type UpdateDeductRequest struct {
-	Amount 		float64		`json:"amount"`	
+	TaxYear		int			`json:"taxYear"`
+	Amount 		money.Money	`json:"amount"`	
+	EffectiveFrom	*time.Time	`json:"effectiveFrom"`
+	UpdatedBy	string		`json:"-"`
 }
 
 type UpdateDeductResponse struct {
-	Amount 		float64		`json:"amount"`	
+	Amount 		money.Money	`json:"amount"`	
+	EffectiveFrom	*time.Time	`json:"effectiveFrom,omitempty"`
+}
+
+type CreateDeductRequest struct {
+	DeductType  string      `json:"deductType"`
+	TaxYear     int         `json:"taxYear"`
+	Amount      money.Money `json:"amount"`
+	MinAmount   money.Money `json:"minAmount"`
+	MaxAmount   money.Money `json:"maxAmount"`
+	CapRule     string      `json:"capRule"`
+	Rate        float64     `json:"rate"`
+	Multiplier  float64     `json:"multiplier"`
+	Description string      `json:"description"`
+	CreatedBy   string      `json:"-"`
+}
+
+type DeductionResponse struct {
+	DeductType  string      `json:"deductType"`
+	TaxYear     int         `json:"taxYear"`
+	Amount      money.Money `json:"amount"`
+	MinAmount   money.Money `json:"minAmount"`
+	MaxAmount   money.Money `json:"maxAmount"`
+	CapRule     string      `json:"capRule"`
+	Rate        float64     `json:"rate,omitempty"`
+	Multiplier  float64     `json:"multiplier,omitempty"`
+	Description string      `json:"description"`
+}
+
+type DeductionListResponse struct {
+	Deductions []DeductionResponse `json:"deductions"`
+}
+
+type DeductionChange struct {
+	OldAmount     *money.Money `json:"oldAmount"`
+	NewAmount     money.Money  `json:"newAmount"`
+	ChangedBy     string       `json:"changedBy"`
+	EffectiveFrom time.Time    `json:"effectiveFrom"`
+	ChangedAt     time.Time    `json:"changedAt"`
+}
+
+type DeductionHistoryResponse struct {
+	DeductType string            `json:"deductType"`
+	TaxYear    int               `json:"taxYear"`
+	History    []DeductionChange `json:"history"`
+}
+
+type AllowanceTypeListResponse struct {
+	TaxYear        int             `json:"taxYear"`
+	AllowanceTypes []AllowanceRule `json:"allowanceTypes"`
+}
+
+type DeductPreviewRequest struct {
+	TaxYear int          `json:"taxYear"`
+	Amount  money.Money  `json:"amount"`
+	Incomes []TaxRequest `json:"incomes"`
+}
+
+type DeductPreviewResult struct {
+	Income TaxRequest  `json:"income"`
+	Before TaxResponse `json:"before"`
+	After  TaxResponse `json:"after"`
+}
+
+// DeductPreviewSummary sums up the sample, revenue is tax collected minus
+// tax refunded.
+type DeductPreviewSummary struct {
+	Count           int         `json:"count"`
+	TaxBefore       money.Money `json:"taxBefore"`
+	TaxAfter        money.Money `json:"taxAfter"`
+	TaxDelta        money.Money `json:"taxDelta"`
+	TaxRefundBefore money.Money `json:"taxRefundBefore"`
+	TaxRefundAfter  money.Money `json:"taxRefundAfter"`
+	TaxRefundDelta  money.Money `json:"taxRefundDelta"`
+	RevenueDelta    money.Money `json:"revenueDelta"`
+}
+
+type DeductPreviewResponse struct {
+	DeductType     string                `json:"deductType"`
+	TaxYear        int                   `json:"taxYear"`
+	CurrentAmount  money.Money           `json:"currentAmount"`
+	ProposedAmount money.Money           `json:"proposedAmount"`
+	Results        []DeductPreviewResult `json:"results"`
+	Summary        DeductPreviewSummary  `json:"summary"`
+}
+
+
+// TaxCompareRequest is a base income with named what-if scenarios on top of
+// it, all calculated with the tax rule of the base's tax year.
+type TaxCompareRequest struct {
+	Base      TaxRequest    `json:"base"`
+	Scenarios []TaxScenario `json:"scenarios"`
+}
+
+// TaxScenario changes the base income: TotalIncome and WHT replace the base
+// values when set, Allowances are claimed on top of the base allowances.
+type TaxScenario struct {
+	Name        string       `json:"name"`
+	TotalIncome *money.Money `json:"totalIncome"`
+	WHT         *money.Money `json:"wht"`
+	Allowances  []Allowance  `json:"allowances"`
+}
+
+type TaxCompareResponse struct {
+	Base         TaxCompareResult   `json:"base"`
+	Scenarios    []TaxCompareResult `json:"scenarios"`
+	BestScenario string             `json:"bestScenario,omitempty"`
+}
+
+// TaxCompareResult is the request a scenario resolves to and its result,
+// Delta is against the base and left out for the base itself.
+type TaxCompareResult struct {
+	Name    string           `json:"name,omitempty"`
+	Request TaxRequest       `json:"request"`
+	Result  *TaxResponse     `json:"result"`
+	Delta   *TaxCompareDelta `json:"delta,omitempty"`
+}
+
+// TaxCompareDelta is a scenario minus the base. Saving is how much less the
+// scenario pays, counting a refund as a negative payment.
+type TaxCompareDelta struct {
+	TotalIncome money.Money `json:"totalIncome"`
+	Tax         money.Money `json:"tax"`
+	TaxRefund   money.Money `json:"taxRefund"`
+	Saving      money.Money `json:"saving"`
 }
 
 
 type TaxUpload struct {
-    TotalIncome float64 `json:"totalIncome"`
-    Tax         float64 `json:"tax"`
-	TaxRefund	float64 `json:"taxRefund"`
+    Id          string      `json:"id,omitempty"`
+    TotalIncome money.Money `json:"totalIncome"`
+    Tax         money.Money `json:"tax"`
+	TaxRefund	money.Money `json:"taxRefund"`
 }
 
 type TaxUploadResponse struct {
     Taxes []TaxUpload `json:"taxes"`
+    Errors []TaxUploadError `json:"errors,omitempty"`
+    IgnoredColumns []string `json:"ignoredColumns,omitempty"`
+    Sheet *TaxUploadSheet `json:"-"`
+}
+
+// TaxUploadResult is a line of a streamed upload, a row has either its tax
+// or its errors.
+type TaxUploadResult struct {
+	Line int    `json:"line"`
+	Id   string `json:"id,omitempty"`
+	*TaxUpload
+	Errors []TaxUploadError `json:"errors,omitempty"`
+}
+
+// TaxUploadSheet holds the uploaded rows as they were in the file together
+// with their results, for downloading the results as a spreadsheet. Levels
+// are the tax bracket levels of the tax year.
+type TaxUploadSheet struct {
+	Header []string
+	Levels []string
+	Rows   []TaxUploadSheetRow
+}
+
+// TaxUploadSheetRow is an uploaded row, TaxResponse is nil when the row is
+// invalid.
+type TaxUploadSheetRow struct {
+	Record      []string
+	TaxResponse *TaxResponse
+	Errors      []TaxUploadError
+}
+
+type TaxUploadOptions struct {
+	TaxYear     int
+	Partial     bool   // calculate the valid rows and report the invalid ones
+	ContentType string // as sent with the file, the format is sniffed when empty
+}
+
+// TaxUploadFile is a parsed upload file, Header is the header row as it was
+// in the file. IgnoredColumns are the header names
+// that are neither known columns nor allowance types.
+type TaxUploadFile struct {
+	Header         []string
+	Rows           []TaxUploadRow
+	IgnoredColumns []string
 }
 
+// TaxUploadRow is a parsed row of an upload file, Line is the line number in
+// the file.
+type TaxUploadRow struct {
+	Line       int
+	Id         string
+	Record     []string
+	TaxRequest TaxRequest
+	Errors     []TaxUploadError
+}
+
+// TaxUploadError is a problem with one column of an upload row, Column is
+// empty when the row as a whole is invalid.
+type TaxUploadError struct {
+	Line   int    `json:"line"`
+	Column string `json:"column,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e TaxUploadError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+	}
+	return fmt.Sprintf("line %d, %s: %s", e.Line, e.Column, e.Reason)
+}
 
 
+type TaxFilingQuery struct {
+	From      *time.Time
+	To        *time.Time // exclusive
+	MinIncome *money.Money
+	MaxIncome *money.Money
+	Outcome   string
+	Cursor    int64
+	Limit     int
+}
+
+type TaxFilingSummary struct {
+	FilingId    int64       `json:"filingId"`
+	TaxYear     int         `json:"taxYear"`
+	TotalIncome money.Money `json:"totalIncome"`
+	Tax         money.Money `json:"tax"`
+	TaxRefund   money.Money `json:"taxRefund"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+type TaxFilingListResponse struct {
+	Filings    []TaxFilingSummary `json:"filings"`
+	NextCursor int64              `json:"nextCursor,omitempty"`
+}
+
+type TaxFilingResponse struct {
+	FilingId     int64           `json:"filingId"`
+	TaxYear      int             `json:"taxYear"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	Request      json.RawMessage `json:"request"`
+	Response     json.RawMessage `json:"response"`
+	TaxSteps     json.RawMessage `json:"taxLevel"`
+	DeductConfig json.RawMessage `json:"deductConfig"`
+}
+
+// TaxBatchResponse is the state of an upload calculated in the background,
+// Token is the id it is polled by and Progress is the percentage of the rows
+// processed.
+type TaxBatchResponse struct {
+	Token         string     `json:"token"`
+	Status        string     `json:"status"`
+	TaxYear       int        `json:"taxYear"`
+	Mode          string     `json:"mode"`
+	TotalRows     int        `json:"totalRows"`
+	ProcessedRows int        `json:"processedRows"`
+	FailedRows    int        `json:"failedRows"`
+	Progress      int        `json:"progress"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+}
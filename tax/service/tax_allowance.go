@@ -0,0 +1,260 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+)
+
+// allowanceCalculator works out how much of the amount claimed for one
+// allowance type is deductible.
+type allowanceCalculator interface {
+	Validate(claimed money.Money) error
+	Deduct(claimed money.Money) money.Money
+}
+
+// capRuleCalculators maps the cap_rule of tax_deduct_config to the calculator
+// applying it. Deduction types with any other cap rule can not be claimed.
+var capRuleCalculators = map[string]func(rule AllowanceRule) allowanceCalculator{
+	constant.DEDUCT_CAP_RULE_FIXED: func(rule AllowanceRule) allowanceCalculator {
+		return fixedCalculator{allowanceType: rule.AllowanceType, amount: rule.Amount}
+	},
+	constant.DEDUCT_CAP_RULE_MAX: func(rule AllowanceRule) allowanceCalculator {
+		return maxCapCalculator{allowanceType: rule.AllowanceType, limit: rule.Amount}
+	},
+	constant.DEDUCT_CAP_RULE_PERCENT_OF_NET: func(rule AllowanceRule) allowanceCalculator {
+		return percentOfNetCalculator{allowanceType: rule.AllowanceType, rate: rule.Rate, multiplier: rule.multiplier(), limit: rule.Amount}
+	},
+}
+
+// netIncomeCapper is an allowanceCalculator whose cap depends on the net
+// income, the income left after all other deductions.
+type netIncomeCapper interface {
+	CapToNetIncome(deductible, netIncome money.Money) money.Money
+}
+
+// fixedCalculator deducts its amount whatever is claimed, Explain adds it to
+// every return.
+type fixedCalculator struct {
+	allowanceType string
+	amount        money.Money
+}
+
+func (c fixedCalculator) Validate(claimed money.Money) error {
+	if claimed < 0 {
+		return fmt.Errorf("%s allowance must not be less than 0", c.allowanceType)
+	}
+	return nil
+}
+
+func (c fixedCalculator) Deduct(claimed money.Money) money.Money {
+	return c.amount
+}
+
+// maxCapCalculator deducts the claimed amount up to a fixed limit.
+type maxCapCalculator struct {
+	allowanceType string
+	limit         money.Money
+}
+
+func (c maxCapCalculator) Validate(claimed money.Money) error {
+	if claimed < 0 {
+		return fmt.Errorf("%s allowance must not be less than 0", c.allowanceType)
+	}
+	return nil
+}
+
+func (c maxCapCalculator) Deduct(claimed money.Money) money.Money {
+	return claimed.Min(c.limit)
+}
+
+// percentOfNetCalculator counts the claimed amount multiplier times, up to a
+// fixed limit when the limit is above 0, and caps it at rate of the net income.
+type percentOfNetCalculator struct {
+	allowanceType string
+	rate          float64
+	multiplier    float64
+	limit         money.Money
+}
+
+func (c percentOfNetCalculator) Validate(claimed money.Money) error {
+	if claimed < 0 {
+		return fmt.Errorf("%s allowance must not be less than 0", c.allowanceType)
+	}
+	return nil
+}
+
+func (c percentOfNetCalculator) Deduct(claimed money.Money) money.Money {
+	deductible := claimed.MulRate(c.multiplier)
+	if c.limit > 0 {
+		deductible = deductible.Min(c.limit)
+	}
+	return deductible
+}
+
+// CapToNetIncome applies the fixed limit again as the deductible may sum the
+// claims of both spouses.
+func (c percentOfNetCalculator) CapToNetIncome(deductible, netIncome money.Money) money.Money {
+	if c.limit > 0 {
+		deductible = deductible.Min(c.limit)
+	}
+	return deductible.Min(netIncome.Max(0).MulRate(c.rate))
+}
+
+// AllowanceRule is a claimable allowance type as configured for a tax year.
+type AllowanceRule struct {
+	AllowanceType string      `json:"allowanceType"`
+	CapRule       string      `json:"capRule"`
+	Amount        money.Money `json:"amount"`
+	Rate          float64     `json:"rate,omitempty"`
+	Multiplier    float64     `json:"multiplier,omitempty"`
+	Description   string      `json:"description"`
+}
+
+func (r AllowanceRule) calculator() allowanceCalculator {
+	return capRuleCalculators[r.CapRule](r)
+}
+
+// multiplier defaults to 1 for configs without one.
+func (r AllowanceRule) multiplier() float64 {
+	if r.Multiplier == 0 {
+		return 1
+	}
+	return r.Multiplier
+}
+
+// AllowanceRegistry holds the allowance types that can be claimed in a tax
+// year, keyed by allowance type. The personal and spouse allowances are
+// deducted on their own and are not part of it.
+type AllowanceRegistry map[string]AllowanceRule
+
+func newAllowanceRegistry(configs []repository.TaxDeductConfig) AllowanceRegistry {
+	registry := AllowanceRegistry{}
+	for _, config := range configs {
+		if config.DeductId == constant.DEDUCT_PERSONAL_ID || config.DeductId == constant.DEDUCT_SPOUSE_ID {
+			continue
+		}
+		if _, ok := capRuleCalculators[config.CapRule]; !ok {
+			continue
+		}
+		registry[config.DeductId] = AllowanceRule{
+			AllowanceType: config.DeductId,
+			CapRule:       config.CapRule,
+			Amount:        config.Amount,
+			Rate:          config.Rate,
+			Multiplier:    config.Multiplier,
+			Description:   config.Description,
+		}
+	}
+	return registry
+}
+
+// Types returns the supported allowance types in alphabetical order.
+func (r AllowanceRegistry) Types() []string {
+	types := make([]string, 0, len(r))
+	for allowanceType := range r {
+		types = append(types, allowanceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (r AllowanceRegistry) Validate(allowances []Allowance) error {
+	var errMsgs []string
+
+	for _, allowance := range allowances {
+		rule, ok := r[allowance.AllowanceType]
+		if !ok {
+			errMsgs = append(errMsgs, fmt.Sprintf("allowanceType %q is not supported, must be one of: %s", allowance.AllowanceType, strings.Join(r.Types(), ", ")))
+			continue
+		}
+
+		if err := rule.calculator().Validate(allowance.Amount); err != nil {
+			errMsgs = append(errMsgs, err.Error())
+		}
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
+
+// Explain lists per claimed allowance type the claimed amount and the amount
+// accepted after its cap rule, in alphabetical order of allowance type. The
+// fixed allowance types are listed whether claimed or not. Caps on the net
+// income are left to deductFromNetIncome.
+func (r AllowanceRegistry) Explain(allowances []Allowance) []AllowanceExplanation {
+	claimed := map[string]money.Money{}
+	for _, allowance := range allowances {
+		claimed[allowance.AllowanceType] += allowance.Amount
+	}
+
+	explanations := []AllowanceExplanation{}
+	for _, allowanceType := range r.Types() {
+		amount, ok := claimed[allowanceType]
+		if !ok && r[allowanceType].CapRule != constant.DEDUCT_CAP_RULE_FIXED {
+			continue
+		}
+		explanations = append(explanations, AllowanceExplanation{
+			AllowanceType: allowanceType,
+			Claimed:       amount,
+			Accepted:      r[allowanceType].calculator().Deduct(amount),
+		})
+	}
+
+	return explanations
+}
+
+func (r AllowanceRegistry) cappedByNetIncome(allowanceType string) bool {
+	rule, ok := r[allowanceType]
+	if !ok {
+		return false
+	}
+	_, ok = rule.calculator().(netIncomeCapper)
+	return ok
+}
+
+// deductFromNetIncome caps the allowances at their share of the net income and
+// deducts them from it one type after the other, the types counting most
+// times first as their cap is on the net income before the others. Claims of
+// the same type, as by both spouses of a joint return, share one cap and are
+// accepted in the order given. The accepted amounts are updated in place.
+func (r AllowanceRegistry) deductFromNetIncome(netIncome money.Money, allowances []*AllowanceExplanation) money.Money {
+	var allowanceTypes []string
+	claims := map[string][]*AllowanceExplanation{}
+	for _, allowance := range allowances {
+		if _, ok := claims[allowance.AllowanceType]; !ok {
+			allowanceTypes = append(allowanceTypes, allowance.AllowanceType)
+		}
+		claims[allowance.AllowanceType] = append(claims[allowance.AllowanceType], allowance)
+	}
+
+	sort.SliceStable(allowanceTypes, func(i, j int) bool {
+		return r[allowanceTypes[i]].multiplier() > r[allowanceTypes[j]].multiplier()
+	})
+
+	for _, allowanceType := range allowanceTypes {
+		var deductible money.Money
+		for _, claim := range claims[allowanceType] {
+			deductible += claim.Accepted
+		}
+
+		capper := r[allowanceType].calculator().(netIncomeCapper)
+		accepted := capper.CapToNetIncome(deductible, netIncome)
+		netIncome -= accepted
+
+		for _, claim := range claims[allowanceType] {
+			claim.Accepted = claim.Accepted.Min(accepted)
+			accepted -= claim.Accepted
+		}
+	}
+
+	return netIncome
+}
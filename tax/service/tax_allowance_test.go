@@ -0,0 +1,278 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestAllowanceRegistry() AllowanceRegistry {
+	configs := deductConfigs(testTaxYear, money.FromBaht(60000), money.FromBaht(50000), money.FromBaht(100000))
+	configs = append(configs, repository.TaxDeductConfig{DeductId: "life-insurance", Amount: money.FromBaht(100000), CapRule: constant.DEDUCT_CAP_RULE_MAX})
+	return newAllowanceRegistry(configs)
+}
+
+func TestNewAllowanceRegistry(t *testing.T) {
+	registry := newTestAllowanceRegistry()
+
+	// personal is always deducted and can not be claimed
+	assert.Equal(t, []string{"donation", "k-receipt", "life-insurance"}, registry.Types())
+	assert.Equal(t, AllowanceRule{AllowanceType: "k-receipt", CapRule: constant.DEDUCT_CAP_RULE_MAX, Amount: money.FromBaht(50000), Description: "k-receipt allowance"}, registry["k-receipt"])
+}
+
+func TestAllowanceRegistry_Validate(t *testing.T) {
+	registry := newTestAllowanceRegistry()
+
+	testCases := []struct {
+		name       string
+		allowances []Allowance
+		expected   string
+	}{
+		{
+			name:       "SupportedTypes",
+			allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(200)}, {AllowanceType: "life-insurance", Amount: money.FromBaht(200)}},
+		},
+		{
+			name:       "UnsupportedType",
+			allowances: []Allowance{{AllowanceType: "invalid", Amount: money.FromBaht(200)}},
+			expected:   `allowanceType "invalid" is not supported, must be one of: donation, k-receipt, life-insurance`,
+		},
+		{
+			name:       "PersonalNotClaimable",
+			allowances: []Allowance{{AllowanceType: "personal", Amount: money.FromBaht(200)}},
+			expected:   `allowanceType "personal" is not supported, must be one of: donation, k-receipt, life-insurance`,
+		},
+		{
+			name:       "NegativeAmount",
+			allowances: []Allowance{{AllowanceType: "k-receipt", Amount: -money.FromBaht(1)}},
+			expected:   "k-receipt allowance must not be less than 0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := registry.Validate(tc.allowances)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAllowanceRegistry_Explain_Accepted(t *testing.T) {
+	registry := newTestAllowanceRegistry()
+
+	testCases := []struct {
+		name       string
+		allowances []Allowance
+		expected   money.Money
+	}{
+		{
+			name:       "BelowMax",
+			allowances: []Allowance{{AllowanceType: "k-receipt", Amount: money.FromBaht(40000)}},
+			expected:   money.FromBaht(40000),
+		},
+		{
+			name:       "AboveMax",
+			allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(200000)}},
+			expected:   money.FromBaht(100000),
+		},
+		{
+			name:       "ClaimsOfSameTypeShareTheCap",
+			allowances: []Allowance{{AllowanceType: "k-receipt", Amount: money.FromBaht(30000)}, {AllowanceType: "k-receipt", Amount: money.FromBaht(30000)}},
+			expected:   money.FromBaht(50000),
+		},
+		{
+			name:       "ConfiguredType",
+			allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(10000)}, {AllowanceType: "life-insurance", Amount: money.FromBaht(25000)}},
+			expected:   money.FromBaht(35000),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var accepted money.Money
+			for _, explanation := range registry.Explain(tc.allowances) {
+				accepted += explanation.Accepted
+			}
+			assert.Equal(t, tc.expected, accepted)
+		})
+	}
+}
+
+func TestAllowanceRegistry_Explain(t *testing.T) {
+	registry := newTestAllowanceRegistry()
+
+	explanations := registry.Explain([]Allowance{
+		{AllowanceType: "k-receipt", Amount: money.FromBaht(30000)},
+		{AllowanceType: "donation", Amount: money.FromBaht(200000)},
+		{AllowanceType: "k-receipt", Amount: money.FromBaht(30000)},
+	})
+
+	// claims of the same type are summed, types not claimed are left out
+	assert.Equal(t, []AllowanceExplanation{
+		{AllowanceType: "donation", Claimed: money.FromBaht(200000), Accepted: money.FromBaht(100000)},
+		{AllowanceType: "k-receipt", Claimed: money.FromBaht(60000), Accepted: money.FromBaht(50000)},
+	}, explanations)
+
+	assert.Equal(t, []AllowanceExplanation{}, registry.Explain(nil))
+}
+
+func TestAllowanceRegistry_Explain_Fixed(t *testing.T) {
+	registry := newAllowanceRegistry([]repository.TaxDeductConfig{
+		{DeductId: "social-security", Amount: money.FromBaht(9000), CapRule: constant.DEDUCT_CAP_RULE_FIXED},
+		{DeductId: constant.DEDUCT_PERSONAL_ID, Amount: money.FromBaht(60000), CapRule: constant.DEDUCT_CAP_RULE_FIXED},
+	})
+
+	// the personal allowance is deducted on its own, a fixed type is listed
+	// at its amount whether claimed or not
+	assert.Equal(t, []string{"social-security"}, registry.Types())
+	assert.Equal(t, []AllowanceExplanation{{AllowanceType: "social-security", Accepted: money.FromBaht(9000)}}, registry.Explain(nil))
+	assert.Equal(t, []AllowanceExplanation{{AllowanceType: "social-security", Claimed: money.FromBaht(5000), Accepted: money.FromBaht(9000)}}, registry.Explain([]Allowance{{AllowanceType: "social-security", Amount: money.FromBaht(5000)}}))
+}
+
+func TestCalculationTax_FixedAllowance(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	socialSecurity := repository.TaxDeductConfig{DeductId: "social-security", TaxYear: testTaxYear, Amount: money.FromBaht(9000), MaxAmount: money.FromBaht(9000), CapRule: constant.DEDUCT_CAP_RULE_FIXED, Multiplier: 1}
+	mockRepo.On("Create", &socialSecurity, "admin").Return(nil)
+	mockDeductConfigs(mockRepo, append(seededDeductConfigs(testTaxYear), socialSecurity))
+
+	_, err := taxService.CreateDeduction(&CreateDeductRequest{DeductType: "social-security", TaxYear: testTaxYear, Amount: money.FromBaht(9000), MaxAmount: money.FromBaht(9000), CapRule: constant.DEDUCT_CAP_RULE_FIXED, CreatedBy: "admin"})
+	assert.NoError(t, err)
+	mockRepo.AssertCalled(t, "Create", &socialSecurity, "admin")
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{TotalIncome: money.FromBaht(500000)})
+
+	assert.NoError(t, err)
+	// 500,000 - 60,000 personal - 9,000 social security without a claim
+	assert.Equal(t, []AllowanceExplanation{{AllowanceType: "social-security", Accepted: money.FromBaht(9000)}}, taxResponse.Explanation.Allowances)
+	assert.Equal(t, money.FromBaht(431000), taxResponse.Explanation.TaxableIncome)
+	assert.Equal(t, money.FromBaht(28100), taxResponse.Tax)
+}
+
+func TestCalculationTax_UnsupportedAllowance(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockFilingRepo := newMockTaxFilingPort()
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	incomeDetail := &TaxRequest{
+		TotalIncome: money.FromBaht(500000),
+		Allowances:  []Allowance{{AllowanceType: "life-insurance", Amount: money.FromBaht(10000)}},
+	}
+
+	taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+	assert.Nil(t, taxResponse)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.Contains(t, err.Error(), "must be one of: donation, donation-education, k-receipt")
+	mockFilingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestGetAllowanceTypes(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	allowanceTypes, err := taxService.GetAllowanceTypes(0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, testTaxYear, allowanceTypes.TaxYear)
+	assert.Len(t, allowanceTypes.AllowanceTypes, 3)
+	assert.Equal(t, "donation", allowanceTypes.AllowanceTypes[0].AllowanceType)
+}
+
+func newTestPercentOfNetRegistry() AllowanceRegistry {
+	return newAllowanceRegistry([]repository.TaxDeductConfig{
+		{DeductId: "donation", Rate: 0.1, Multiplier: 1, CapRule: constant.DEDUCT_CAP_RULE_PERCENT_OF_NET},
+		{DeductId: "donation-education", Rate: 0.1, Multiplier: 2, CapRule: constant.DEDUCT_CAP_RULE_PERCENT_OF_NET},
+		{DeductId: "k-receipt", Amount: money.FromBaht(50000), CapRule: constant.DEDUCT_CAP_RULE_MAX},
+	})
+}
+
+func TestAllowanceRegistry_deductFromNetIncome(t *testing.T) {
+	registry := newTestPercentOfNetRegistry()
+
+	assert.True(t, registry.cappedByNetIncome("donation"))
+	assert.False(t, registry.cappedByNetIncome("k-receipt"))
+
+	explanations := registry.Explain([]Allowance{
+		{AllowanceType: "donation", Amount: money.FromBaht(100000)},
+		{AllowanceType: "donation-education", Amount: money.FromBaht(30000)},
+	})
+	// education donations count double before the cap
+	assert.Equal(t, money.FromBaht(60000), explanations[1].Accepted)
+
+	netIncome := registry.deductFromNetIncome(money.FromBaht(890000), []*AllowanceExplanation{&explanations[0], &explanations[1]})
+
+	// donation-education is capped at 10% of 890,000 first, donation at 10%
+	// of the 830,000 left
+	assert.Equal(t, money.FromBaht(60000), explanations[1].Accepted)
+	assert.Equal(t, money.FromBaht(83000), explanations[0].Accepted)
+	assert.Equal(t, money.FromBaht(747000), netIncome)
+}
+
+func TestAllowanceRegistry_deductFromNetIncome_SharedCap(t *testing.T) {
+	registry := newTestPercentOfNetRegistry()
+
+	taxpayer := registry.Explain([]Allowance{{AllowanceType: "donation", Amount: money.FromBaht(60000)}})
+	spouse := registry.Explain([]Allowance{{AllowanceType: "donation", Amount: money.FromBaht(60000)}})
+
+	netIncome := registry.deductFromNetIncome(money.FromBaht(1000000), []*AllowanceExplanation{&taxpayer[0], &spouse[0]})
+
+	// the claims of both spouses share 10% of 1,000,000, the first claim is
+	// accepted in full
+	assert.Equal(t, money.FromBaht(60000), taxpayer[0].Accepted)
+	assert.Equal(t, money.FromBaht(40000), spouse[0].Accepted)
+	assert.Equal(t, money.FromBaht(900000), netIncome)
+}
+
+func TestAllowanceRegistry_deductFromNetIncome_NoNetIncome(t *testing.T) {
+	registry := newTestPercentOfNetRegistry()
+
+	explanations := registry.Explain([]Allowance{{AllowanceType: "donation", Amount: money.FromBaht(1000)}})
+	netIncome := registry.deductFromNetIncome(-money.FromBaht(10000), []*AllowanceExplanation{&explanations[0]})
+
+	assert.Equal(t, money.Money(0), explanations[0].Accepted)
+	assert.Equal(t, -money.FromBaht(10000), netIncome)
+}
+
+func TestCalculationTax_PercentOfNetDonation(t *testing.T) {
+	taxService := newTestTaxService()
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome: money.FromBaht(1000000),
+		Allowances: []Allowance{
+			{AllowanceType: "donation", Amount: money.FromBaht(100000)},
+			{AllowanceType: "donation-education", Amount: money.FromBaht(30000)},
+			{AllowanceType: "k-receipt", Amount: money.FromBaht(50000)},
+		},
+	})
+
+	assert.NoError(t, err)
+	// 1,000,000 - 60,000 personal - 50,000 k-receipt leaves 890,000 to cap
+	// the donations on
+	assert.Equal(t, []AllowanceExplanation{
+		{AllowanceType: "donation", Claimed: money.FromBaht(100000), Accepted: money.FromBaht(83000)},
+		{AllowanceType: "donation-education", Claimed: money.FromBaht(30000), Accepted: money.FromBaht(60000)},
+		{AllowanceType: "k-receipt", Claimed: money.FromBaht(50000), Accepted: money.FromBaht(50000)},
+	}, taxResponse.Explanation.Allowances)
+	assert.Equal(t, money.FromBaht(747000), taxResponse.Explanation.TaxableIncome)
+	assert.Equal(t, money.FromBaht(72050), taxResponse.Tax)
+}
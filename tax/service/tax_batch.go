@@ -0,0 +1,430 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/tax/repository"
+)
+
+// taxBatchPollInterval is how often the runner looks for jobs queued by
+// another server by default.
+const taxBatchPollInterval = 5 * time.Second
+
+// taxBatchLease is how long a running job stays claimed by its server without
+// a renewal by default, it is renewed three times per lease.
+const taxBatchLease = time.Minute
+
+// taxBatchProgressRows is the number of rows calculated and saved at a time,
+// the progress is updated after each.
+const taxBatchProgressRows = 100
+
+// taxBatchResult is the stored summary of a completed job, its rows are
+// stored one by one as taxBatchRow.
+type taxBatchResult struct {
+	Header         []string `json:"header"`
+	Levels         []string `json:"levels"`
+	IgnoredColumns []string `json:"ignoredColumns,omitempty"`
+}
+
+// taxBatchRow is a calculated row of a job, the sheet row is kept for
+// downloading the result as a spreadsheet. Tax is nil for an invalid row.
+type taxBatchRow struct {
+	Sheet TaxUploadSheetRow `json:"sheet"`
+	Tax   *TaxUpload        `json:"tax,omitempty"`
+}
+
+// CreateTaxBatch queues an upload for calculation in the background. The
+// file is checked to be readable and its rows are counted before it is
+// stored, the rows themselves are validated once the job runs.
+func (t *TaxService) CreateTaxBatch(file io.Reader, options *TaxUploadOptions) (*TaxBatchResponse, error) {
+	taxRule, err := t.loadTaxRule(options.TaxYear)
+	if err != nil {
+		t.logger.Debug().Msg(err.Error())
+		return nil, err
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	totalRows, err := t.countUploadRows(content, options.ContentType, taxRule.Allowances.Types())
+	if err != nil {
+		t.logger.Debug().Msg(err.Error())
+		return nil, err
+	}
+
+	batch := repository.TaxBatch{
+		Token:       newTaxBatchToken(),
+		Status:      constant.TAX_BATCH_STATUS_QUEUED,
+		TaxYear:     taxRule.TaxYear,
+		Partial:     options.Partial,
+		ContentType: options.ContentType,
+		File:        content,
+		TotalRows:   totalRows,
+		CreatedAt:   time.Now(),
+	}
+
+	batch.BatchId, err = t.BatchRepo.Create(&batch)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BATCH_CREATE_FAILED)
+	}
+
+	select {
+	case t.batchQueued <- struct{}{}:
+	default: // the runner is already woken up
+	}
+
+	batchResponse := getTaxBatchResponse(&batch)
+	return &batchResponse, nil
+}
+
+func (t *TaxService) countUploadRows(content []byte, contentType string, allowanceTypes []string) (int, error) {
+	reader, err := t.openUploadReader(bytes.NewReader(content), contentType, allowanceTypes)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	rows := 0
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		rows++
+	}
+}
+
+func (t *TaxService) GetTaxBatch(token string) (*TaxBatchResponse, error) {
+	batch, err := t.findTaxBatch(token)
+	if err != nil {
+		return nil, err
+	}
+
+	batchResponse := getTaxBatchResponse(batch)
+	return &batchResponse, nil
+}
+
+// GetTaxBatchResult returns the result of a completed job, with its sheet for
+// downloading it as a spreadsheet.
+func (t *TaxService) GetTaxBatchResult(token string) (*TaxUploadResponse, error) {
+	batch, err := t.findTaxBatch(token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch batch.Status {
+	case constant.TAX_BATCH_STATUS_COMPLETED:
+	case constant.TAX_BATCH_STATUS_FAILED:
+		return nil, apperrs.NewUnprocessableEntity(constant.MSG_BU_TAX_BATCH_FAILED + batch.Error)
+	default:
+		return nil, apperrs.NewConflictError(constant.MSG_BU_TAX_BATCH_NOT_FINISHED)
+	}
+
+	result, err := t.BatchRepo.FindResultById(batch.BatchId)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BATCH_LOAD_FAILED)
+	}
+
+	var batchResult taxBatchResult
+	if err := json.Unmarshal(result, &batchResult); err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BATCH_LOAD_FAILED)
+	}
+
+	rows, err := t.BatchRepo.FindRowsById(batch.BatchId)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BATCH_LOAD_FAILED)
+	}
+
+	uploadResponse := &TaxUploadResponse{
+		IgnoredColumns: batchResult.IgnoredColumns,
+		Sheet:          &TaxUploadSheet{Header: batchResult.Header, Levels: batchResult.Levels},
+	}
+	for _, row := range rows {
+		var batchRow taxBatchRow
+		if err := json.Unmarshal(row, &batchRow); err != nil {
+			t.logger.Error().Msg(err.Error())
+			return nil, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BATCH_LOAD_FAILED)
+		}
+
+		uploadResponse.Sheet.Rows = append(uploadResponse.Sheet.Rows, batchRow.Sheet)
+		uploadResponse.Errors = append(uploadResponse.Errors, batchRow.Sheet.Errors...)
+		if batchRow.Tax != nil {
+			uploadResponse.Taxes = append(uploadResponse.Taxes, *batchRow.Tax)
+		}
+	}
+
+	return uploadResponse, nil
+}
+
+func (t *TaxService) findTaxBatch(token string) (*repository.TaxBatch, error) {
+	batch, err := t.BatchRepo.FindByToken(token)
+	if errors.Is(err, repository.ErrTaxBatchNotFound) {
+		return nil, apperrs.NewNotFoundError(constant.MSG_BU_TAX_BATCH_NOT_FOUND)
+	}
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BATCH_LOAD_FAILED)
+	}
+	return batch, nil
+}
+
+// RunTaxBatches calculates the queued jobs one at a time until ctx is done.
+// A job interrupted then is put back in the queue and starts over, as is
+// every job whose lease ran out because its server stopped.
+func (t *TaxService) RunTaxBatches(ctx context.Context) {
+	for ctx.Err() == nil {
+		requeued, err := t.BatchRepo.RequeueExpired()
+		if err != nil {
+			t.logger.Error().Msg(err.Error())
+		} else if requeued > 0 {
+			t.logger.Info().Msgf("Requeued %d tax batches with an expired lease", requeued)
+		}
+
+		batch, err := t.BatchRepo.ClaimNext(t.batchWorkerId, t.batchLease)
+		if err != nil {
+			t.logger.Error().Msg(err.Error())
+		}
+		if batch != nil {
+			t.runTaxBatch(ctx, batch)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-t.batchQueued:
+		case <-time.After(t.batchPollInterval):
+		}
+	}
+}
+
+// keepTaxBatchLease renews the lease of a job until ctx is done and calls
+// lost when the job was taken away from this server.
+func (t *TaxService) keepTaxBatchLease(ctx context.Context, batchId int64, lost context.CancelFunc) {
+	ticker := time.NewTicker(t.batchLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := t.BatchRepo.RenewLease(batchId, t.batchWorkerId, t.batchLease)
+		if errors.Is(err, repository.ErrTaxBatchLeaseLost) {
+			lost()
+			return
+		}
+		if err != nil {
+			t.logger.Error().Msg(err.Error())
+		}
+	}
+}
+
+func (t *TaxService) runTaxBatch(ctx context.Context, batch *repository.TaxBatch) {
+	t.logger.Info().Msgf("Tax batch %d started, rows: %d", batch.BatchId, batch.TotalRows)
+
+	taxRule, err := t.loadTaxRule(batch.TaxYear)
+	if err != nil {
+		t.failTaxBatch(batch.BatchId, 0, 0, err)
+		return
+	}
+
+	reader, err := t.openUploadReader(bytes.NewReader(batch.File), batch.ContentType, taxRule.Allowances.Types())
+	if err != nil {
+		t.failTaxBatch(batch.BatchId, 0, 0, err)
+		return
+	}
+	defer reader.Close()
+
+	// the lease is kept until the job returns, which waits for the renewal to
+	// stop so none is left running after the job
+	jobCtx, leaseLost := context.WithCancel(ctx)
+	var leaseKept sync.WaitGroup
+	leaseKept.Add(1)
+	go func() {
+		defer leaseKept.Done()
+		t.keepTaxBatchLease(jobCtx, batch.BatchId, leaseLost)
+	}()
+	defer leaseKept.Wait()
+	defer leaseLost()
+
+	// the rows are calculated and saved a chunk at a time, so a large upload
+	// is never held in memory as a whole
+	var processedRows, failedRows int
+	chunk := newTaxUploadResponse(reader.Header(), reader.IgnoredColumns(), taxRule)
+	for {
+		if ctx.Err() != nil {
+			t.logger.Info().Msgf("Tax batch %d interrupted, requeued", batch.BatchId)
+			if err := t.BatchRepo.Requeue(batch.BatchId, t.batchWorkerId); err != nil {
+				t.logger.Error().Msg(err.Error())
+			}
+			return
+		}
+		if jobCtx.Err() != nil {
+			t.logger.Info().Msgf("Tax batch %d lease lost, left to the server holding it", batch.BatchId)
+			return
+		}
+
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = t.addTaxUploadRow(chunk, row, taxRule, batch.Partial)
+		}
+		if err != nil {
+			// the row that failed the job counts as processed
+			chunkRows, chunkFailedRows := taxBatchRowCounts(chunk)
+			t.failTaxBatch(batch.BatchId, processedRows+chunkRows+1, failedRows+chunkFailedRows+1, err)
+			return
+		}
+
+		if len(chunk.Sheet.Rows) < taxBatchProgressRows {
+			continue
+		}
+		if !t.saveTaxBatchChunk(batch.BatchId, processedRows, failedRows, chunk) {
+			return
+		}
+		chunkRows, chunkFailedRows := taxBatchRowCounts(chunk)
+		processedRows, failedRows = processedRows+chunkRows, failedRows+chunkFailedRows
+		chunk = newTaxUploadResponse(reader.Header(), reader.IgnoredColumns(), taxRule)
+
+		if err := t.BatchRepo.UpdateProgress(batch.BatchId, t.batchWorkerId, processedRows, failedRows); err != nil {
+			t.logger.Error().Msg(err.Error())
+		}
+	}
+
+	if len(chunk.Sheet.Rows) > 0 {
+		if !t.saveTaxBatchChunk(batch.BatchId, processedRows, failedRows, chunk) {
+			return
+		}
+		chunkRows, chunkFailedRows := taxBatchRowCounts(chunk)
+		processedRows, failedRows = processedRows+chunkRows, failedRows+chunkFailedRows
+	}
+
+	result, err := json.Marshal(taxBatchResult{Header: chunk.Sheet.Header, Levels: chunk.Sheet.Levels, IgnoredColumns: chunk.IgnoredColumns})
+	if err != nil {
+		t.failTaxBatch(batch.BatchId, processedRows, failedRows, err)
+		return
+	}
+
+	if err := t.BatchRepo.Complete(batch.BatchId, t.batchWorkerId, processedRows, failedRows, result); err != nil {
+		t.logger.Error().Msg(err.Error())
+		return
+	}
+	t.logger.Info().Msgf("Tax batch %d completed, rows: %d, failed: %d", batch.BatchId, processedRows, failedRows)
+}
+
+// saveTaxBatchChunk saves the rows of a chunk after the rows saved before,
+// it reports whether the job can go on.
+func (t *TaxService) saveTaxBatchChunk(batchId int64, processedRows int, failedRows int, chunk *TaxUploadResponse) bool {
+	rows := make([]json.RawMessage, 0, len(chunk.Sheet.Rows))
+	taxes := chunk.Taxes
+	for _, sheetRow := range chunk.Sheet.Rows {
+		batchRow := taxBatchRow{Sheet: sheetRow}
+		if sheetRow.TaxResponse != nil {
+			batchRow.Tax = &taxes[0]
+			taxes = taxes[1:]
+		}
+
+		row, err := json.Marshal(batchRow)
+		if err != nil {
+			t.failTaxBatch(batchId, processedRows, failedRows, err)
+			return false
+		}
+		rows = append(rows, row)
+	}
+
+	err := t.BatchRepo.SaveRows(batchId, t.batchWorkerId, processedRows+1, rows)
+	if errors.Is(err, repository.ErrTaxBatchLeaseLost) {
+		t.logger.Info().Msgf("Tax batch %d lease lost, left to the server holding it", batchId)
+		return false
+	}
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		t.failTaxBatch(batchId, processedRows, failedRows, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BATCH_SAVE_FAILED))
+		return false
+	}
+	return true
+}
+
+func (t *TaxService) failTaxBatch(batchId int64, processedRows int, failedRows int, err error) {
+	t.logger.Info().Msgf("Tax batch %d failed: %v", batchId, err)
+	if err := t.BatchRepo.Fail(batchId, t.batchWorkerId, processedRows, failedRows, apperrs.Message(err)); err != nil {
+		t.logger.Error().Msg(err.Error())
+	}
+}
+
+// newTaxBatchWorkerId names this server in the jobs it claims, unique per
+// process so a restarted server does not take its old jobs for its own.
+func newTaxBatchWorkerId() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%x", hostname, os.Getpid(), suffix)
+}
+
+// newTaxBatchToken returns a random version 4 UUID, the id a job is polled by
+// so other users' jobs can not be found by counting up.
+func newTaxBatchToken() string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	token[6] = token[6]&0x0f | 0x40
+	token[8] = token[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", token[0:4], token[4:6], token[6:8], token[8:10], token[10:])
+}
+
+func taxBatchRowCounts(uploadResponse *TaxUploadResponse) (int, int) {
+	processedRows := len(uploadResponse.Sheet.Rows)
+	return processedRows, processedRows - len(uploadResponse.Taxes)
+}
+
+func getTaxBatchResponse(batch *repository.TaxBatch) TaxBatchResponse {
+	mode := constant.TAX_UPLOAD_MODE_STRICT
+	if batch.Partial {
+		mode = constant.TAX_UPLOAD_MODE_PARTIAL
+	}
+
+	progress := 0
+	if batch.Status == constant.TAX_BATCH_STATUS_COMPLETED {
+		progress = 100
+	} else if batch.TotalRows > 0 {
+		progress = batch.ProcessedRows * 100 / batch.TotalRows
+	}
+
+	return TaxBatchResponse{
+		Token:         batch.Token,
+		Status:        batch.Status,
+		TaxYear:       batch.TaxYear,
+		Mode:          mode,
+		TotalRows:     batch.TotalRows,
+		ProcessedRows: batch.ProcessedRows,
+		FailedRows:    batch.FailedRows,
+		Progress:      progress,
+		Error:         batch.Error,
+		CreatedAt:     batch.CreatedAt,
+		StartedAt:     batch.StartedAt,
+		FinishedAt:    batch.FinishedAt,
+	}
+}
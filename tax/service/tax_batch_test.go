@@ -0,0 +1,457 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTaxBatchPort is a mock implementation of the repository.TaxBatchPort interface.
+type MockTaxBatchPort struct {
+	mock.Mock
+}
+
+func (m *MockTaxBatchPort) Create(batch *repository.TaxBatch) (int64, error) {
+	args := m.Called(batch)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockTaxBatchPort) FindByToken(token string) (*repository.TaxBatch, error) {
+	args := m.Called(token)
+	return args.Get(0).(*repository.TaxBatch), args.Error(1)
+}
+
+func (m *MockTaxBatchPort) FindResultById(id int64) (json.RawMessage, error) {
+	args := m.Called(id)
+	return args.Get(0).(json.RawMessage), args.Error(1)
+}
+
+func (m *MockTaxBatchPort) FindRowsById(id int64) ([]json.RawMessage, error) {
+	args := m.Called(id)
+	return args.Get(0).([]json.RawMessage), args.Error(1)
+}
+
+func (m *MockTaxBatchPort) SaveRows(id int64, claimedBy string, firstRowNo int, rows []json.RawMessage) error {
+	args := m.Called(id, claimedBy, firstRowNo, rows)
+	return args.Error(0)
+}
+
+func (m *MockTaxBatchPort) ClaimNext(claimedBy string, lease time.Duration) (*repository.TaxBatch, error) {
+	args := m.Called(claimedBy, lease)
+	return args.Get(0).(*repository.TaxBatch), args.Error(1)
+}
+
+func (m *MockTaxBatchPort) RenewLease(id int64, claimedBy string, lease time.Duration) error {
+	args := m.Called(id, claimedBy, lease)
+	return args.Error(0)
+}
+
+func (m *MockTaxBatchPort) UpdateProgress(id int64, claimedBy string, processedRows int, failedRows int) error {
+	args := m.Called(id, claimedBy, processedRows, failedRows)
+	return args.Error(0)
+}
+
+func (m *MockTaxBatchPort) Complete(id int64, claimedBy string, processedRows int, failedRows int, result json.RawMessage) error {
+	args := m.Called(id, claimedBy, processedRows, failedRows, result)
+	return args.Error(0)
+}
+
+func (m *MockTaxBatchPort) Fail(id int64, claimedBy string, processedRows int, failedRows int, message string) error {
+	args := m.Called(id, claimedBy, processedRows, failedRows, message)
+	return args.Error(0)
+}
+
+func (m *MockTaxBatchPort) Requeue(id int64, claimedBy string) error {
+	args := m.Called(id, claimedBy)
+	return args.Error(0)
+}
+
+func (m *MockTaxBatchPort) RequeueExpired() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+const testTaxBatchToken = "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b"
+
+func newTestQueuedBatch(csvData string, partial bool) *repository.TaxBatch {
+	return &repository.TaxBatch{
+		BatchId:   7,
+		Token:     testTaxBatchToken,
+		Status:    constant.TAX_BATCH_STATUS_RUNNING,
+		TaxYear:   testTaxYear,
+		Partial:   partial,
+		File:      []byte(csvData),
+		TotalRows: strings.Count(csvData, "\n") - 1,
+	}
+}
+
+func TestCreateTaxBatch(t *testing.T) {
+	taxService := newTestTaxService()
+
+	csvData := "totalIncome,wht,donation\n500000,0,0\n600000,40000,20000\n750000,50000,15000\n"
+	var token string
+	taxService.batchRepo.On("Create", mock.MatchedBy(func(batch *repository.TaxBatch) bool {
+		token = batch.Token
+		return batch.Status == constant.TAX_BATCH_STATUS_QUEUED &&
+			batch.TaxYear == testTaxYear &&
+			batch.Partial &&
+			batch.TotalRows == 3 &&
+			string(batch.File) == csvData
+	})).Return(int64(7), nil)
+
+	batchResponse, err := taxService.CreateTaxBatch(strings.NewReader(csvData), &TaxUploadOptions{Partial: true})
+
+	assert.NoError(t, err)
+	// the job is polled by a random token instead of its id
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, batchResponse.Token)
+	assert.Equal(t, token, batchResponse.Token)
+	assert.Equal(t, constant.TAX_BATCH_STATUS_QUEUED, batchResponse.Status)
+	assert.Equal(t, constant.TAX_UPLOAD_MODE_PARTIAL, batchResponse.Mode)
+	assert.Equal(t, 3, batchResponse.TotalRows)
+	assert.Equal(t, 0, batchResponse.Progress)
+
+	// the runner is woken up
+	assert.Len(t, taxService.batchQueued, 1)
+	taxService.batchRepo.AssertExpectations(t)
+}
+
+func TestCreateTaxBatch_InvalidHeader(t *testing.T) {
+	taxService := newTestTaxService()
+
+	_, err := taxService.CreateTaxBatch(strings.NewReader("totalIncome\n500000\n"), &TaxUploadOptions{})
+
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	taxService.batchRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestCreateTaxBatch_CreateFailed(t *testing.T) {
+	taxService := newTestTaxService()
+	taxService.batchRepo.On("Create", mock.Anything).Return(int64(0), errors.New("db down"))
+
+	_, err := taxService.CreateTaxBatch(strings.NewReader("totalIncome,wht\n500000,0\n"), &TaxUploadOptions{})
+
+	assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+	assert.Equal(t, constant.MSG_BU_TAX_BATCH_CREATE_FAILED, err.(*echo.HTTPError).Message)
+}
+
+func TestGetTaxBatch(t *testing.T) {
+	taxService := newTestTaxService()
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	taxService.batchRepo.On("FindByToken", testTaxBatchToken).Return(&repository.TaxBatch{
+		BatchId:       7,
+		Token:         testTaxBatchToken,
+		Status:        constant.TAX_BATCH_STATUS_RUNNING,
+		TaxYear:       testTaxYear,
+		TotalRows:     400,
+		ProcessedRows: 100,
+		FailedRows:    3,
+		CreatedAt:     createdAt,
+	}, nil)
+
+	batchResponse, err := taxService.GetTaxBatch(testTaxBatchToken)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &TaxBatchResponse{
+		Token:         testTaxBatchToken,
+		Status:        constant.TAX_BATCH_STATUS_RUNNING,
+		TaxYear:       testTaxYear,
+		Mode:          constant.TAX_UPLOAD_MODE_STRICT,
+		TotalRows:     400,
+		ProcessedRows: 100,
+		FailedRows:    3,
+		Progress:      25,
+		CreatedAt:     createdAt,
+	}, batchResponse)
+}
+
+func TestGetTaxBatch_NotFound(t *testing.T) {
+	taxService := newTestTaxService()
+	taxService.batchRepo.On("FindByToken", testTaxBatchToken).Return((*repository.TaxBatch)(nil), repository.ErrTaxBatchNotFound)
+
+	_, err := taxService.GetTaxBatch(testTaxBatchToken)
+
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	assert.Equal(t, constant.MSG_BU_TAX_BATCH_NOT_FOUND, err.(*echo.HTTPError).Message)
+}
+
+func TestGetTaxBatchResult_NotCompleted(t *testing.T) {
+	tests := []struct {
+		name    string
+		batch   repository.TaxBatch
+		code    int
+		message string
+	}{
+		{"Queued", repository.TaxBatch{Status: constant.TAX_BATCH_STATUS_QUEUED}, http.StatusConflict, constant.MSG_BU_TAX_BATCH_NOT_FINISHED},
+		{"Running", repository.TaxBatch{Status: constant.TAX_BATCH_STATUS_RUNNING}, http.StatusConflict, constant.MSG_BU_TAX_BATCH_NOT_FINISHED},
+		{"Failed", repository.TaxBatch{Status: constant.TAX_BATCH_STATUS_FAILED, Error: "line 3: csv wrong format"}, http.StatusUnprocessableEntity, constant.MSG_BU_TAX_BATCH_FAILED + "line 3: csv wrong format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taxService := newTestTaxService()
+			batch := tt.batch
+			taxService.batchRepo.On("FindByToken", testTaxBatchToken).Return(&batch, nil)
+
+			_, err := taxService.GetTaxBatchResult(testTaxBatchToken)
+
+			assert.Equal(t, tt.code, err.(*echo.HTTPError).Code)
+			assert.Equal(t, tt.message, err.(*echo.HTTPError).Message)
+			taxService.batchRepo.AssertNotCalled(t, "FindResultById", mock.Anything)
+		})
+	}
+}
+
+func TestRunTaxBatch_Completed(t *testing.T) {
+	taxService := newTestTaxService()
+
+	csvData := "id,totalIncome,wht\nE1,500000,0\nE2,600000,700000\nE3,750000,50000\n"
+	batch := newTestQueuedBatch(csvData, true)
+
+	var rows []json.RawMessage
+	taxService.batchRepo.On("SaveRows", int64(7), taxService.batchWorkerId, 1, mock.Anything).Run(func(args mock.Arguments) {
+		rows = args.Get(3).([]json.RawMessage)
+	}).Return(nil)
+	var result json.RawMessage
+	taxService.batchRepo.On("Complete", int64(7), taxService.batchWorkerId, 3, 1, mock.Anything).Run(func(args mock.Arguments) {
+		result = args.Get(4).(json.RawMessage)
+	}).Return(nil)
+
+	taxService.runTaxBatch(context.Background(), batch)
+	taxService.batchRepo.AssertExpectations(t)
+
+	// only the summary is kept with the job, the rows are saved one by one
+	assert.JSONEq(t, `{"header":["id","totalIncome","wht"],"levels":["0-150,000","150,001-500,000","500,001-1,000,000","1,000,001-2,000,000","2,000,001 ขึ้นไป"]}`, string(result))
+	assert.Len(t, rows, 3)
+
+	// the stored result is read back with its sheet
+	taxService.batchRepo.On("FindByToken", testTaxBatchToken).Return(&repository.TaxBatch{BatchId: 7, Token: testTaxBatchToken, Status: constant.TAX_BATCH_STATUS_COMPLETED}, nil)
+	taxService.batchRepo.On("FindResultById", int64(7)).Return(result, nil)
+	taxService.batchRepo.On("FindRowsById", int64(7)).Return(rows, nil)
+
+	uploadResponse, err := taxService.GetTaxBatchResult(testTaxBatchToken)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxUpload{
+		{Id: "E1", TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000), TaxRefund: 0},
+		{Id: "E3", TotalIncome: money.FromBaht(750000), Tax: money.FromBaht(13500), TaxRefund: 0},
+	}, uploadResponse.Taxes)
+	assert.Equal(t, []TaxUploadError{{Line: 3, Column: "wht", Reason: constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME}}, uploadResponse.Errors)
+	assert.Len(t, uploadResponse.Sheet.Rows, 3)
+	assert.Equal(t, money.FromBaht(29000), uploadResponse.Sheet.Rows[0].TaxResponse.Tax)
+}
+
+func TestRunTaxBatch_Progress(t *testing.T) {
+	taxService := newTestTaxService()
+
+	var csvData strings.Builder
+	csvData.WriteString("totalIncome,wht\n")
+	for i := 0; i < 250; i++ {
+		csvData.WriteString("500000,0\n")
+	}
+	batch := newTestQueuedBatch(csvData.String(), false)
+
+	// the rows are saved a chunk at a time
+	taxService.batchRepo.On("SaveRows", int64(7), taxService.batchWorkerId, 1, mock.Anything).Return(nil).Once()
+	taxService.batchRepo.On("SaveRows", int64(7), taxService.batchWorkerId, 101, mock.Anything).Return(nil).Once()
+	taxService.batchRepo.On("SaveRows", int64(7), taxService.batchWorkerId, 201, mock.MatchedBy(func(rows []json.RawMessage) bool {
+		return len(rows) == 50
+	})).Return(nil).Once()
+	taxService.batchRepo.On("UpdateProgress", int64(7), taxService.batchWorkerId, 100, 0).Return(nil).Once()
+	taxService.batchRepo.On("UpdateProgress", int64(7), taxService.batchWorkerId, 200, 0).Return(nil).Once()
+	taxService.batchRepo.On("Complete", int64(7), taxService.batchWorkerId, 250, 0, mock.Anything).Return(nil)
+
+	taxService.runTaxBatch(context.Background(), batch)
+
+	taxService.batchRepo.AssertExpectations(t)
+}
+
+func TestRunTaxBatch_SaveRowsFailed(t *testing.T) {
+	t.Run("Database error", func(t *testing.T) {
+		taxService := newTestTaxService()
+		batch := newTestQueuedBatch("totalIncome,wht\n500000,0\n", false)
+
+		taxService.batchRepo.On("SaveRows", int64(7), taxService.batchWorkerId, 1, mock.Anything).Return(errors.New("db down"))
+		taxService.batchRepo.On("Fail", int64(7), taxService.batchWorkerId, 0, 0, constant.MSG_BU_TAX_BATCH_SAVE_FAILED).Return(nil)
+
+		taxService.runTaxBatch(context.Background(), batch)
+
+		taxService.batchRepo.AssertExpectations(t)
+		taxService.batchRepo.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Lease lost", func(t *testing.T) {
+		taxService := newTestTaxService()
+		batch := newTestQueuedBatch("totalIncome,wht\n500000,0\n", false)
+
+		// the server holding the job now finishes it
+		taxService.batchRepo.On("SaveRows", int64(7), taxService.batchWorkerId, 1, mock.Anything).Return(repository.ErrTaxBatchLeaseLost)
+
+		taxService.runTaxBatch(context.Background(), batch)
+
+		taxService.batchRepo.AssertExpectations(t)
+		taxService.batchRepo.AssertNotCalled(t, "Fail", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		taxService.batchRepo.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestRunTaxBatch_StrictFailed(t *testing.T) {
+	taxService := newTestTaxService()
+
+	batch := newTestQueuedBatch("totalIncome,wht\n500000,0\n600000,700000\n750000,50000\n", false)
+
+	message := taxUploadErrorMessage([]TaxUploadError{{Line: 3, Column: "wht", Reason: constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME}})
+	taxService.batchRepo.On("Fail", int64(7), taxService.batchWorkerId, 2, 1, message).Return(nil)
+
+	taxService.runTaxBatch(context.Background(), batch)
+
+	taxService.batchRepo.AssertExpectations(t)
+	taxService.batchRepo.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRunTaxBatch_Interrupted(t *testing.T) {
+	taxService := newTestTaxService()
+
+	batch := newTestQueuedBatch("totalIncome,wht\n500000,0\n", false)
+	taxService.batchRepo.On("Requeue", int64(7), taxService.batchWorkerId).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	taxService.runTaxBatch(ctx, batch)
+
+	taxService.batchRepo.AssertExpectations(t)
+	taxService.batchRepo.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRunTaxBatches(t *testing.T) {
+	taxService := newTestTaxService()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := newTestQueuedBatch("totalIncome,wht\n500000,0\n", false)
+	second := newTestQueuedBatch("totalIncome,wht\n600000,0\n", false)
+	second.BatchId = 8
+
+	taxService.batchRepo.On("RequeueExpired").Return(int64(1), nil)
+	taxService.batchRepo.On("SaveRows", mock.Anything, taxService.batchWorkerId, 1, mock.Anything).Return(nil)
+	taxService.batchRepo.On("ClaimNext", taxService.batchWorkerId, taxService.batchLease).Return(first, nil).Once()
+	taxService.batchRepo.On("ClaimNext", taxService.batchWorkerId, taxService.batchLease).Return(second, nil).Once()
+	taxService.batchRepo.On("Complete", int64(7), taxService.batchWorkerId, 1, 0, mock.Anything).Return(nil)
+	// stopping the server after the second job ends the runner
+	taxService.batchRepo.On("Complete", int64(8), taxService.batchWorkerId, 1, 0, mock.Anything).Run(func(args mock.Arguments) {
+		cancel()
+	}).Return(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		taxService.RunTaxBatches(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunTaxBatches did not stop")
+	}
+
+	taxService.batchRepo.AssertExpectations(t)
+}
+
+func TestRunTaxBatches_WakeUp(t *testing.T) {
+	taxService := newTestTaxService()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batch := newTestQueuedBatch("totalIncome,wht\n500000,0\n", false)
+
+	taxService.batchRepo.On("RequeueExpired").Return(int64(0), nil)
+	taxService.batchRepo.On("SaveRows", mock.Anything, taxService.batchWorkerId, 1, mock.Anything).Return(nil)
+	taxService.batchRepo.On("ClaimNext", taxService.batchWorkerId, taxService.batchLease).Return((*repository.TaxBatch)(nil), nil).Once()
+	taxService.batchRepo.On("ClaimNext", taxService.batchWorkerId, taxService.batchLease).Return(batch, nil).Once()
+	taxService.batchRepo.On("Complete", int64(7), taxService.batchWorkerId, 1, 0, mock.Anything).Run(func(args mock.Arguments) {
+		cancel()
+	}).Return(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		taxService.RunTaxBatches(ctx)
+	}()
+
+	// a newly queued job is picked up without waiting for the poll interval
+	taxService.batchQueued <- struct{}{}
+
+	select {
+	case <-done:
+	case <-time.After(taxService.batchPollInterval / 2):
+		t.Fatal("queued batch was not picked up")
+	}
+
+	taxService.batchRepo.AssertExpectations(t)
+}
+
+func TestKeepTaxBatchLease(t *testing.T) {
+	taxService := newTestTaxService()
+	taxService.batchLease = 30 * time.Millisecond
+	taxService.batchRepo.On("RenewLease", int64(7), taxService.batchWorkerId, taxService.batchLease).Return(nil).Once()
+	taxService.batchRepo.On("RenewLease", int64(7), taxService.batchWorkerId, taxService.batchLease).Return(repository.ErrTaxBatchLeaseLost).Once()
+
+	ctx, leaseLost := context.WithCancel(context.Background())
+	defer leaseLost()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		taxService.keepTaxBatchLease(ctx, 7, leaseLost)
+	}()
+
+	// the job is stopped once another server took it over
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("keepTaxBatchLease did not stop")
+	}
+
+	assert.Error(t, ctx.Err())
+	taxService.batchRepo.AssertExpectations(t)
+}
+
+func TestRunTaxBatch_StopsLeaseRenewal(t *testing.T) {
+	taxService := newTestTaxService()
+	taxService.batchLease = 3 * time.Millisecond
+
+	var renewals atomic.Int32
+	taxService.batchRepo.On("RenewLease", int64(7), taxService.batchWorkerId, taxService.batchLease).Run(func(args mock.Arguments) {
+		renewals.Add(1)
+	}).Return(nil)
+	// the rows take long enough to save for the lease to be renewed
+	taxService.batchRepo.On("SaveRows", int64(7), taxService.batchWorkerId, 1, mock.Anything).Run(func(args mock.Arguments) {
+		time.Sleep(20 * time.Millisecond)
+	}).Return(nil)
+	taxService.batchRepo.On("Complete", int64(7), taxService.batchWorkerId, 1, 0, mock.Anything).Return(nil)
+
+	taxService.runTaxBatch(context.Background(), newTestQueuedBatch("totalIncome,wht\n500000,0\n", false))
+
+	renewed := renewals.Load()
+	assert.Greater(t, renewed, int32(0))
+
+	// no renewal is left running once the job returned
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, renewed, renewals.Load())
+}
+
+func TestNewTaxBatchWorkerId(t *testing.T) {
+	// two servers on the same host never share an id
+	assert.NotEqual(t, newTaxBatchWorkerId(), newTaxBatchWorkerId())
+}
@@ -2,10 +2,14 @@ package service
 
 import (
 	"math"
+
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
 )
 
 
-func (t *TaxService) getStep(level string, amount float64) TaxStep {
+func (t *TaxService) getStep(level string, amount money.Money) TaxStep {
 	return TaxStep{Level: level, TaxAmount: amount}
 }
 
@@ -24,17 +28,17 @@ func (t *TaxService) getStep(level string, amount float64) TaxStep {
 // }
 
 
-func (t *TaxService) calculateStep(income, lowerBound, upperBound, rate float64, level string) (float64, TaxStep) {
-	var tax float64
+func (t *TaxService) calculateStep(income, lowerBound, upperBound money.Money, rate float64, level string) (money.Money, TaxStep) {
+	var tax money.Money
 	if income <= lowerBound {
 		//fmt.Printf("income:%.2f lowerBound:%.2f upperBound%.2f rate:%.2f tax:%.2f \n",income,lowerBound,upperBound,rate,tax)
 		return 0, t.getStep(level, 0)
 	}
 
 	if upperBound == 0 {
-		tax = (income - lowerBound) * rate
+		tax = (income - lowerBound).MulRate(rate)
 	}else{
-		tax = (math.Min(income,upperBound) - lowerBound) * rate
+		tax = (income.Min(upperBound) - lowerBound).MulRate(rate)
 	}
 
 	//fmt.Printf("income:%.2f lowerBound:%.2f upperBound%.2f rate:%.2f tax:%.2f \n",income,lowerBound,upperBound,rate,tax)
@@ -42,33 +46,71 @@ func (t *TaxService) calculateStep(income, lowerBound, upperBound, rate float64,
 }
 
 
-func (t *TaxService) calculateTaxTable(salary float64) ([]TaxStep, float64) {
-	var totalTax float64
+func (t *TaxService) calculateTaxTable(salary money.Money, brackets []repository.TaxBracket) ([]TaxStep, money.Money) {
+	var totalTax money.Money
 	var steps []TaxStep
 
-	tax, step := t.calculateStep(salary, 0, 150000, 0.0, "0-150,000")
-	totalTax += tax
-	steps = append(steps, step)
+	for _, bracket := range brackets {
+		tax, step := t.calculateStep(salary, bracket.LowerBound, bracket.UpperBound, bracket.TaxRate, bracket.Level)
+		totalTax += tax
+		steps = append(steps, step)
+	}
+
+	return steps, totalTax
+}
 
-	tax, step = t.calculateStep(salary, 150000, 500000, 0.1, "150,001-500,000")
-	totalTax += tax
-	steps = append(steps, step)
 
-	tax, step = t.calculateStep(salary, 500000, 1000000, 0.15, "500,001-1,000,000")
-	totalTax += tax
-	steps = append(steps, step)
+// calculateTaxRates finds the bracket the taxable income ends in, a taxable
+// income of 0 or less is in the first bracket.
+func (t *TaxService) calculateTaxRates(totalIncome, taxedIncome, totalTax money.Money, brackets []repository.TaxBracket) *TaxRates {
+	var taxRates TaxRates
 
-	tax, step = t.calculateStep(salary, 1000000, 2000000, 0.2, "1,000,001-2,000,000")
-	totalTax += tax
-	steps = append(steps, step)
+	if totalIncome > 0 {
+		taxRates.EffectiveRate = math.Round(float64(totalTax)/float64(totalIncome)*10000) / 10000
+	}
 
-	tax, step = t.calculateStep(salary, 2000000, 0, 0.35, "2,000,001 ขึ้นไป")
-	totalTax += tax
-	steps = append(steps, step)
+	taxedIncome = taxedIncome.Max(0)
+	for i, bracket := range brackets {
+		if i > 0 && taxedIncome <= bracket.LowerBound {
+			break
+		}
+		taxRates.MarginalRate = bracket.TaxRate
+		taxRates.MarginalLevel = bracket.Level
+		taxRates.IncomeToNextBracket = nil
+		if bracket.UpperBound != 0 {
+			incomeToNextBracket := bracket.UpperBound - taxedIncome
+			taxRates.IncomeToNextBracket = &incomeToNextBracket
+		}
+	}
 
-	return steps, totalTax
+	return &taxRates
 }
 
-func roundToTwoDigitNearest(num float64) float64 {
-	return math.Round(num*100) / 100
-}
\ No newline at end of file
+
+// chooseTaxMethod compares the bracket tax with the tax of the gross-income
+// method when the income other than salary is high enough and returns the
+// higher one. Income not given by category counts as salary.
+func (t *TaxService) chooseTaxMethod(explanation *TaxExplanation, bracketTax money.Money) money.Money {
+	explanation.TaxMethod = constant.TAX_METHOD_PROGRESSIVE
+
+	var grossIncome money.Money
+	for _, incomes := range [][]IncomeExplanation{explanation.Incomes, explanation.SpouseIncomes} {
+		for _, categoryIncome := range incomes {
+			if categoryIncome.Category != constant.INCOME_CATEGORY_SALARY {
+				grossIncome += categoryIncome.Amount
+			}
+		}
+	}
+	if grossIncome <= constant.GROSS_INCOME_TAX_MIN_INCOME {
+		return bracketTax
+	}
+
+	grossIncomeTax := grossIncome.MulRate(constant.GROSS_INCOME_TAX_RATE)
+	explanation.GrossIncomeTax = &grossIncomeTax
+	if grossIncomeTax <= constant.GROSS_INCOME_TAX_EXEMPT || grossIncomeTax <= bracketTax {
+		return bracketTax
+	}
+
+	explanation.TaxMethod = constant.TAX_METHOD_GROSS_INCOME
+	return grossIncomeTax
+}
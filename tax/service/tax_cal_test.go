@@ -3,46 +3,144 @@ package service
 import (
 	"testing"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
 )
 
+// defaultTaxBrackets mirrors the brackets seeded in init.sql.
+func defaultTaxBrackets() []repository.TaxBracket {
+	return []repository.TaxBracket{
+		{Level: "0-150,000", LowerBound: 0, UpperBound: money.FromBaht(150000), TaxRate: 0.0},
+		{Level: "150,001-500,000", LowerBound: money.FromBaht(150000), UpperBound: money.FromBaht(500000), TaxRate: 0.1},
+		{Level: "500,001-1,000,000", LowerBound: money.FromBaht(500000), UpperBound: money.FromBaht(1000000), TaxRate: 0.15},
+		{Level: "1,000,001-2,000,000", LowerBound: money.FromBaht(1000000), UpperBound: money.FromBaht(2000000), TaxRate: 0.2},
+		{Level: "2,000,001 ขึ้นไป", LowerBound: money.FromBaht(2000000), UpperBound: 0, TaxRate: 0.35},
+	}
+}
+
 func TestTaxService_calculateTaxTable(t *testing.T) {
 	taxService := TaxService{}
 
 	tests := []struct {
 		name     string
-		salary   float64
-		expected float64
+		salary   money.Money
+		expected money.Money
 	}{
-		{"No Tax", 100000.0, 0.0},
-		{"Tax in first bracket", 440000.0, 29000.0},
-		{"Tax in second bracket", 600000.0, 50000.0},
-		{"Tax in third bracket", 1200000.0, 150000.0},
-		{"Tax in fourth bracket", 2500000.0, 485000.00},
+		{"No Tax", money.FromBaht(100000), 0},
+		{"Tax in first bracket", money.FromBaht(440000), money.FromBaht(29000)},
+		{"Tax in second bracket", money.FromBaht(600000), money.FromBaht(50000)},
+		{"Tax in third bracket", money.FromBaht(1200000), money.FromBaht(150000)},
+		{"Tax in fourth bracket", money.FromBaht(2500000), money.FromBaht(485000)},
+		{"Tax with satang", money.Money(15000035), money.Money(4)},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			_, totalTax := taxService.calculateTaxTable(test.salary)
+			_, totalTax := taxService.calculateTaxTable(test.salary, defaultTaxBrackets())
 			assert.Equal(t, test.expected, totalTax, "For %s: Total tax amount mismatch", test.name)
 		})
 	}
 }
 
+func TestTaxService_calculateTaxTable_Steps(t *testing.T) {
+	taxService := TaxService{}
+
+	brackets := []repository.TaxBracket{
+		{Level: "0-100,000", LowerBound: 0, UpperBound: money.FromBaht(100000), TaxRate: 0.05},
+		{Level: "100,001 ขึ้นไป", LowerBound: money.FromBaht(100000), UpperBound: 0, TaxRate: 0.25},
+	}
+
+	steps, totalTax := taxService.calculateTaxTable(money.FromBaht(300000), brackets)
+
+	assert.Equal(t, money.FromBaht(55000), totalTax)
+	assert.Equal(t, []TaxStep{
+		{Level: "0-100,000", TaxAmount: money.FromBaht(5000)},
+		{Level: "100,001 ขึ้นไป", TaxAmount: money.FromBaht(50000)},
+	}, steps)
+}
+
+func TestTaxService_calculateTaxRates(t *testing.T) {
+	taxService := TaxService{}
+
+	incomeTo := func(baht int64) *money.Money {
+		income := money.FromBaht(baht)
+		return &income
+	}
+
+	tests := []struct {
+		name        string
+		totalIncome money.Money
+		taxedIncome money.Money
+		totalTax    money.Money
+		expected    TaxRates
+	}{
+		{"No income", 0, -money.FromBaht(60000), 0, TaxRates{MarginalRate: 0, MarginalLevel: "0-150,000", IncomeToNextBracket: incomeTo(150000)}},
+		{"Below taxable income", money.FromBaht(100000), money.FromBaht(40000), 0, TaxRates{MarginalRate: 0, MarginalLevel: "0-150,000", IncomeToNextBracket: incomeTo(110000)}},
+		{"On bracket bound", money.FromBaht(210000), money.FromBaht(150000), 0, TaxRates{MarginalRate: 0, MarginalLevel: "0-150,000", IncomeToNextBracket: incomeTo(0)}},
+		{"Second bracket", money.FromBaht(500000), money.FromBaht(440000), money.FromBaht(29000), TaxRates{EffectiveRate: 0.058, MarginalRate: 0.1, MarginalLevel: "150,001-500,000", IncomeToNextBracket: incomeTo(60000)}},
+		{"Top bracket", money.FromBaht(3000000), money.FromBaht(2940000), money.FromBaht(639000), TaxRates{EffectiveRate: 0.213, MarginalRate: 0.35, MarginalLevel: "2,000,001 ขึ้นไป"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taxRates := taxService.calculateTaxRates(test.totalIncome, test.taxedIncome, test.totalTax, defaultTaxBrackets())
+			assert.Equal(t, &test.expected, taxRates)
+		})
+	}
+}
+
+func TestTaxService_chooseTaxMethod(t *testing.T) {
+	taxService := TaxService{}
+
+	taxOf := func(baht int64) *money.Money {
+		tax := money.FromBaht(baht)
+		return &tax
+	}
+
+	tests := []struct {
+		name           string
+		incomes        []IncomeExplanation
+		bracketTax     money.Money
+		expectedTax    money.Money
+		expectedMethod string
+		grossIncomeTax *money.Money
+	}{
+		{"No category", nil, money.FromBaht(1000), money.FromBaht(1000), constant.TAX_METHOD_PROGRESSIVE, nil},
+		{"Salary only", []IncomeExplanation{{Category: "40(1)", Amount: money.FromBaht(5000000)}}, 0, 0, constant.TAX_METHOD_PROGRESSIVE, nil},
+		{"Not above 120,000", []IncomeExplanation{{Category: "40(2)", Amount: money.FromBaht(120000)}}, 0, 0, constant.TAX_METHOD_PROGRESSIVE, nil},
+		{"Gross income higher", []IncomeExplanation{{Category: "40(1)", Amount: money.FromBaht(500000)}, {Category: "40(8)", Amount: money.FromBaht(1200000)}}, money.FromBaht(5000), money.FromBaht(6000), constant.TAX_METHOD_GROSS_INCOME, taxOf(6000)},
+		{"Gross income exempt", []IncomeExplanation{{Category: "40(8)", Amount: money.FromBaht(1000000)}}, 0, 0, constant.TAX_METHOD_PROGRESSIVE, taxOf(5000)},
+		{"Bracket tax higher", []IncomeExplanation{{Category: "40(8)", Amount: money.FromBaht(1200000)}}, money.FromBaht(10000), money.FromBaht(10000), constant.TAX_METHOD_PROGRESSIVE, taxOf(6000)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			explanation := TaxExplanation{Incomes: test.incomes}
+			tax := taxService.chooseTaxMethod(&explanation, test.bracketTax)
+			assert.Equal(t, test.expectedTax, tax)
+			assert.Equal(t, test.expectedMethod, explanation.TaxMethod)
+			assert.Equal(t, test.grossIncomeTax, explanation.GrossIncomeTax)
+		})
+	}
+}
+
 func TestTaxService_calculateStep(t *testing.T) {
 	taxService := TaxService{}
 
 	tests := []struct {
 		name       string
-		income     float64
-		lowerBound float64
-		upperBound float64
+		income     money.Money
+		lowerBound money.Money
+		upperBound money.Money
 		rate       float64
 		level      string
-		expected   float64
+		expected   money.Money
 	}{
-		{"No Tax", 				100000.0, 150000, 	0, 		0, 	 "0-150,000", 0},
-		{"Tax in range", 		120000.0, 0, 		150000, 0.1, "0-150,000", 12000},
-		{"Tax beyond range", 	300000.0, 0, 		150000, 0.1, "0-150,000", 15000},
+		{"No Tax", 				money.FromBaht(100000), money.FromBaht(150000), 	0, 		0, 	 "0-150,000", 0},
+		{"Tax in range", 		money.FromBaht(120000), 0, 		money.FromBaht(150000), 0.1, "0-150,000", money.FromBaht(12000)},
+		{"Tax beyond range", 	money.FromBaht(300000), 0, 		money.FromBaht(150000), 0.1, "0-150,000", money.FromBaht(15000)},
 	}
 
 	for _, test := range tests {
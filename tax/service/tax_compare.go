@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/money"
+)
+
+// CompareTax calculates the base income and every scenario side by side with
+// one tax rule. BestScenario is the scenario saving the most, left empty when
+// none saves anything. Nothing is saved as a filing.
+func (t *TaxService) CompareTax(compareReq *TaxCompareRequest) (*TaxCompareResponse, error) {
+	err := ValidateTaxCompareRequest(compareReq)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	base := compareReq.Base
+	base.applyIncomes()
+	taxRule, err := t.loadTaxRule(base.TaxYear)
+	if err != nil {
+		return nil, err
+	}
+	base.TaxYear = taxRule.TaxYear
+
+	if err := validateComparedRequest(&base, taxRule); err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	compareResponse := TaxCompareResponse{
+		Base:      TaxCompareResult{Request: base, Result: t.calculateTaxWithRule(&base, taxRule)},
+		Scenarios: make([]TaxCompareResult, 0, len(compareReq.Scenarios)),
+	}
+
+	var bestSaving money.Money
+	for _, scenario := range compareReq.Scenarios {
+		taxRequest := scenario.apply(base)
+		if err := validateComparedRequest(&taxRequest, taxRule); err != nil {
+			return nil, apperrs.NewBadRequestError(fmt.Sprintf("scenario %s: %s", scenario.Name, err.Error()))
+		}
+
+		compareResult := TaxCompareResult{
+			Name:    scenario.Name,
+			Request: taxRequest,
+			Result:  t.calculateTaxWithRule(&taxRequest, taxRule),
+		}
+		compareResult.Delta = compareResponse.Base.delta(compareResult)
+
+		if compareResult.Delta.Saving > bestSaving {
+			bestSaving = compareResult.Delta.Saving
+			compareResponse.BestScenario = scenario.Name
+		}
+		compareResponse.Scenarios = append(compareResponse.Scenarios, compareResult)
+	}
+
+	return &compareResponse, nil
+}
+
+func validateComparedRequest(taxRequest *TaxRequest, taxRule *TaxRule) error {
+	if err := ValidateTaxRequest(taxRequest); err != nil {
+		return err
+	}
+	return taxRule.validateTaxRequest(taxRequest)
+}
+
+// apply makes the request of a scenario from the base request.
+func (s TaxScenario) apply(base TaxRequest) TaxRequest {
+	taxRequest := base
+	if s.TotalIncome != nil {
+		taxRequest.TotalIncome = *s.TotalIncome
+	}
+	if s.WHT != nil {
+		taxRequest.WHT = *s.WHT
+	}
+	taxRequest.Allowances = append(append([]Allowance{}, base.Allowances...), s.Allowances...)
+	return taxRequest
+}
+
+func (base TaxCompareResult) delta(scenario TaxCompareResult) *TaxCompareDelta {
+	basePayment := base.Result.Tax - base.Result.TaxRefund
+	scenarioPayment := scenario.Result.Tax - scenario.Result.TaxRefund
+
+	return &TaxCompareDelta{
+		TotalIncome: scenario.Request.TotalIncome - base.Request.TotalIncome,
+		Tax:         scenario.Result.Tax - base.Result.Tax,
+		TaxRefund:   scenario.Result.TaxRefund - base.Result.TaxRefund,
+		Saving:      basePayment - scenarioPayment,
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCompareTax(t *testing.T) {
+	taxService := newTestTaxService()
+	raisedIncome := money.FromBaht(600000)
+
+	compareResponse, err := taxService.CompareTax(&TaxCompareRequest{
+		Base: TaxRequest{TotalIncome: money.FromBaht(500000)},
+		Scenarios: []TaxScenario{
+			{Name: "add 50k k-receipt", Allowances: []Allowance{{AllowanceType: "k-receipt", Amount: money.FromBaht(50000)}}},
+			{Name: "donate 100k more", Allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(100000)}}},
+			{Name: "raise", TotalIncome: &raisedIncome},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, testTaxYear, compareResponse.Base.Request.TaxYear)
+	assert.Equal(t, money.FromBaht(29000), compareResponse.Base.Result.Tax)
+	assert.Nil(t, compareResponse.Base.Delta)
+
+	assert.Len(t, compareResponse.Scenarios, 3)
+	assert.Equal(t, "add 50k k-receipt", compareResponse.Scenarios[0].Name)
+	assert.Equal(t, money.FromBaht(24000), compareResponse.Scenarios[0].Result.Tax)
+	assert.Equal(t, &TaxCompareDelta{Tax: -money.FromBaht(5000), Saving: money.FromBaht(5000)}, compareResponse.Scenarios[0].Delta)
+
+	// the donation is capped at 10% of the 440,000 net income
+	assert.Equal(t, money.FromBaht(24600), compareResponse.Scenarios[1].Result.Tax)
+	assert.Equal(t, &TaxCompareDelta{Tax: -money.FromBaht(4400), Saving: money.FromBaht(4400)}, compareResponse.Scenarios[1].Delta)
+
+	assert.Equal(t, raisedIncome, compareResponse.Scenarios[2].Request.TotalIncome)
+	assert.Equal(t, &TaxCompareDelta{TotalIncome: money.FromBaht(100000), Tax: money.FromBaht(12000), Saving: -money.FromBaht(12000)}, compareResponse.Scenarios[2].Delta)
+
+	assert.Equal(t, "add 50k k-receipt", compareResponse.BestScenario)
+	taxService.filingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestCompareTax_ScenarioOnTopOfBase(t *testing.T) {
+	taxService := newTestTaxService()
+	wht := money.FromBaht(40000)
+
+	compareResponse, err := taxService.CompareTax(&TaxCompareRequest{
+		Base: TaxRequest{TotalIncome: money.FromBaht(500000), WHT: money.FromBaht(30000), Allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(20000)}}},
+		Scenarios: []TaxScenario{
+			// the donations share the cap of 10% of the 440,000 net income
+			{Name: "donate 30k more", Allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(30000)}}},
+			{Name: "more wht", WHT: &wht},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromBaht(27000)-money.FromBaht(30000), -compareResponse.Base.Result.TaxRefund)
+
+	donate := compareResponse.Scenarios[0]
+	assert.Equal(t, []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(20000)}, {AllowanceType: "donation", Amount: money.FromBaht(30000)}}, donate.Request.Allowances)
+	assert.Equal(t, money.FromBaht(5400), donate.Result.TaxRefund)
+	assert.Equal(t, &TaxCompareDelta{TaxRefund: money.FromBaht(2400), Saving: money.FromBaht(2400)}, donate.Delta)
+
+	moreWht := compareResponse.Scenarios[1]
+	assert.Equal(t, money.FromBaht(13000), moreWht.Result.TaxRefund)
+	assert.Equal(t, money.FromBaht(10000), moreWht.Delta.Saving)
+	assert.Equal(t, "more wht", compareResponse.BestScenario)
+
+	// the base request is left as it was
+	assert.Len(t, compareResponse.Base.Request.Allowances, 1)
+}
+
+func TestCompareTax_NoSaving(t *testing.T) {
+	taxService := newTestTaxService()
+
+	compareResponse, err := taxService.CompareTax(&TaxCompareRequest{
+		Base:      TaxRequest{TotalIncome: money.FromBaht(100000)},
+		Scenarios: []TaxScenario{{Name: "donate", Allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(10000)}}}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, money.Money(0), compareResponse.Scenarios[0].Delta.Saving)
+	assert.Empty(t, compareResponse.BestScenario)
+}
+
+func TestCompareTax_InvalidRequest(t *testing.T) {
+	base := TaxRequest{TotalIncome: money.FromBaht(500000)}
+	tooMuchWht := money.FromBaht(600000)
+
+	testCases := []struct {
+		name    string
+		request TaxCompareRequest
+		message string
+	}{
+		{
+			name:    "NoScenarios",
+			request: TaxCompareRequest{Base: base},
+			message: constant.MSG_BU_COMPARE_SCENARIOS_EMPTY,
+		},
+		{
+			name:    "DuplicateName",
+			request: TaxCompareRequest{Base: base, Scenarios: []TaxScenario{{Name: "a"}, {Name: " "}, {Name: "a"}}},
+			message: constant.MSG_BU_COMPARE_SCENARIO_NAME_DUPLICATE + "a; " + constant.MSG_BU_COMPARE_SCENARIO_NAME_EMPTY,
+		},
+		{
+			name:    "TooManyScenarios",
+			request: TaxCompareRequest{Base: base, Scenarios: make([]TaxScenario, constant.TAX_COMPARE_SCENARIOS_MAX+1)},
+			message: "scenarios must not be more than 20; " + constant.MSG_BU_COMPARE_SCENARIO_NAME_EMPTY,
+		},
+		{
+			name:    "InvalidBase",
+			request: TaxCompareRequest{Base: TaxRequest{TotalIncome: money.FromBaht(100), WHT: money.FromBaht(200)}, Scenarios: []TaxScenario{{Name: "a"}}},
+			message: constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME,
+		},
+		{
+			name:    "InvalidScenario",
+			request: TaxCompareRequest{Base: base, Scenarios: []TaxScenario{{Name: "a", WHT: &tooMuchWht}}},
+			message: "scenario a: " + constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME,
+		},
+		{
+			name:    "UnsupportedAllowance",
+			request: TaxCompareRequest{Base: base, Scenarios: []TaxScenario{{Name: "a", Allowances: []Allowance{{AllowanceType: "invalid"}}}}},
+			message: `scenario a: allowanceType "invalid" is not supported, must be one of: donation, donation-education, k-receipt`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taxService := newTestTaxService()
+
+			compareResponse, err := taxService.CompareTax(&tc.request)
+
+			assert.Nil(t, compareResponse)
+			assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+			assert.Equal(t, tc.message, err.(*echo.HTTPError).Message)
+		})
+	}
+}
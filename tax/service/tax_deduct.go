@@ -0,0 +1,246 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+)
+
+func (t *TaxService) GetDeductions(taxYear int) (*DeductionListResponse, error) {
+	taxYear, err := t.resolveTaxYear(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := t.DeductRepo.FindByTaxYear(taxYear, time.Now())
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_LOAD_FAILED)
+	}
+
+	deductions := make([]DeductionResponse, 0, len(configs))
+	for i := range configs {
+		deductions = append(deductions, getDeductionResponse(&configs[i]))
+	}
+
+	return &DeductionListResponse{Deductions: deductions}, nil
+}
+
+func (t *TaxService) GetDeduction(deductType string, taxYear int) (*DeductionResponse, error) {
+	taxYear, err := t.resolveTaxYear(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := t.findDeductConfig(deductType, taxYear, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	deductionResponse := getDeductionResponse(config)
+	return &deductionResponse, nil
+}
+
+func (t *TaxService) CreateDeduction(createReq *CreateDeductRequest) (*DeductionResponse, error) {
+	err := ValidateCreateDeductRequest(createReq)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	taxYear, err := t.resolveTaxYear(createReq.TaxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	capRule := createReq.CapRule
+	if capRule == "" {
+		capRule = constant.DEDUCT_CAP_RULE_MAX
+	}
+
+	multiplier := createReq.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+
+	config := repository.TaxDeductConfig{
+		DeductId:    createReq.DeductType,
+		TaxYear:     taxYear,
+		Amount:      createReq.Amount,
+		MinAmount:   createReq.MinAmount,
+		MaxAmount:   createReq.MaxAmount,
+		CapRule:     capRule,
+		Rate:        createReq.Rate,
+		Multiplier:  multiplier,
+		Description: createReq.Description,
+	}
+
+	err = t.DeductRepo.Create(&config, createReq.CreatedBy)
+	if errors.Is(err, repository.ErrTaxDeductConfigExists) {
+		return nil, apperrs.NewUnprocessableEntity(constant.MSG_BU_DEDUCT_CONFIG_EXISTS + createReq.DeductType)
+	}
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_CREATE_FAILED)
+	}
+
+	deductionResponse := getDeductionResponse(&config)
+	return &deductionResponse, nil
+}
+
+// UpdateDeduction changes the amount of an existing deduction type, the
+// amount must stay within the bounds stored with its config. A change with a
+// future effectiveFrom is only scheduled and picked up by calculations once
+// that time has passed.
+func (t *TaxService) UpdateDeduction(deductType string, updateReq *UpdateDeductRequest) (*UpdateDeductResponse, error) {
+	now := time.Now()
+
+	effectiveFrom := now
+	if updateReq.EffectiveFrom != nil {
+		if updateReq.EffectiveFrom.Before(now) {
+			return nil, apperrs.NewBadRequestError(constant.MSG_BU_INVALID_EFFECTIVE_FROM_IN_PAST)
+		}
+		effectiveFrom = *updateReq.EffectiveFrom
+	}
+
+	taxYear, err := t.resolveTaxYear(updateReq.TaxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := t.findDeductConfig(deductType, taxYear, now)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := updateReq.Amount
+	err = ValidateDeductAmount(amount, config)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	if effectiveFrom.After(now) {
+		return t.scheduleDeduction(deductType, taxYear, amount, updateReq.UpdatedBy, effectiveFrom)
+	}
+
+	updateRow, err := t.DeductRepo.UpdateById(deductType, taxYear, amount, updateReq.UpdatedBy, effectiveFrom)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_UPD_FAILED)
+	}
+
+	if updateRow == 0 {
+		return nil, apperrs.NewUnprocessableEntity(constant.MSG_BU_DEDUCT_UPD_FAILED)
+	}
+
+	d, err := t.DeductRepo.FindById(deductType, taxYear, time.Now())
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_UPD_FAILED)
+	}
+
+	updDeductResponse := UpdateDeductResponse{
+		Amount: d.Amount,
+	}
+
+	return &updDeductResponse, nil
+}
+
+func (t *TaxService) scheduleDeduction(deductType string, taxYear int, amount money.Money, changedBy string, effectiveFrom time.Time) (*UpdateDeductResponse, error) {
+	scheduledRow, err := t.DeductRepo.ScheduleById(deductType, taxYear, amount, changedBy, effectiveFrom)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_UPD_FAILED)
+	}
+
+	if scheduledRow == 0 {
+		return nil, apperrs.NewUnprocessableEntity(constant.MSG_BU_DEDUCT_UPD_FAILED)
+	}
+
+	updDeductResponse := UpdateDeductResponse{
+		Amount:        amount,
+		EffectiveFrom: &effectiveFrom,
+	}
+
+	return &updDeductResponse, nil
+}
+
+func (t *TaxService) findDeductConfig(deductType string, taxYear int, asOf time.Time) (*repository.TaxDeductConfig, error) {
+	config, err := t.DeductRepo.FindById(deductType, taxYear, asOf)
+	if errors.Is(err, repository.ErrTaxDeductConfigNotFound) {
+		return nil, apperrs.NewNotFoundError(constant.MSG_BU_DEDUCT_CONFIG_NOT_FOUND + deductType)
+	}
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_LOAD_FAILED)
+	}
+	return config, nil
+}
+
+func getDeductionResponse(config *repository.TaxDeductConfig) DeductionResponse {
+	return DeductionResponse{
+		DeductType:  config.DeductId,
+		TaxYear:     config.TaxYear,
+		Amount:      config.Amount,
+		MinAmount:   config.MinAmount,
+		MaxAmount:   config.MaxAmount,
+		CapRule:     config.CapRule,
+		Rate:        config.Rate,
+		Multiplier:  config.Multiplier,
+		Description: config.Description,
+	}
+}
+
+// GetAllowanceTypes lists the allowance types that can be claimed in a tax year.
+func (t *TaxService) GetAllowanceTypes(taxYear int) (*AllowanceTypeListResponse, error) {
+	taxYear, err := t.resolveTaxYear(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := t.getAllowanceRegistry(taxYear, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	allowanceTypes := make([]AllowanceRule, 0, len(registry))
+	for _, allowanceType := range registry.Types() {
+		allowanceTypes = append(allowanceTypes, registry[allowanceType])
+	}
+
+	return &AllowanceTypeListResponse{TaxYear: taxYear, AllowanceTypes: allowanceTypes}, nil
+}
+
+func (t *TaxService) GetDeductionHistory(deductType string, taxYear int) (*DeductionHistoryResponse, error) {
+	taxYear, err := t.resolveTaxYear(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.findDeductConfig(deductType, taxYear, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := t.DeductRepo.FindHistoryById(deductType, taxYear)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_LOAD_FAILED)
+	}
+
+	changes := make([]DeductionChange, 0, len(history))
+	for _, h := range history {
+		changes = append(changes, DeductionChange{
+			OldAmount:     h.OldAmount,
+			NewAmount:     h.NewAmount,
+			ChangedBy:     h.ChangedBy,
+			EffectiveFrom: h.EffectiveFrom,
+			ChangedAt:     h.CreatedAt,
+		})
+	}
+
+	return &DeductionHistoryResponse{DeductType: deductType, TaxYear: taxYear, History: changes}, nil
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetDeductions(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	configs := []repository.TaxDeductConfig{
+		{DeductId: "k-receipt", TaxYear: testTaxYear, Amount: money.FromBaht(50000), MinAmount: money.FromBaht(1), MaxAmount: money.FromBaht(100000), Description: "k-receipt allowance"},
+		{DeductId: "personal", TaxYear: testTaxYear, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000), Description: "Personal allowance"},
+	}
+	mockRepo.On("FindByTaxYear", testTaxYear, mock.Anything).Return(configs, nil)
+
+	deductions, err := taxService.GetDeductions(0)
+
+	assert.NoError(t, err)
+	assert.Len(t, deductions.Deductions, 2)
+	assert.Equal(t, DeductionResponse{DeductType: "personal", TaxYear: testTaxYear, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000), Description: "Personal allowance"}, deductions.Deductions[1])
+}
+
+func TestGetDeduction_NotFound(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	notFound := fmt.Errorf("%w for ID: %s tax year: %d", repository.ErrTaxDeductConfigNotFound, "life-insurance", testTaxYear)
+	mockRepo.On("FindById", "life-insurance", testTaxYear, mock.Anything).Return((*repository.TaxDeductConfig)(nil), notFound)
+
+	deduction, err := taxService.GetDeduction("life-insurance", testTaxYear)
+
+	assert.Nil(t, deduction)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+}
+
+func TestCreateDeduction(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	createReq := &CreateDeductRequest{DeductType: "life-insurance", Amount: money.FromBaht(100000), MaxAmount: money.FromBaht(100000), Description: "Life insurance premium", CreatedBy: "admin"}
+
+	expectedConfig := &repository.TaxDeductConfig{DeductId: "life-insurance", TaxYear: testTaxYear, Amount: money.FromBaht(100000), MaxAmount: money.FromBaht(100000), CapRule: constant.DEDUCT_CAP_RULE_MAX, Multiplier: 1, Description: "Life insurance premium"}
+	mockRepo.On("Create", expectedConfig, "admin").Return(nil)
+
+	deduction, err := taxService.CreateDeduction(createReq)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "life-insurance", deduction.DeductType)
+	assert.Equal(t, testTaxYear, deduction.TaxYear)
+	mockRepo.AssertCalled(t, "Create", expectedConfig, "admin")
+}
+
+func TestCreateDeduction_Exists(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockRepo.On("Create", mock.Anything, mock.Anything).Return(repository.ErrTaxDeductConfigExists)
+
+	deduction, err := taxService.CreateDeduction(&CreateDeductRequest{DeductType: "personal", TaxYear: testTaxYear, Amount: money.FromBaht(60000), MaxAmount: money.FromBaht(100000)})
+
+	assert.Nil(t, deduction)
+	assert.EqualError(t, err, apperrs.NewUnprocessableEntity(constant.MSG_BU_DEDUCT_CONFIG_EXISTS+"personal").Error())
+}
+
+func TestCreateDeduction_Invalid(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	deduction, err := taxService.CreateDeduction(&CreateDeductRequest{DeductType: "personal", Amount: money.FromBaht(60000), MinAmount: money.FromBaht(100000), MaxAmount: money.FromBaht(10000)})
+
+	assert.Nil(t, deduction)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestUpdateDeduction(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	config := &repository.TaxDeductConfig{DeductId: "life-insurance", TaxYear: testTaxYear, Amount: money.FromBaht(80000), MaxAmount: money.FromBaht(100000)}
+	mockRepo.On("FindById", "life-insurance", testTaxYear, mock.Anything).Return(config, nil)
+	mockRepo.On("UpdateById", "life-insurance", testTaxYear, money.FromBaht(80000), "admin", mock.AnythingOfType("time.Time")).Return(1, nil)
+
+	updDeductResponse, err := taxService.UpdateDeduction("life-insurance", &UpdateDeductRequest{Amount: money.FromBaht(80000), UpdatedBy: "admin"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromBaht(80000), updDeductResponse.Amount)
+	mockRepo.AssertCalled(t, "UpdateById", "life-insurance", testTaxYear, money.FromBaht(80000), "admin", mock.AnythingOfType("time.Time"))
+}
+
+func TestUpdateDeduction_OutOfBounds(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	config := &repository.TaxDeductConfig{DeductId: "personal", TaxYear: testTaxYear, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000)}
+	mockRepo.On("FindById", "personal", testTaxYear, mock.Anything).Return(config, nil)
+
+	updDeductResponse, err := taxService.UpdateDeduction("personal", &UpdateDeductRequest{Amount: money.FromBaht(100001)})
+
+	assert.Nil(t, updDeductResponse)
+	assert.EqualError(t, err, apperrs.NewBadRequestError("Maximum personal deductibles 100000.00 baht").Error())
+	mockRepo.AssertNotCalled(t, "UpdateById", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateDeduction_LoadFailed(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockRepo.On("FindById", "personal", testTaxYear, mock.Anything).Return((*repository.TaxDeductConfig)(nil), errors.New("connection refused"))
+
+	updDeductResponse, err := taxService.UpdateDeduction("personal", &UpdateDeductRequest{Amount: money.FromBaht(60000)})
+
+	assert.Nil(t, updDeductResponse)
+	assert.EqualError(t, err, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_LOAD_FAILED).Error())
+}
+
+func TestGetDeductionHistory(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	changed := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	oldAmount := money.FromBaht(50000)
+	history := []repository.TaxDeductConfigHistory{
+		{HistoryId: 1, DeductId: "k-receipt", TaxYear: testTaxYear, NewAmount: money.FromBaht(50000), ChangedBy: "init", EffectiveFrom: created, CreatedAt: created},
+		{HistoryId: 7, DeductId: "k-receipt", TaxYear: testTaxYear, OldAmount: &oldAmount, NewAmount: money.FromBaht(70000), ChangedBy: "admin", EffectiveFrom: changed, CreatedAt: changed},
+	}
+	mockRepo.On("FindById", "k-receipt", testTaxYear, mock.Anything).Return(&repository.TaxDeductConfig{DeductId: "k-receipt", TaxYear: testTaxYear}, nil)
+	mockRepo.On("FindHistoryById", "k-receipt", testTaxYear).Return(history, nil)
+
+	historyResponse, err := taxService.GetDeductionHistory("k-receipt", 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &DeductionHistoryResponse{DeductType: "k-receipt", TaxYear: testTaxYear, History: []DeductionChange{
+		{NewAmount: money.FromBaht(50000), ChangedBy: "init", EffectiveFrom: created, ChangedAt: created},
+		{OldAmount: &oldAmount, NewAmount: money.FromBaht(70000), ChangedBy: "admin", EffectiveFrom: changed, ChangedAt: changed},
+	}}, historyResponse)
+}
+
+func TestGetDeductionHistory_NotFound(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockRepo.On("FindById", "unknown", testTaxYear, mock.Anything).Return((*repository.TaxDeductConfig)(nil), repository.ErrTaxDeductConfigNotFound)
+
+	historyResponse, err := taxService.GetDeductionHistory("unknown", testTaxYear)
+
+	assert.Nil(t, historyResponse)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	mockRepo.AssertNotCalled(t, "FindHistoryById", mock.Anything, mock.Anything)
+}
+
+func TestUpdateDeduction_Scheduled(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	effectiveFrom := time.Now().Add(24 * time.Hour)
+	config := &repository.TaxDeductConfig{DeductId: "k-receipt", TaxYear: testTaxYear, Amount: money.FromBaht(50000), MinAmount: money.FromBaht(1), MaxAmount: money.FromBaht(100000)}
+	mockRepo.On("FindById", "k-receipt", testTaxYear, mock.Anything).Return(config, nil)
+	mockRepo.On("ScheduleById", "k-receipt", testTaxYear, money.FromBaht(70000), "admin", effectiveFrom).Return(int64(1), nil)
+
+	updDeductResponse, err := taxService.UpdateDeduction("k-receipt", &UpdateDeductRequest{Amount: money.FromBaht(70000), EffectiveFrom: &effectiveFrom, UpdatedBy: "admin"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &UpdateDeductResponse{Amount: money.FromBaht(70000), EffectiveFrom: &effectiveFrom}, updDeductResponse)
+	mockRepo.AssertNotCalled(t, "UpdateById", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateDeduction_EffectiveFromInPast(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	effectiveFrom := time.Now().Add(-24 * time.Hour)
+
+	updDeductResponse, err := taxService.UpdateDeduction("k-receipt", &UpdateDeductRequest{Amount: money.FromBaht(70000), EffectiveFrom: &effectiveFrom})
+
+	assert.Nil(t, updDeductResponse)
+	assert.EqualError(t, err, apperrs.NewBadRequestError(constant.MSG_BU_INVALID_EFFECTIVE_FROM_IN_PAST).Error())
+	mockRepo.AssertNotCalled(t, "ScheduleById", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
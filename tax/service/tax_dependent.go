@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+)
+
+// DependentRegistry holds the dependent allowance rules of a tax year, keyed
+// by dependent type.
+type DependentRegistry map[string][]repository.TaxDependentRule
+
+func newDependentRegistry(rules []repository.TaxDependentRule) DependentRegistry {
+	registry := DependentRegistry{}
+	for _, rule := range rules {
+		registry[rule.DependentType] = append(registry[rule.DependentType], rule)
+	}
+	return registry
+}
+
+// Types returns the supported dependent types in alphabetical order.
+func (r DependentRegistry) Types() []string {
+	types := make([]string, 0, len(r))
+	for dependentType := range r {
+		types = append(types, dependentType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// needsBirthYear tells whether a rule of the dependent type depends on the
+// birth year.
+func (r DependentRegistry) needsBirthYear(dependentType string) bool {
+	for _, rule := range r[dependentType] {
+		if rule.BornFromYear != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r DependentRegistry) Validate(dependents []Dependent, taxYear int) error {
+	var errMsgs []string
+
+	for _, dependent := range dependents {
+		if _, ok := r[dependent.DependentType]; !ok {
+			errMsgs = append(errMsgs, fmt.Sprintf("dependentType %q is not supported, must be one of: %s", dependent.DependentType, strings.Join(r.Types(), ", ")))
+			continue
+		}
+
+		if dependent.BirthYear < 0 || dependent.BirthYear > taxYear {
+			errMsgs = append(errMsgs, fmt.Sprintf("%s birthYear must be between 1 and %d", dependent.DependentType, taxYear))
+		} else if dependent.BirthYear == 0 && r.needsBirthYear(dependent.DependentType) {
+			errMsgs = append(errMsgs, fmt.Sprintf("%s birthYear is required", dependent.DependentType))
+		}
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
+
+// Explain ranks the dependents of each type oldest first and gives each the
+// highest amount of the rules it meets, 0 when it meets none. Dependents are
+// listed by type in alphabetical order and by rank, nil when there are none.
+// Dependents must have been validated first.
+func (r DependentRegistry) Explain(dependents []Dependent) []DependentExplanation {
+	byType := map[string][]Dependent{}
+	for _, dependent := range dependents {
+		byType[dependent.DependentType] = append(byType[dependent.DependentType], dependent)
+	}
+
+	var explanations []DependentExplanation
+	for _, dependentType := range r.Types() {
+		ranked := byType[dependentType]
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return ranked[i].BirthYear < ranked[j].BirthYear
+		})
+
+		for i, dependent := range ranked {
+			explanations = append(explanations, DependentExplanation{
+				DependentType: dependentType,
+				BirthYear:     dependent.BirthYear,
+				Rank:          i + 1,
+				Accepted:      r.amount(dependent, i+1),
+			})
+		}
+	}
+
+	return explanations
+}
+
+func (r DependentRegistry) amount(dependent Dependent, rank int) money.Money {
+	var amount money.Money
+	for _, rule := range r[dependent.DependentType] {
+		if rank < rule.MinRank {
+			continue
+		}
+		if rule.BornFromYear != nil && dependent.BirthYear < *rule.BornFromYear {
+			continue
+		}
+		if rule.MaxCount != nil && rank > *rule.MaxCount {
+			continue
+		}
+		amount = amount.Max(rule.Amount)
+	}
+	return amount
+}
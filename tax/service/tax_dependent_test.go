@@ -0,0 +1,122 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDependentRegistry_Validate(t *testing.T) {
+	registry := newDependentRegistry(dependentRules(testTaxYear))
+
+	testCases := []struct {
+		name       string
+		dependents []Dependent
+		expected   string
+	}{
+		{
+			name:       "SupportedTypes",
+			dependents: []Dependent{{DependentType: "child", BirthYear: 2019}, {DependentType: "parent"}},
+		},
+		{
+			name:       "UnsupportedType",
+			dependents: []Dependent{{DependentType: "sibling"}},
+			expected:   `dependentType "sibling" is not supported, must be one of: child, disabled, parent`,
+		},
+		{
+			name:       "BirthYearRequired",
+			dependents: []Dependent{{DependentType: "child"}},
+			expected:   "child birthYear is required",
+		},
+		{
+			name:       "BirthYearAfterTaxYear",
+			dependents: []Dependent{{DependentType: "child", BirthYear: 2025}},
+			expected:   "child birthYear must be between 1 and 2024",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := registry.Validate(tc.dependents, testTaxYear)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDependentRegistry_Explain(t *testing.T) {
+	registry := newDependentRegistry(dependentRules(testTaxYear))
+
+	explanations := registry.Explain([]Dependent{
+		{DependentType: "child", BirthYear: 2020},
+		{DependentType: "parent"},
+		{DependentType: "child", BirthYear: 2015},
+		{DependentType: "child", BirthYear: 2016},
+		{DependentType: "parent"},
+		{DependentType: "parent"},
+		{DependentType: "parent"},
+		{DependentType: "parent"},
+	})
+
+	// children rank oldest first, only the fifth parent is over the limit
+	assert.Equal(t, []DependentExplanation{
+		{DependentType: "child", BirthYear: 2015, Rank: 1, Accepted: money.FromBaht(30000)},
+		{DependentType: "child", BirthYear: 2016, Rank: 2, Accepted: money.FromBaht(30000)},
+		{DependentType: "child", BirthYear: 2020, Rank: 3, Accepted: money.FromBaht(60000)},
+		{DependentType: "parent", Rank: 1, Accepted: money.FromBaht(30000)},
+		{DependentType: "parent", Rank: 2, Accepted: money.FromBaht(30000)},
+		{DependentType: "parent", Rank: 3, Accepted: money.FromBaht(30000)},
+		{DependentType: "parent", Rank: 4, Accepted: money.FromBaht(30000)},
+		{DependentType: "parent", Rank: 5, Accepted: 0},
+	}, explanations)
+
+	assert.Nil(t, registry.Explain(nil))
+}
+
+func TestCalculationTax_Dependents(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockDefaultDeductConfig(mockRepo)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome: money.FromBaht(1000000),
+		Dependents: []Dependent{
+			{DependentType: "child", BirthYear: 2015},
+			{DependentType: "child", BirthYear: 2019},
+			{DependentType: "parent"},
+		},
+	})
+
+	assert.NoError(t, err)
+	// 1,000,000 - 60,000 personal - 30,000 - 60,000 children - 30,000 parent
+	assert.Equal(t, money.FromBaht(820000), taxResponse.Explanation.TaxableIncome)
+	assert.Equal(t, money.FromBaht(83000), taxResponse.Tax)
+	assert.Len(t, taxResponse.Explanation.Dependents, 3)
+}
+
+func TestCalculationTax_InvalidDependent(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockDefaultDeductConfig(mockRepo)
+	mockFilingRepo := newMockTaxFilingPort()
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome: money.FromBaht(1000000),
+		Dependents:  []Dependent{{DependentType: "child"}},
+	})
+
+	assert.Nil(t, taxResponse)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.Contains(t, err.Error(), "child birthYear is required")
+	mockFilingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
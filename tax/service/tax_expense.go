@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+)
+
+// ExpenseRegistry holds the expense rules of the income categories of a tax
+// year, keyed by category.
+type ExpenseRegistry map[string]repository.TaxExpenseRule
+
+func newExpenseRegistry(rules []repository.TaxExpenseRule) ExpenseRegistry {
+	registry := ExpenseRegistry{}
+	for _, rule := range rules {
+		registry[rule.Category] = rule
+	}
+	return registry
+}
+
+// Types returns the supported income categories in alphabetical order.
+func (r ExpenseRegistry) Types() []string {
+	types := make([]string, 0, len(r))
+	for category := range r {
+		types = append(types, category)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (r ExpenseRegistry) Validate(incomes []Income) error {
+	var errMsgs []string
+
+	for _, income := range incomes {
+		if _, ok := r[income.Category]; !ok {
+			errMsgs = append(errMsgs, fmt.Sprintf("income category %q is not supported, must be one of: %s", income.Category, strings.Join(r.Types(), ", ")))
+		}
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
+
+// expenseCapKey is the key the limit of a category is shared under.
+func expenseCapKey(rule repository.TaxExpenseRule) string {
+	if rule.CapGroup != "" {
+		return rule.CapGroup
+	}
+	return rule.Category
+}
+
+// limits returns per cap key the lowest max amount of its categories, keys
+// without a limit are left out.
+func (r ExpenseRegistry) limits() map[string]money.Money {
+	limits := map[string]money.Money{}
+	for _, rule := range r {
+		if rule.MaxAmount == nil {
+			continue
+		}
+		limit, ok := limits[expenseCapKey(rule)]
+		if !ok || *rule.MaxAmount < limit {
+			limits[expenseCapKey(rule)] = *rule.MaxAmount
+		}
+	}
+	return limits
+}
+
+// Explain sums the incomes per category and deducts the expense of each
+// category, in alphabetical order of category. Categories sharing a limit use
+// it up in that order. Incomes must have been validated first.
+func (r ExpenseRegistry) Explain(incomes []Income) []IncomeExplanation {
+	amounts := map[string]money.Money{}
+	for _, income := range incomes {
+		amounts[income.Category] += income.Amount
+	}
+
+	var explanations []IncomeExplanation
+	limits := r.limits()
+	for _, category := range r.Types() {
+		amount, ok := amounts[category]
+		if !ok {
+			continue
+		}
+
+		rule := r[category]
+		expense := amount.MulRate(rule.Rate)
+		if limit, ok := limits[expenseCapKey(rule)]; ok {
+			expense = expense.Min(limit)
+			limits[expenseCapKey(rule)] = limit - expense
+		}
+
+		explanations = append(explanations, IncomeExplanation{
+			Category: category,
+			Amount:   amount,
+			Expense:  expense,
+			Net:      amount - expense,
+		})
+	}
+
+	return explanations
+}
+
+// applyIncomes fills in the total income of the taxpayer and of the spouse
+// from their incomes by category when the request leaves it out.
+func (r *TaxRequest) applyIncomes() {
+	r.TotalIncome = totalOfIncomes(r.TotalIncome, r.Incomes)
+	if r.Spouse != nil {
+		r.Spouse.TotalIncome = totalOfIncomes(r.Spouse.TotalIncome, r.Spouse.Incomes)
+	}
+}
+
+func totalOfIncomes(totalIncome money.Money, incomes []Income) money.Money {
+	if totalIncome != 0 || len(incomes) == 0 {
+		return totalIncome
+	}
+	for _, income := range incomes {
+		totalIncome += income.Amount
+	}
+	return totalIncome
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExpenseRegistry_Validate(t *testing.T) {
+	registry := newExpenseRegistry(expenseRules(testTaxYear))
+
+	assert.NoError(t, registry.Validate([]Income{{Category: "40(1)", Amount: money.FromBaht(1)}}))
+	assert.EqualError(t, registry.Validate([]Income{{Category: "40(3)", Amount: money.FromBaht(1)}}),
+		`income category "40(3)" is not supported, must be one of: 40(1), 40(2), 40(5), 40(8)`)
+}
+
+func TestExpenseRegistry_Explain(t *testing.T) {
+	registry := newExpenseRegistry(expenseRules(testTaxYear))
+
+	explanations := registry.Explain([]Income{
+		{Category: "40(8)", Amount: money.FromBaht(100000)},
+		{Category: "40(2)", Amount: money.FromBaht(100000)},
+		{Category: "40(1)", Amount: money.FromBaht(1000000)},
+		{Category: "40(5)", Amount: money.FromBaht(150000)},
+		{Category: "40(1)", Amount: money.FromBaht(200000)},
+	})
+
+	// 40(1) uses up the limit it shares with 40(2)
+	assert.Equal(t, []IncomeExplanation{
+		{Category: "40(1)", Amount: money.FromBaht(1200000), Expense: money.FromBaht(100000), Net: money.FromBaht(1100000)},
+		{Category: "40(2)", Amount: money.FromBaht(100000), Expense: 0, Net: money.FromBaht(100000)},
+		{Category: "40(5)", Amount: money.FromBaht(150000), Expense: money.FromBaht(45000), Net: money.FromBaht(105000)},
+		{Category: "40(8)", Amount: money.FromBaht(100000), Expense: money.FromBaht(60000), Net: money.FromBaht(40000)},
+	}, explanations)
+
+	assert.Nil(t, registry.Explain(nil))
+}
+
+func TestCalculationTax_Incomes(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockDefaultDeductConfig(mockRepo)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	incomeDetail := &TaxRequest{
+		Incomes: []Income{
+			{Category: "40(1)", Amount: money.FromBaht(600000)},
+			{Category: "40(5)", Amount: money.FromBaht(100000)},
+		},
+	}
+	taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+	assert.NoError(t, err)
+	// 700,000 - 100,000 and 30,000 expenses - 60,000 personal
+	assert.Equal(t, money.FromBaht(700000), incomeDetail.TotalIncome)
+	assert.Equal(t, money.FromBaht(510000), taxResponse.Explanation.TaxableIncome)
+	assert.Equal(t, money.FromBaht(36500), taxResponse.Tax)
+	assert.Equal(t, money.FromBaht(500000), taxResponse.Explanation.Incomes[0].Net)
+	assert.Equal(t, money.FromBaht(70000), taxResponse.Explanation.Incomes[1].Net)
+}
+
+func TestCalculationTax_IncomesInvalid(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockDefaultDeductConfig(mockRepo)
+	mockFilingRepo := newMockTaxFilingPort()
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome: money.FromBaht(500000),
+		Incomes: []Income{
+			{Category: "40(1)", Amount: money.FromBaht(600000)},
+			{Category: "40(5)", Amount: -money.FromBaht(1)},
+		},
+	})
+
+	assert.Nil(t, taxResponse)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.Contains(t, err.Error(), constant.MSG_BU_INVALID_TOTAL_INCOME_NOT_SUM_OF_INCOMES)
+	assert.Contains(t, err.Error(), "income 40(5) amount must not be less than 0")
+	mockFilingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestCalculationTax_GrossIncomeMethod(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockDefaultDeductConfig(mockRepo)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		Incomes: []Income{{Category: "40(8)", Amount: money.FromBaht(1200000)}},
+		Allowances: []Allowance{
+			{AllowanceType: "k-receipt", Amount: money.FromBaht(50000)},
+			{AllowanceType: "donation", Amount: money.FromBaht(100000)},
+		},
+		Dependents: []Dependent{{DependentType: "disabled"}, {DependentType: "disabled"}, {DependentType: "disabled"}},
+	})
+
+	assert.NoError(t, err)
+	// 1,200,000 - 720,000 expense - 110,000 allowances - 180,000 dependents
+	// - 19,000 donation capped at 10% leaves 2,100 bracket tax, 0.5% of the
+	// gross income is due instead
+	assert.Equal(t, money.FromBaht(171000), taxResponse.Explanation.TaxableIncome)
+	assert.Equal(t, constant.TAX_METHOD_GROSS_INCOME, taxResponse.Explanation.TaxMethod)
+	assert.Equal(t, money.FromBaht(6000), taxResponse.Explanation.GrossTax)
+	assert.Equal(t, money.FromBaht(6000), taxResponse.Tax)
+	assert.Equal(t, money.FromBaht(2100), taxResponse.TaxStep[1].TaxAmount)
+}
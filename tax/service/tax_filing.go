@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/tax/repository"
+)
+
+// saveTaxFiling stores the calculation together with the tax rule it was
+// computed with, so the figure can be reproduced later.
+func (t *TaxService) saveTaxFiling(taxRequest *TaxRequest, taxResponse *TaxResponse, taxRule *TaxRule) (int64, error) {
+	taxFiling, err := newTaxFiling(taxRequest, taxResponse, taxRule)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return 0, apperrs.NewInternalServerError(constant.MSG_BU_TAX_FILING_SAVE_FAILED)
+	}
+
+	filingId, err := t.FilingRepo.Create(taxFiling)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return 0, apperrs.NewInternalServerError(constant.MSG_BU_TAX_FILING_SAVE_FAILED)
+	}
+
+	return filingId, nil
+}
+
+func newTaxFiling(taxRequest *TaxRequest, taxResponse *TaxResponse, taxRule *TaxRule) (*repository.TaxFiling, error) {
+	// the request is stored with the tax year it was calculated for, so it
+	// replays the same once a newer year is loaded
+	storedRequest := *taxRequest
+	storedRequest.TaxYear = taxRule.TaxYear
+
+	request, err := json.Marshal(storedRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := json.Marshal(taxResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	taxSteps, err := json.Marshal(taxResponse.TaxStep)
+	if err != nil {
+		return nil, err
+	}
+
+	deductConfig, err := json.Marshal(taxRule)
+	if err != nil {
+		return nil, err
+	}
+
+	// a joint return is filed on the income of both spouses
+	totalIncome := taxRequest.TotalIncome
+	if taxRequest.FilingStatus == constant.FILING_STATUS_JOINT && taxRequest.Spouse != nil {
+		totalIncome += taxRequest.Spouse.TotalIncome
+	}
+
+	taxFiling := repository.TaxFiling{
+		TaxYear:      taxRule.TaxYear,
+		TotalIncome:  totalIncome,
+		Tax:          taxResponse.Tax,
+		TaxRefund:    taxResponse.TaxRefund,
+		Request:      request,
+		Response:     response,
+		TaxSteps:     taxSteps,
+		DeductConfig: deductConfig,
+		CreatedAt:    time.Now(),
+	}
+
+	return &taxFiling, nil
+}
+
+func (t *TaxService) GetTaxFilings(query *TaxFilingQuery) (*TaxFilingListResponse, error) {
+	err := ValidateTaxFilingQuery(query)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = constant.TAX_FILING_PAGE_SIZE_DEFAULT
+	}
+
+	// one extra row tells whether there is a next page
+	filter := repository.TaxFilingFilter{
+		CreatedFrom: query.From,
+		CreatedTo:   query.To,
+		MinIncome:   query.MinIncome,
+		MaxIncome:   query.MaxIncome,
+		Outcome:     query.Outcome,
+		Cursor:      query.Cursor,
+		Limit:       limit + 1,
+	}
+
+	filings, err := t.FilingRepo.FindAll(filter)
+	if err != nil {
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_GENERAL_ERROR)
+	}
+
+	listResponse := TaxFilingListResponse{Filings: make([]TaxFilingSummary, 0, limit)}
+	if len(filings) > limit {
+		filings = filings[:limit]
+		listResponse.NextCursor = filings[limit-1].FilingId
+	}
+
+	for _, filing := range filings {
+		listResponse.Filings = append(listResponse.Filings, getTaxFilingSummary(&filing))
+	}
+
+	return &listResponse, nil
+}
+
+func (t *TaxService) GetTaxFiling(id int64) (*TaxFilingResponse, error) {
+	filing, err := t.FilingRepo.FindById(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTaxFilingNotFound) {
+			return nil, apperrs.NewNotFoundError(constant.MSG_BU_TAX_FILING_NOT_FOUND)
+		}
+		t.logger.Error().Msg(err.Error())
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_GENERAL_ERROR)
+	}
+
+	filingResponse := TaxFilingResponse{
+		FilingId:     filing.FilingId,
+		TaxYear:      filing.TaxYear,
+		CreatedAt:    filing.CreatedAt,
+		Request:      filing.Request,
+		Response:     filing.Response,
+		TaxSteps:     filing.TaxSteps,
+		DeductConfig: filing.DeductConfig,
+	}
+
+	return &filingResponse, nil
+}
+
+func getTaxFilingSummary(filing *repository.TaxFiling) TaxFilingSummary {
+	return TaxFilingSummary{
+		FilingId:    filing.FilingId,
+		TaxYear:     filing.TaxYear,
+		TotalIncome: filing.TotalIncome,
+		Tax:         filing.Tax,
+		TaxRefund:   filing.TaxRefund,
+		CreatedAt:   filing.CreatedAt,
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/tax/repository"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTaxFilingPort is a mock implementation of the repository.TaxFilingPort interface.
+type MockTaxFilingPort struct {
+	mock.Mock
+}
+
+func (m *MockTaxFilingPort) Create(filing *repository.TaxFiling) (int64, error) {
+	args := m.Called(filing)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockTaxFilingPort) FindById(id int64) (*repository.TaxFiling, error) {
+	args := m.Called(id)
+	return args.Get(0).(*repository.TaxFiling), args.Error(1)
+}
+
+func (m *MockTaxFilingPort) FindAll(filter repository.TaxFilingFilter) ([]repository.TaxFiling, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]repository.TaxFiling), args.Error(1)
+}
+
+func newMockTaxFilingPort() *MockTaxFilingPort {
+	mockFilingRepo := new(MockTaxFilingPort)
+	mockFilingRepo.On("Create", mock.Anything).Return(int64(1), nil)
+	return mockFilingRepo
+}
+
+func TestCalculationTax_SaveTaxFiling(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockFilingRepo := new(MockTaxFilingPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	incomeDetail := &TaxRequest{
+		TotalIncome: money.FromBaht(500000),
+		Allowances:  []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(200000)}},
+	}
+
+	mockDefaultDeductConfig(mockRepo)
+
+	var saved *repository.TaxFiling
+	mockFilingRepo.On("Create", mock.Anything).Return(int64(42), nil).Run(func(args mock.Arguments) {
+		saved = args.Get(0).(*repository.TaxFiling)
+	})
+
+	taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), taxResponse.FilingId)
+
+	assert.Equal(t, testTaxYear, saved.TaxYear)
+	assert.Equal(t, money.FromBaht(500000), saved.TotalIncome)
+	assert.Equal(t, money.FromBaht(24600), saved.Tax)
+	assert.False(t, saved.CreatedAt.IsZero())
+
+	var taxRule TaxRule
+	assert.NoError(t, json.Unmarshal(saved.DeductConfig, &taxRule))
+	assert.Equal(t, money.FromBaht(60000), taxRule.PersonalAllowance)
+	assert.Equal(t, constant.DEDUCT_CAP_RULE_PERCENT_OF_NET, taxRule.Allowances[constant.DEDUCT_DONATION_ID].CapRule)
+	assert.Equal(t, 0.1, taxRule.Allowances[constant.DEDUCT_DONATION_ID].Rate)
+
+	var taxSteps []TaxStep
+	assert.NoError(t, json.Unmarshal(saved.TaxSteps, &taxSteps))
+	assert.Len(t, taxSteps, len(defaultTaxBrackets()))
+
+	// the latest tax year was used, the request is stored with it
+	expectedRequest := *incomeDetail
+	expectedRequest.TaxYear = testTaxYear
+
+	var request TaxRequest
+	assert.NoError(t, json.Unmarshal(saved.Request, &request))
+	assert.Equal(t, expectedRequest, request)
+	assert.Zero(t, incomeDetail.TaxYear)
+}
+
+func TestCalculationTax_SaveTaxFilingFailed(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockFilingRepo := new(MockTaxFilingPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	incomeDetail := &TaxRequest{TotalIncome: money.FromBaht(500000)}
+
+	mockDefaultDeductConfig(mockRepo)
+	mockFilingRepo.On("Create", mock.Anything).Return(int64(0), errors.New("insert failed"))
+
+	taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+	assert.Nil(t, taxResponse)
+	assert.EqualError(t, err, apperrs.NewInternalServerError(constant.MSG_BU_TAX_FILING_SAVE_FAILED).Error())
+}
+
+func TestGetTaxFilings(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockFilingRepo := new(MockTaxFilingPort)
+	taxService := NewTaxService(logger, new(MockTaxDeductConfigPort), newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	filings := []repository.TaxFiling{
+		{FilingId: 9, TaxYear: 2024, TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000), CreatedAt: createdAt},
+		{FilingId: 8, TaxYear: 2024, TotalIncome: money.FromBaht(600000), Tax: money.FromBaht(40000), CreatedAt: createdAt},
+		{FilingId: 7, TaxYear: 2024, TotalIncome: money.FromBaht(700000), Tax: money.FromBaht(55000), CreatedAt: createdAt},
+	}
+
+	minIncome := money.FromBaht(100000)
+	query := &TaxFilingQuery{MinIncome: &minIncome, Outcome: constant.TAX_FILING_OUTCOME_PAYABLE, Cursor: 10, Limit: 2}
+
+	mockFilingRepo.On("FindAll", repository.TaxFilingFilter{MinIncome: &minIncome, Outcome: constant.TAX_FILING_OUTCOME_PAYABLE, Cursor: 10, Limit: 3}).Return(filings, nil)
+
+	listResponse, err := taxService.GetTaxFilings(query)
+
+	assert.NoError(t, err)
+	assert.Len(t, listResponse.Filings, 2)
+	assert.Equal(t, int64(8), listResponse.NextCursor)
+	assert.Equal(t, TaxFilingSummary{FilingId: 9, TaxYear: 2024, TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000), CreatedAt: createdAt}, listResponse.Filings[0])
+}
+
+func TestGetTaxFilings_LastPage(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockFilingRepo := new(MockTaxFilingPort)
+	taxService := NewTaxService(logger, new(MockTaxDeductConfigPort), newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockFilingRepo.On("FindAll", repository.TaxFilingFilter{Limit: constant.TAX_FILING_PAGE_SIZE_DEFAULT + 1}).Return([]repository.TaxFiling{{FilingId: 1}}, nil)
+
+	listResponse, err := taxService.GetTaxFilings(&TaxFilingQuery{})
+
+	assert.NoError(t, err)
+	assert.Len(t, listResponse.Filings, 1)
+	assert.Zero(t, listResponse.NextCursor)
+}
+
+func TestGetTaxFilings_InvalidQuery(t *testing.T) {
+	logger := &zerolog.Logger{}
+	taxService := NewTaxService(logger, new(MockTaxDeductConfigPort), newMockTaxBracketPort(), new(MockTaxFilingPort), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	listResponse, err := taxService.GetTaxFilings(&TaxFilingQuery{Outcome: "unknown"})
+
+	assert.Nil(t, listResponse)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+}
+
+func TestGetTaxFiling(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockFilingRepo := new(MockTaxFilingPort)
+	taxService := NewTaxService(logger, new(MockTaxDeductConfigPort), newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	filing := &repository.TaxFiling{
+		FilingId:     42,
+		TaxYear:      2024,
+		Request:      []byte(`{"totalIncome":500000.00}`),
+		Response:     []byte(`{"tax":29000.00}`),
+		TaxSteps:     []byte(`[]`),
+		DeductConfig: []byte(`{"personalAllowance":60000.00}`),
+	}
+	mockFilingRepo.On("FindById", int64(42)).Return(filing, nil)
+
+	filingResponse, err := taxService.GetTaxFiling(42)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), filingResponse.FilingId)
+	assert.JSONEq(t, `{"tax":29000.00}`, string(filingResponse.Response))
+	assert.JSONEq(t, `{"personalAllowance":60000.00}`, string(filingResponse.DeductConfig))
+}
+
+func TestGetTaxFiling_NotFound(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockFilingRepo := new(MockTaxFilingPort)
+	taxService := NewTaxService(logger, new(MockTaxDeductConfigPort), newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockFilingRepo.On("FindById", int64(7)).Return((*repository.TaxFiling)(nil), repository.ErrTaxFilingNotFound)
+
+	filingResponse, err := taxService.GetTaxFiling(7)
+
+	assert.Nil(t, filingResponse)
+	assert.EqualError(t, err, apperrs.NewNotFoundError(constant.MSG_BU_TAX_FILING_NOT_FOUND).Error())
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+)
+
+// GrossUp finds the lowest total income that leaves the requested net income
+// after tax, with the brackets and deduction config the calculation uses.
+// Income after tax never falls when the total income rises, so the total
+// income is searched in satang between the net income and a bound doubled
+// until it is high enough. Nothing is saved as a filing.
+func (t *TaxService) GrossUp(grossUpReq *GrossUpRequest) (*GrossUpResponse, error) {
+	err := ValidateGrossUpRequest(grossUpReq)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	taxRequest := TaxRequest{TaxYear: grossUpReq.TaxYear, Allowances: grossUpReq.Allowances}
+	taxRule, err := t.loadTaxRuleFor(&taxRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	netIncome := func(totalIncome money.Money) money.Money {
+		taxRequest.TotalIncome = totalIncome
+		return totalIncome - t.calculateTaxWithRule(&taxRequest, taxRule).Tax
+	}
+
+	target := grossUpReq.NetIncome
+
+	high := target.Max(1)
+	for netIncome(high) < target {
+		if high > constant.GROSS_UP_MAX_INCOME {
+			return nil, apperrs.NewUnprocessableEntity(constant.MSG_BU_GROSS_UP_NOT_SOLVABLE)
+		}
+		high *= 2
+	}
+
+	low := target
+	for low < high {
+		mid := low + (high-low)/2
+		if netIncome(mid) >= target {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+
+	taxRequest.TotalIncome = low
+	taxResponse := t.calculateTaxWithRule(&taxRequest, taxRule)
+
+	return &GrossUpResponse{
+		NetIncome:   low - taxResponse.Tax,
+		TotalIncome: low,
+		TaxResponse: *taxResponse,
+	}, nil
+}
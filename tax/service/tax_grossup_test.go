@@ -0,0 +1,118 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGrossUp(t *testing.T) {
+	testCases := []struct {
+		name        string
+		netIncome   money.Money
+		allowances  []Allowance
+		totalIncome money.Money
+		tax         money.Money
+	}{
+		{name: "BelowTaxableIncome", netIncome: money.FromBaht(200000), totalIncome: money.FromBaht(200000), tax: 0},
+		{name: "SecondBracket", netIncome: money.FromBaht(471000), totalIncome: money.FromBaht(500000), tax: money.FromBaht(29000)},
+		{name: "WithDonation", netIncome: money.FromBaht(475000), allowances: []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(40000)}}, totalIncome: money.FromBaht(500000), tax: money.FromBaht(25000)},
+		{name: "TopBracket", netIncome: money.FromBaht(2361000), totalIncome: money.FromBaht(3000000), tax: money.FromBaht(639000)},
+		{name: "Zero", netIncome: 0, totalIncome: 0, tax: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taxService := newTestTaxService()
+
+			grossUpResponse, err := taxService.GrossUp(&GrossUpRequest{NetIncome: tc.netIncome, Allowances: tc.allowances})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.totalIncome, grossUpResponse.TotalIncome)
+			assert.Equal(t, tc.tax, grossUpResponse.Tax)
+			assert.Equal(t, tc.netIncome, grossUpResponse.NetIncome)
+			assert.Equal(t, testTaxYear, grossUpResponse.TaxYear)
+			assert.Len(t, grossUpResponse.TaxStep, 5)
+			assert.Equal(t, tc.totalIncome, grossUpResponse.Explanation.TotalIncome)
+			taxService.filingRepo.AssertNotCalled(t, "Create", mock.Anything)
+		})
+	}
+}
+
+// the solved total income is the lowest one leaving the net income of the
+// calculation it was derived from
+func TestGrossUp_ReversesCalculation(t *testing.T) {
+	taxService := newTestTaxService()
+	allowances := []Allowance{{AllowanceType: "k-receipt", Amount: money.FromBaht(20000)}}
+
+	for _, totalIncome := range []money.Money{123456_78, 499999_99, 500000_01, 987654_32, 2000000_00, 54321098_76} {
+		taxResponse, err := taxService.CalculateTax(&TaxRequest{TotalIncome: totalIncome, Allowances: allowances})
+		assert.NoError(t, err)
+		netIncome := totalIncome - taxResponse.Tax
+
+		grossUpResponse, err := taxService.GrossUp(&GrossUpRequest{NetIncome: netIncome, Allowances: allowances})
+
+		assert.NoError(t, err)
+		assert.Equal(t, netIncome, grossUpResponse.NetIncome, totalIncome.String())
+		assert.LessOrEqual(t, grossUpResponse.TotalIncome, totalIncome)
+
+		lower, err := taxService.CalculateTax(&TaxRequest{TotalIncome: grossUpResponse.TotalIncome - 1, Allowances: allowances})
+		assert.NoError(t, err)
+		assert.Less(t, grossUpResponse.TotalIncome-1-lower.Tax, netIncome)
+	}
+}
+
+func TestGrossUp_InvalidRequest(t *testing.T) {
+	testCases := []struct {
+		name    string
+		request GrossUpRequest
+		code    int
+		message string
+	}{
+		{name: "NegativeNetIncome", request: GrossUpRequest{NetIncome: -1}, code: http.StatusBadRequest, message: constant.MSG_BU_INVALID_NET_INCOME_LESS_THAN_ZERO},
+		{name: "NetIncomeTooLarge", request: GrossUpRequest{NetIncome: constant.GROSS_UP_MAX_INCOME + 1}, code: http.StatusBadRequest, message: constant.MSG_BU_INVALID_NET_INCOME_TOO_LARGE},
+		{name: "UnsupportedAllowance", request: GrossUpRequest{NetIncome: money.FromBaht(100000), Allowances: []Allowance{{AllowanceType: "invalid", Amount: 0}}}, code: http.StatusBadRequest, message: `allowanceType "invalid" is not supported, must be one of: donation, donation-education, k-receipt`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taxService := newTestTaxService()
+
+			grossUpResponse, err := taxService.GrossUp(&tc.request)
+
+			assert.Nil(t, grossUpResponse)
+			assert.Equal(t, tc.code, err.(*echo.HTTPError).Code)
+			assert.Equal(t, tc.message, err.(*echo.HTTPError).Message)
+		})
+	}
+}
+
+func TestGrossUp_NotSolvable(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockDefaultDeductConfig(mockRepo)
+	mockBracketRepo := new(MockTaxBracketPort)
+	mockBracketRepo.On("FindLatestTaxYear").Return(testTaxYear, nil)
+	// every baht above 150,000 is taxed away, the net income stops at 210,000
+	mockBracketRepo.On("FindByTaxYear", testTaxYear).Return([]repository.TaxBracket{
+		{Level: "0-150,000", LowerBound: 0, UpperBound: money.FromBaht(150000), TaxRate: 0.0},
+		{Level: "150,001 ขึ้นไป", LowerBound: money.FromBaht(150000), UpperBound: 0, TaxRate: 1.0},
+	}, nil)
+	taxService := NewTaxService(logger, mockRepo, mockBracketRepo, newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	grossUpResponse, err := taxService.GrossUp(&GrossUpRequest{NetIncome: money.FromBaht(210000)})
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromBaht(210000), grossUpResponse.TotalIncome)
+
+	_, err = taxService.GrossUp(&GrossUpRequest{NetIncome: money.FromBaht(210001)})
+
+	assert.Equal(t, http.StatusUnprocessableEntity, err.(*echo.HTTPError).Code)
+	assert.Equal(t, constant.MSG_BU_GROSS_UP_NOT_SOLVABLE, err.(*echo.HTTPError).Message)
+}
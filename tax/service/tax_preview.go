@@ -0,0 +1,101 @@
+package service
+
+import (
+	"io"
+	"time"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+)
+
+// PreviewDeduction calculates the sample incomes with the current amount of a
+// deduction type and with the proposed one. Nothing is written to the
+// database, neither the deduction config nor tax filings.
+func (t *TaxService) PreviewDeduction(deductType string, previewReq *DeductPreviewRequest) (*DeductPreviewResponse, error) {
+	if len(previewReq.Incomes) == 0 {
+		return nil, apperrs.NewBadRequestError(constant.MSG_BU_PREVIEW_INCOMES_EMPTY)
+	}
+
+	taxYear, err := t.resolveTaxYear(previewReq.TaxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := t.findDeductConfig(deductType, taxYear, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateDeductAmount(previewReq.Amount, config)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	currentRule, err := t.loadTaxRule(taxYear)
+	if err != nil {
+		return nil, err
+	}
+	proposedRule := currentRule.withDeductAmount(deductType, previewReq.Amount)
+
+	previewResponse := DeductPreviewResponse{
+		DeductType:     deductType,
+		TaxYear:        taxYear,
+		CurrentAmount:  config.Amount,
+		ProposedAmount: previewReq.Amount,
+		Results:        make([]DeductPreviewResult, 0, len(previewReq.Incomes)),
+	}
+
+	for _, income := range previewReq.Incomes {
+		income.TaxYear = taxYear
+		income.applyIncomes()
+
+		if err := ValidateTaxRequest(&income); err != nil {
+			return nil, apperrs.NewBadRequestError(err.Error())
+		}
+		if err := currentRule.validateTaxRequest(&income); err != nil {
+			return nil, apperrs.NewBadRequestError(err.Error())
+		}
+
+		previewResult := DeductPreviewResult{
+			Income: income,
+			Before: *t.calculateTaxWithRule(&income, currentRule),
+			After:  *t.calculateTaxWithRule(&income, proposedRule),
+		}
+		previewResponse.Results = append(previewResponse.Results, previewResult)
+		previewResponse.Summary.add(previewResult)
+	}
+
+	return &previewResponse, nil
+}
+
+// UploadPreviewDeduction previews a deduction change against the incomes of a
+// csv file in the upload format.
+func (t *TaxService) UploadPreviewDeduction(deductType string, file io.Reader, previewReq *DeductPreviewRequest) (*DeductPreviewResponse, error) {
+	allowanceTypes, err := t.csvAllowanceTypes(previewReq.TaxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	taxRequests, err := t.csvParser.ParseCSVToTaxRequest(file, allowanceTypes)
+	if err != nil {
+		t.logger.Debug().Msg(err.Error())
+		return nil, err
+	}
+
+	previewReq.Incomes = *taxRequests
+	return t.PreviewDeduction(deductType, previewReq)
+}
+
+func (s *DeductPreviewSummary) add(previewResult DeductPreviewResult) {
+	before := previewResult.Before
+	after := previewResult.After
+
+	s.Count++
+	s.TaxBefore += before.Tax
+	s.TaxAfter += after.Tax
+	s.TaxDelta = s.TaxAfter - s.TaxBefore
+	s.TaxRefundBefore += before.TaxRefund
+	s.TaxRefundAfter += after.TaxRefund
+	s.TaxRefundDelta = s.TaxRefundAfter - s.TaxRefundBefore
+	s.RevenueDelta = s.TaxDelta - s.TaxRefundDelta
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func mockPreviewDeductConfig(mockRepo *MockTaxDeductConfigPort) {
+	personal := &repository.TaxDeductConfig{DeductId: constant.DEDUCT_PERSONAL_ID, TaxYear: testTaxYear, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000), CapRule: constant.DEDUCT_CAP_RULE_FIXED}
+	mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID, testTaxYear, mock.Anything).Return(personal, nil)
+	mockRepo.On("FindByTaxYear", testTaxYear, mock.Anything).Return(deductConfigs(testTaxYear, money.FromBaht(60000), money.FromBaht(50000), money.FromBaht(100000)), nil)
+	mockRepo.On("FindDependentRules", testTaxYear).Return(dependentRules(testTaxYear), nil)
+	mockRepo.On("FindExpenseRules", testTaxYear).Return(expenseRules(testTaxYear), nil)
+}
+
+func TestPreviewDeduction_Personal(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockFilingRepo := newMockTaxFilingPort()
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockPreviewDeductConfig(mockRepo)
+
+	previewReq := &DeductPreviewRequest{
+		Amount: money.FromBaht(100000),
+		Incomes: []TaxRequest{
+			{TotalIncome: money.FromBaht(500000)},
+			{TotalIncome: money.FromBaht(1000000), WHT: money.FromBaht(100000)},
+		},
+	}
+
+	previewResponse, err := taxService.PreviewDeduction(constant.DEDUCT_PERSONAL_ID, previewReq)
+
+	assert.NoError(t, err)
+	assert.Equal(t, testTaxYear, previewResponse.TaxYear)
+	assert.Equal(t, money.FromBaht(60000), previewResponse.CurrentAmount)
+	assert.Equal(t, money.FromBaht(100000), previewResponse.ProposedAmount)
+	assert.Len(t, previewResponse.Results, 2)
+
+	assert.Equal(t, money.FromBaht(29000), previewResponse.Results[0].Before.Tax)
+	assert.Equal(t, money.FromBaht(25000), previewResponse.Results[0].After.Tax)
+	assert.Equal(t, money.FromBaht(1000), previewResponse.Results[1].Before.Tax)
+	assert.Equal(t, money.FromBaht(5000), previewResponse.Results[1].After.TaxRefund)
+
+	assert.Equal(t, DeductPreviewSummary{
+		Count:           2,
+		TaxBefore:       money.FromBaht(30000),
+		TaxAfter:        money.FromBaht(25000),
+		TaxDelta:        money.FromBaht(-5000),
+		TaxRefundBefore: 0,
+		TaxRefundAfter:  money.FromBaht(5000),
+		TaxRefundDelta:  money.FromBaht(5000),
+		RevenueDelta:    money.FromBaht(-10000),
+	}, previewResponse.Summary)
+
+	mockRepo.AssertNotCalled(t, "UpdateById", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockFilingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestPreviewDeduction_Allowance(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockPreviewDeductConfig(mockRepo)
+	kreceipt := &repository.TaxDeductConfig{DeductId: constant.DEDUCT_K_RECEIPT_ID, TaxYear: testTaxYear, Amount: money.FromBaht(50000), MinAmount: money.FromBaht(1), MaxAmount: money.FromBaht(100000), CapRule: constant.DEDUCT_CAP_RULE_MAX}
+	mockRepo.On("FindById", constant.DEDUCT_K_RECEIPT_ID, testTaxYear, mock.Anything).Return(kreceipt, nil)
+
+	previewReq := &DeductPreviewRequest{
+		Amount: money.FromBaht(100000),
+		Incomes: []TaxRequest{
+			{TotalIncome: money.FromBaht(500000), Allowances: []Allowance{{AllowanceType: constant.DEDUCT_K_RECEIPT_ID, Amount: money.FromBaht(200000)}}},
+		},
+	}
+
+	previewResponse, err := taxService.PreviewDeduction(constant.DEDUCT_K_RECEIPT_ID, previewReq)
+
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromBaht(24000), previewResponse.Results[0].Before.Tax)
+	assert.Equal(t, money.FromBaht(19000), previewResponse.Results[0].After.Tax)
+	assert.Equal(t, money.FromBaht(-5000), previewResponse.Summary.RevenueDelta)
+}
+
+func TestPreviewDeduction_Invalid(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockPreviewDeductConfig(mockRepo)
+
+	testCases := []struct {
+		name       string
+		previewReq *DeductPreviewRequest
+		statusCode int
+	}{
+		{
+			name:       "No incomes",
+			previewReq: &DeductPreviewRequest{Amount: money.FromBaht(100000)},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Amount out of bounds",
+			previewReq: &DeductPreviewRequest{Amount: money.FromBaht(200000), Incomes: []TaxRequest{{TotalIncome: money.FromBaht(500000)}}},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Unsupported allowance",
+			previewReq: &DeductPreviewRequest{Amount: money.FromBaht(100000), Incomes: []TaxRequest{{TotalIncome: money.FromBaht(500000), Allowances: []Allowance{{AllowanceType: "life-insurance", Amount: money.FromBaht(1000)}}}}},
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			previewResponse, err := taxService.PreviewDeduction(constant.DEDUCT_PERSONAL_ID, tc.previewReq)
+
+			assert.Nil(t, previewResponse)
+			assert.Equal(t, tc.statusCode, err.(*echo.HTTPError).Code)
+		})
+	}
+}
+
+func TestUploadPreviewDeduction(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockPreviewDeductConfig(mockRepo)
+
+	csvData := strings.NewReader("totalIncome,wht,donation\n500000,0,0\n")
+
+	previewResponse, err := taxService.UploadPreviewDeduction(constant.DEDUCT_PERSONAL_ID, csvData, &DeductPreviewRequest{Amount: money.FromBaht(100000)})
+
+	assert.NoError(t, err)
+	assert.Len(t, previewResponse.Results, 1)
+	assert.Equal(t, money.FromBaht(-4000), previewResponse.Summary.TaxDelta)
+}
+
+func TestTaxRule_withDeductAmount(t *testing.T) {
+	taxRule := &TaxRule{
+		PersonalAllowance: money.FromBaht(60000),
+		Allowances:        newAllowanceRegistry(deductConfigs(testTaxYear, money.FromBaht(60000), money.FromBaht(50000), money.FromBaht(100000))),
+	}
+
+	proposedRule := taxRule.withDeductAmount(constant.DEDUCT_DONATION_ID, money.FromBaht(80000))
+
+	assert.Equal(t, money.FromBaht(80000), proposedRule.Allowances[constant.DEDUCT_DONATION_ID].Amount)
+	assert.Equal(t, money.FromBaht(100000), taxRule.Allowances[constant.DEDUCT_DONATION_ID].Amount)
+	assert.Equal(t, money.FromBaht(60000), proposedRule.PersonalAllowance)
+
+	proposedRule = taxRule.withDeductAmount(constant.DEDUCT_PERSONAL_ID, money.FromBaht(100000))
+
+	assert.Equal(t, money.FromBaht(100000), proposedRule.PersonalAllowance)
+	assert.Equal(t, money.FromBaht(60000), taxRule.PersonalAllowance)
+}
+
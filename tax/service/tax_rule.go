@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+)
+
+// TaxRule is the rule set of a single tax year: its brackets and the
+// deduction values in effect for that year at AsOf. SpouseAllowance is nil
+// when the year has no spouse allowance configured.
+type TaxRule struct {
+	TaxYear           int                     `json:"taxYear"`
+	AsOf              time.Time               `json:"asOf"`
+	Brackets          []repository.TaxBracket `json:"brackets"`
+	PersonalAllowance money.Money             `json:"personalAllowance"`
+	SpouseAllowance   *money.Money            `json:"spouseAllowance,omitempty"`
+	Allowances        AllowanceRegistry       `json:"allowances"`
+	Dependents        DependentRegistry       `json:"dependents"`
+	Expenses          ExpenseRegistry         `json:"expenses"`
+}
+
+// resolveTaxYear falls back to the latest configured tax year when the
+// request does not specify one.
+func (t *TaxService) resolveTaxYear(taxYear int) (int, error) {
+	if taxYear != 0 {
+		return taxYear, nil
+	}
+
+	latest, err := t.BracketRepo.FindLatestTaxYear()
+	if err != nil {
+		return 0, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BRACKET_CONFIG_NOT_FOUND)
+	}
+	return latest, nil
+}
+
+// loadTaxRule loads the rule set with the deduction values in effect now.
+func (t *TaxService) loadTaxRule(taxYear int) (*TaxRule, error) {
+	asOf := time.Now()
+
+	taxYear, err := t.resolveTaxYear(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	brackets, err := t.getTaxBrackets(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	personalAllowance, err := t.getPersonalAllowance(taxYear, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := t.getDeductConfigs(taxYear, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents, err := t.getDependentRegistry(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	expenses, err := t.getExpenseRegistry(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	taxRule := TaxRule{
+		TaxYear:           taxYear,
+		AsOf:              asOf,
+		Brackets:          brackets,
+		PersonalAllowance: personalAllowance,
+		SpouseAllowance:   findSpouseAllowance(configs),
+		Allowances:        newAllowanceRegistry(configs),
+		Dependents:        dependents,
+		Expenses:          expenses,
+	}
+
+	return &taxRule, nil
+}
+
+func (t *TaxService) getTaxBrackets(taxYear int) ([]repository.TaxBracket, error) {
+	brackets, err := t.BracketRepo.FindByTaxYear(taxYear)
+	if err != nil {
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BRACKET_CONFIG_NOT_FOUND)
+	}
+	if len(brackets) == 0 {
+		return nil, apperrs.NewBadRequestError(constant.MSG_BU_TAX_RULE_NOT_FOUND_FOR_YEAR + strconv.Itoa(taxYear))
+	}
+	return brackets, nil
+}
+
+func (t *TaxService) getPersonalAllowance(taxYear int, asOf time.Time) (money.Money, error) {
+	personAllowance, err := t.DeductRepo.FindById(constant.DEDUCT_PERSONAL_ID, taxYear, asOf)
+	if err != nil {
+		return 0, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_PERSONAL_CONFIG_NOT_FOUND)
+	}
+	return personAllowance.Amount, nil
+}
+
+func (t *TaxService) getDeductConfigs(taxYear int, asOf time.Time) ([]repository.TaxDeductConfig, error) {
+	configs, err := t.DeductRepo.FindByTaxYear(taxYear, asOf)
+	if err != nil {
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_LOAD_FAILED)
+	}
+	return configs, nil
+}
+
+func (t *TaxService) getAllowanceRegistry(taxYear int, asOf time.Time) (AllowanceRegistry, error) {
+	configs, err := t.getDeductConfigs(taxYear, asOf)
+	if err != nil {
+		return nil, err
+	}
+	return newAllowanceRegistry(configs), nil
+}
+
+func (t *TaxService) getDependentRegistry(taxYear int) (DependentRegistry, error) {
+	rules, err := t.DeductRepo.FindDependentRules(taxYear)
+	if err != nil {
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEPENDENT_RULE_LOAD_FAILED)
+	}
+	return newDependentRegistry(rules), nil
+}
+
+func (t *TaxService) getExpenseRegistry(taxYear int) (ExpenseRegistry, error) {
+	rules, err := t.DeductRepo.FindExpenseRules(taxYear)
+	if err != nil {
+		return nil, apperrs.NewInternalServerError(constant.MSG_BU_EXPENSE_RULE_LOAD_FAILED)
+	}
+	return newExpenseRegistry(rules), nil
+}
+
+func findSpouseAllowance(configs []repository.TaxDeductConfig) *money.Money {
+	for _, config := range configs {
+		if config.DeductId == constant.DEDUCT_SPOUSE_ID {
+			spouseAllowance := config.Amount
+			return &spouseAllowance
+		}
+	}
+	return nil
+}
+
+// validateTaxRequest checks the income categories, the claimed allowances of
+// the taxpayer and the spouse and the dependents against the types of the
+// rule, a joint or separate filing also needs the spouse allowance to be
+// configured.
+func (r *TaxRule) validateTaxRequest(taxRequest *TaxRequest) error {
+	var errMsgs []string
+
+	if err := r.Allowances.Validate(taxRequest.Allowances); err != nil {
+		errMsgs = append(errMsgs, err.Error())
+	}
+
+	if err := r.Expenses.Validate(taxRequest.Incomes); err != nil {
+		errMsgs = append(errMsgs, err.Error())
+	}
+
+	if err := r.Dependents.Validate(taxRequest.Dependents, r.TaxYear); err != nil {
+		errMsgs = append(errMsgs, err.Error())
+	}
+
+	if taxRequest.Spouse != nil {
+		if err := r.Allowances.Validate(taxRequest.Spouse.Allowances); err != nil {
+			errMsgs = append(errMsgs, "spouse "+err.Error())
+		}
+		if err := r.Expenses.Validate(taxRequest.Spouse.Incomes); err != nil {
+			errMsgs = append(errMsgs, "spouse "+err.Error())
+		}
+		if r.SpouseAllowance == nil {
+			errMsgs = append(errMsgs, constant.MSG_BU_DEDUCT_SPOUSE_CONFIG_NOT_FOUND+strconv.Itoa(r.TaxYear))
+		}
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
+
+// withDeductAmount returns a copy of the rule with the amount of one deduction
+// type replaced, the original rule is left untouched.
+func (r *TaxRule) withDeductAmount(deductType string, amount money.Money) *TaxRule {
+	taxRule := *r
+
+	if deductType == constant.DEDUCT_PERSONAL_ID {
+		taxRule.PersonalAllowance = amount
+	}
+	if deductType == constant.DEDUCT_SPOUSE_ID && r.SpouseAllowance != nil {
+		taxRule.SpouseAllowance = &amount
+	}
+
+	taxRule.Allowances = make(AllowanceRegistry, len(r.Allowances))
+	for allowanceType, rule := range r.Allowances {
+		if allowanceType == deductType {
+			rule.Amount = amount
+		}
+		taxRule.Allowances[allowanceType] = rule
+	}
+
+	return &taxRule
+}
@@ -2,9 +2,11 @@ package service
 
 import (
 	"io"
+	"time"
 
 	"github.com/meteedev/assessment-tax/apperrs"
 	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
 	"github.com/meteedev/assessment-tax/tax/repository"
 	"github.com/rs/zerolog"
 )
@@ -12,80 +14,164 @@ import (
 type TaxService struct {
 	logger     	*zerolog.Logger
 	DeductRepo 	repository.TaxDeductConfigPort
+	BracketRepo	repository.TaxBracketPort
+	FilingRepo	repository.TaxFilingPort
+	BatchRepo	repository.TaxBatchPort
 	csvParser 	CSVParser
+	xlsxParser	XLSXParser
+	batchQueued	chan struct{} // wakes the batch runner when a job is queued
+	batchWorkerId	string // claims the batch jobs this server runs
+	batchLease	time.Duration
+	batchPollInterval	time.Duration
 }
 
 type CSVParser interface {
-	ParseCSVToTaxRequest(file io.Reader) (*[]TaxRequest, error)
+	ParseCSVToTaxRequest(file io.Reader, allowanceTypes []string) (*[]TaxRequest, error)
+	ParseCSVToTaxUploadRows(file io.Reader, allowanceTypes []string) (*TaxUploadFile, error)
+	NewCSVTaxUploadReader(file io.Reader, allowanceTypes []string) (TaxUploadReader, error)
 }
 
-func NewTaxService(logger *zerolog.Logger, deductRepo repository.TaxDeductConfigPort,csvParser CSVParser) TaxServicePort {
+// TaxUploadReader reads an upload file row by row, Read returns io.EOF after
+// the last row.
+type TaxUploadReader interface {
+	Header() []string
+	IgnoredColumns() []string
+	Read() (*TaxUploadRow, error)
+	Close() error
+}
+
+func NewTaxService(logger *zerolog.Logger, deductRepo repository.TaxDeductConfigPort,bracketRepo repository.TaxBracketPort,filingRepo repository.TaxFilingPort,batchRepo repository.TaxBatchPort,csvParser CSVParser) TaxServicePort {
 	return &TaxService{
 		logger:     logger,
 		DeductRepo: deductRepo,
+		BracketRepo: bracketRepo,
+		FilingRepo: filingRepo,
+		BatchRepo: batchRepo,
 		csvParser: csvParser,
+		xlsxParser: &XLSXParserImpl{},
+		batchQueued: make(chan struct{}, 1),
+		batchWorkerId: newTaxBatchWorkerId(),
+		batchLease: taxBatchLease,
+		batchPollInterval: taxBatchPollInterval,
 	}
 }
 
 func (t *TaxService) CalculationTax(incomeDetail *TaxRequest) (*TaxResponse, error) {
+	incomeDetail.applyIncomes()
+
 	err := ValidateTaxRequest(incomeDetail)
 	if err != nil {
 		return nil, apperrs.NewBadRequestError(err.Error())
 	}
 
-	taxResponse, err := t.CalculateTax(incomeDetail)
+	taxRule, err := t.loadTaxRuleFor(incomeDetail)
 	if err != nil {
 		t.logger.Error().Err(err).Msgf("Error occurred during tax calculation: %v", err)
 		return nil, err
 	}
 
-	t.logger.Info().Msgf("Income: %.2f, Tax Amount: %.2f", incomeDetail.TotalIncome, taxResponse.Tax)
+	taxResponse := t.calculateTaxWithRule(incomeDetail, taxRule)
+
+	filingId, err := t.saveTaxFiling(incomeDetail, taxResponse, taxRule)
+	if err != nil {
+		return nil, err
+	}
+	taxResponse.FilingId = filingId
+
+	t.logger.Info().Msgf("Filing: %d, Income: %s, Tax Amount: %s", filingId, incomeDetail.TotalIncome, taxResponse.Tax)
 	return taxResponse, nil
 }
 
 func (t *TaxService) CalculateTax(incomeDetail *TaxRequest) (*TaxResponse, error) {
-	income := incomeDetail.TotalIncome
-	allowances := incomeDetail.Allowances
-	wht := incomeDetail.WHT
+	taxRule, err := t.loadTaxRuleFor(incomeDetail)
+	if err != nil {
+		return nil, err
+	}
 
-	t.logger.Debug().Msgf("Calculating tax for income: %.2f", income)
+	return t.calculateTaxWithRule(incomeDetail, taxRule), nil
+}
 
-	taxedIncome, err := t.deductPersonalAllowance(income)
+// loadTaxRuleFor loads the tax rule of the request's tax year and checks the
+// request against the deductions configured for that year.
+func (t *TaxService) loadTaxRuleFor(incomeDetail *TaxRequest) (*TaxRule, error) {
+	taxRule, err := t.loadTaxRule(incomeDetail.TaxYear)
 	if err != nil {
-		return nil, apperrs.NewInternalServerError(constant.MSG_BU_GENERAL_ERROR)
+		return nil, err
 	}
-	t.logger.Debug().Msgf("Taxed income (%.2f) after deductPersonalAllowance", taxedIncome)
 
-	taxedIncome, err = t.deductAllowance(taxedIncome, allowances)
+	err = taxRule.validateTaxRequest(incomeDetail)
 	if err != nil {
-		return nil, apperrs.NewInternalServerError(constant.MSG_BU_GENERAL_ERROR)
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	return taxRule, nil
+}
+
+func (t *TaxService) calculateTaxWithRule(incomeDetail *TaxRequest, taxRule *TaxRule) *TaxResponse {
+	if incomeDetail.Spouse != nil {
+		return t.calculateSpouseTax(incomeDetail, taxRule)
 	}
-	t.logger.Debug().Msgf("Taxed income (%.2f) after deductAllowance", taxedIncome)
+
+	explanation := newTaxpayerExplanation(incomeDetail, taxRule)
+	return t.calculateTaxReturn(&explanation, taxRule)
+}
+
+// newTaxpayerExplanation starts the explanation of the taxpayer's own return.
+func newTaxpayerExplanation(incomeDetail *TaxRequest, taxRule *TaxRule) TaxExplanation {
+	return TaxExplanation{
+		TotalIncome:       incomeDetail.TotalIncome,
+		Incomes:           taxRule.Expenses.Explain(incomeDetail.Incomes),
+		PersonalAllowance: taxRule.PersonalAllowance,
+		Allowances:        taxRule.Allowances.Explain(incomeDetail.Allowances),
+		Dependents:        taxRule.Dependents.Explain(incomeDetail.Dependents),
+		WHT:               incomeDetail.WHT,
+	}
+}
+
+// calculateTaxReturn taxes the total income of the explanation less its
+// allowances and fills in the taxable income and gross tax.
+func (t *TaxService) calculateTaxReturn(explanation *TaxExplanation, taxRule *TaxRule) *TaxResponse {
+	income := explanation.TotalIncome
+
+	t.logger.Debug().Msgf("Calculating tax for income: %s", income)
+
+	taxedIncome := t.deductExpenses(income, explanation)
+	t.logger.Debug().Msgf("Taxed income (%s) after deductExpenses", taxedIncome)
+
+	taxedIncome = t.deductPersonalAllowance(taxedIncome, explanation)
+	t.logger.Debug().Msgf("Taxed income (%s) after deductPersonalAllowance", taxedIncome)
+
+	taxedIncome = t.deductAllowance(taxedIncome, explanation, taxRule)
+	t.logger.Debug().Msgf("Taxed income (%s) after deductAllowance", taxedIncome)
 
 	// calculate tax table
-	taxStep , totalTax := t.calculateTaxTable(taxedIncome)
+	taxStep , totalTax := t.calculateTaxTable(taxedIncome, taxRule.Brackets)
+	totalTax = t.chooseTaxMethod(explanation, totalTax)
 	
-	taxDiff := t.deductWht(totalTax, wht)
+	taxDiff := t.deductWht(totalTax, explanation.WHT)
 	
 	taxResponse := getTaxResponse(taxDiff,taxStep)
+	taxResponse.TaxYear = taxRule.TaxYear
+	explanation.TaxableIncome = taxedIncome.Max(0)
+	explanation.GrossTax = totalTax
+	taxResponse.Explanation = explanation
+	taxResponse.Rates = t.calculateTaxRates(income, taxedIncome, totalTax, taxRule.Brackets)
 
-	return &taxResponse, nil
+	return &taxResponse
 }
 
-func getTaxResponse(taxDiff float64,taxStep []TaxStep) TaxResponse {
-	
-	taxDiff2Digit := roundToTwoDigitNearest(taxDiff)
+func getTaxResponse(taxDiff money.Money,taxStep []TaxStep) TaxResponse {
 
 	taxResponse := TaxResponse{
 		TaxStep: taxStep,
 	}
 
 	if taxDiff < 0 {
-		taxResponse.TaxRefund = taxDiff2Digit * (-1)
+		taxResponse.TaxRefund = taxDiff.Abs()
 		taxResponse.Tax = 0
 	} else {
 		taxResponse.TaxRefund = 0
-		taxResponse.Tax = taxDiff2Digit
+		taxResponse.Tax = taxDiff
 	}
 
 	return taxResponse
@@ -93,141 +179,57 @@ func getTaxResponse(taxDiff float64,taxStep []TaxStep) TaxResponse {
 
 
 func (t *TaxService) UpdatePersonalAllowance(updateReq *UpdateDeductRequest) (*UpdateDeductResponse, error) {
-	amount := updateReq.Amount
-
-	err := ValidatePersonaAllowance(amount)
-	if err != nil {
-		return nil, apperrs.NewBadRequestError(err.Error())
-	}
-
-	deductId := constant.DEDUCT_PERSONAL_ID
-	updateRow, err := t.DeductRepo.UpdateById(deductId, amount)
-	if err != nil {
-		t.logger.Error().Msg(err.Error())
-		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_UPD_PERSONAL_FAILED)
-	}
-
-	if updateRow == 0 {
-		return nil, apperrs.NewUnprocessableEntity(constant.MSG_BU_DEDUCT_UPD_PERSONAL_FAILED)
-	}
-
-	d, err := t.DeductRepo.FindById(deductId)
-	if err != nil {
-		t.logger.Error().Msg(err.Error())
-		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_UPD_PERSONAL_FAILED)
-	}
-
-	updDeductResponse := UpdateDeductResponse{
-		Amount: d.Amount,
-	}
-
-	return &updDeductResponse, nil
+	return t.UpdateDeduction(constant.DEDUCT_PERSONAL_ID, updateReq)
 }
 
 func (t *TaxService) UpdateKreceiptAllowance(updateReq *UpdateDeductRequest) (*UpdateDeductResponse, error) {
-	amount := updateReq.Amount
-
-	err := ValidateKreceiptAllowance(amount)
-	if err != nil {
-		return nil, apperrs.NewBadRequestError(err.Error())
-	}
-
-	deductId := constant.DEDUCT_K_RECEIPT_ID
-	updateRow, err := t.DeductRepo.UpdateById(deductId, amount)
-	if err != nil {
-		t.logger.Error().Msg(err.Error())
-		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_UPD_PERSONAL_FAILED)
-	}
-
-	if updateRow == 0 {
-		return nil, apperrs.NewUnprocessableEntity(constant.MSG_BU_DEDUCT_UPD_PERSONAL_FAILED)
-	}
-
-	d, err := t.DeductRepo.FindById(deductId)
-	if err != nil {
-		t.logger.Error().Msg(err.Error())
-		return nil, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_UPD_PERSONAL_FAILED)
-	}
-
-	updDeductResponse := UpdateDeductResponse{
-		Amount: d.Amount,
-	}
-
-	return &updDeductResponse, nil
+	return t.UpdateDeduction(constant.DEDUCT_K_RECEIPT_ID, updateReq)
 }
 
-func (t *TaxService) getPersonalAllowance() (float64, error) {
-	personAllowance, err := t.DeductRepo.FindById(constant.DEDUCT_PERSONAL_ID)
-	if err != nil {
-		return 0, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_PERSONAL_CONFIG_NOT_FOUND)
+func (t *TaxService) deductExpenses(income money.Money, explanation *TaxExplanation) money.Money {
+	taxedIncome := income
+	for _, incomes := range [][]IncomeExplanation{explanation.Incomes, explanation.SpouseIncomes} {
+		for _, categoryIncome := range incomes {
+			taxedIncome -= categoryIncome.Expense
+		}
 	}
-	return personAllowance.Amount, nil
+	return taxedIncome
 }
 
-func (t *TaxService) getKreceiptAllowance() (float64, error) {
-	kreceiptAllowance, err := t.DeductRepo.FindById(constant.DEDUCT_K_RECEIPT_ID)
-	if err != nil {
-		return 0, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_K_RECEIPT_CONFIG_NOT_FOUND)
-	}
-	return kreceiptAllowance.Amount, nil
+func (t *TaxService) deductPersonalAllowance(income money.Money, explanation *TaxExplanation) money.Money {
+	taxedIncome := income - explanation.PersonalAllowance - explanation.SpouseAllowance
+	return taxedIncome
 }
 
-func (t *TaxService) adjustMaximumKreceiptAllowanceDeduct(allowance float64) (float64, error) {
-	kreciptAllowanceConfig, err := t.getKreceiptAllowance()
-	if err != nil {
-		return 0, err
-	}
-
-	if allowance > kreciptAllowanceConfig {
-		return kreciptAllowanceConfig, nil
-	}
-	return allowance, nil
-}
+// deductAllowance deducts the allowances capped on the net income last, from
+// the income left after all other allowances.
+func (t *TaxService) deductAllowance(income money.Money, explanation *TaxExplanation, taxRule *TaxRule) money.Money {
+	taxedIncome := income
+	var netIncomeCapped []*AllowanceExplanation
 
-func (t *TaxService) deductPersonalAllowance(income float64) (float64, error) {
-	personalAllowance, err := t.getPersonalAllowance()
-	if err != nil {
-		return 0, err
-	}
-	taxedIncome := income - personalAllowance
-	return taxedIncome, nil
-}
-
-func (t *TaxService) deductAllowance(income float64, allowances []Allowance) (float64, error) {
-	totalAllowance := 0.0
-	for _, allowance := range allowances {
-		switch allowance.AllowanceType {
-		case constant.DEDUCT_DONATION_ID:
-			totalAllowance += t.adjustMaximumDonationAllowanceDeduct(allowance.Amount)
-		case constant.DEDUCT_K_RECEIPT_ID:
-			krecieptAdjust, err := t.adjustMaximumKreceiptAllowanceDeduct(allowance.Amount)
-			if err != nil {
-				return 0, err
+	for _, allowances := range [][]AllowanceExplanation{explanation.Allowances, explanation.SpouseAllowances} {
+		for i := range allowances {
+			if taxRule.Allowances.cappedByNetIncome(allowances[i].AllowanceType) {
+				netIncomeCapped = append(netIncomeCapped, &allowances[i])
+				continue
 			}
-			totalAllowance += krecieptAdjust
+			taxedIncome -= allowances[i].Accepted
 		}
 	}
-	taxedIncome := income - totalAllowance
-	return taxedIncome, nil
+	for _, dependent := range explanation.Dependents {
+		taxedIncome -= dependent.Accepted
+	}
+
+	return taxRule.Allowances.deductFromNetIncome(taxedIncome, netIncomeCapped)
 }
 
-func (t *TaxService) deductWht(taxAmount float64, wht float64) float64 {
+func (t *TaxService) deductWht(taxAmount money.Money, wht money.Money) money.Money {
 	taxDiff := taxAmount - wht
 	return taxDiff
 }
 
 
 
-func (t *TaxService) adjustMaximumDonationAllowanceDeduct(allowance float64) float64 {
-	if allowance > constant.MAX_ALLOWANCE_DONATION_DEDUCT {
-		return constant.MAX_ALLOWANCE_DONATION_DEDUCT
-	}
-	return allowance
-}
-
-
-
-
 func getTaxUpload(taxRequest *TaxRequest, taxResponse *TaxResponse) TaxUpload {
 	
 	taxUpload := TaxUpload{
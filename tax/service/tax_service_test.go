@@ -3,10 +3,13 @@ package service
 import (
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/meteedev/assessment-tax/money"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/meteedev/assessment-tax/apperrs"
 	"github.com/meteedev/assessment-tax/constant"
 	"github.com/meteedev/assessment-tax/tax/repository"
 	"github.com/rs/zerolog"
@@ -17,37 +20,219 @@ type MockTaxDeductConfigPort struct {
     mock.Mock
 }
 
-func (m *MockTaxDeductConfigPort) FindById(id string) (*repository.TaxDeductConfig, error) {
-    args := m.Called(id)
+func (m *MockTaxDeductConfigPort) FindById(id string, taxYear int, asOf time.Time) (*repository.TaxDeductConfig, error) {
+    args := m.Called(id, taxYear, asOf)
     return args.Get(0).(*repository.TaxDeductConfig), args.Error(1)
 }
 
 
 
-func (m *MockTaxDeductConfigPort) UpdateById(id string, amount float64) (int64, error) {
-    args := m.Called(id, amount)
+func (m *MockTaxDeductConfigPort) FindByTaxYear(taxYear int, asOf time.Time) ([]repository.TaxDeductConfig, error) {
+    args := m.Called(taxYear, asOf)
+    return args.Get(0).([]repository.TaxDeductConfig), args.Error(1)
+}
+
+func (m *MockTaxDeductConfigPort) FindDependentRules(taxYear int) ([]repository.TaxDependentRule, error) {
+    args := m.Called(taxYear)
+    return args.Get(0).([]repository.TaxDependentRule), args.Error(1)
+}
+
+func (m *MockTaxDeductConfigPort) FindExpenseRules(taxYear int) ([]repository.TaxExpenseRule, error) {
+    args := m.Called(taxYear)
+    return args.Get(0).([]repository.TaxExpenseRule), args.Error(1)
+}
+
+func (m *MockTaxDeductConfigPort) Create(config *repository.TaxDeductConfig, changedBy string) error {
+    args := m.Called(config, changedBy)
+    return args.Error(0)
+}
+
+func (m *MockTaxDeductConfigPort) ScheduleById(id string, taxYear int, amount money.Money, changedBy string, effectiveFrom time.Time) (int64, error) {
+    args := m.Called(id, taxYear, amount, changedBy, effectiveFrom)
+    return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockTaxDeductConfigPort) FindHistoryById(id string, taxYear int) ([]repository.TaxDeductConfigHistory, error) {
+    args := m.Called(id, taxYear)
+    return args.Get(0).([]repository.TaxDeductConfigHistory), args.Error(1)
+}
+
+func (m *MockTaxDeductConfigPort) UpdateById(id string, taxYear int, amount money.Money, changedBy string, effectiveFrom time.Time) (int64, error) {
+    args := m.Called(id, taxYear, amount, changedBy, effectiveFrom)
 	return 1, args.Error(1)
 }
 
+// MockTaxBracketPort is a mock implementation of the repository.TaxBracketPort interface.
+type MockTaxBracketPort struct {
+    mock.Mock
+}
+
+func (m *MockTaxBracketPort) FindByTaxYear(taxYear int) ([]repository.TaxBracket, error) {
+    args := m.Called(taxYear)
+    return args.Get(0).([]repository.TaxBracket), args.Error(1)
+}
+
+func (m *MockTaxBracketPort) FindLatestTaxYear() (int, error) {
+    args := m.Called()
+    return args.Int(0), args.Error(1)
+}
+
+const testTaxYear = 2024
+
+func newMockTaxBracketPort() *MockTaxBracketPort {
+    mockBracketRepo := new(MockTaxBracketPort)
+    mockBracketRepo.On("FindLatestTaxYear").Return(testTaxYear, nil)
+    mockBracketRepo.On("FindByTaxYear", testTaxYear).Return(defaultTaxBrackets(), nil)
+    return mockBracketRepo
+}
+
+// deductConfigs builds the tax_deduct_config rows of a tax year.
+func deductConfigs(taxYear int, personal, kreceipt, donation money.Money) []repository.TaxDeductConfig {
+    return []repository.TaxDeductConfig{
+        {DeductId: constant.DEDUCT_DONATION_ID, TaxYear: taxYear, Amount: donation, CapRule: constant.DEDUCT_CAP_RULE_MAX, Description: "Donation allowance"},
+        {DeductId: constant.DEDUCT_K_RECEIPT_ID, TaxYear: taxYear, Amount: kreceipt, CapRule: constant.DEDUCT_CAP_RULE_MAX, Description: "k-receipt allowance"},
+        {DeductId: constant.DEDUCT_PERSONAL_ID, TaxYear: taxYear, Amount: personal, CapRule: constant.DEDUCT_CAP_RULE_FIXED, Description: "Personal allowance"},
+    }
+}
+
+// dependentRules builds the tax_dependent_rule rows seeded in init.sql.
+func dependentRules(taxYear int) []repository.TaxDependentRule {
+    bornFromYear, maxParents := 2018, 4
+    return []repository.TaxDependentRule{
+        {RuleId: 1, DependentType: "child", TaxYear: taxYear, Amount: money.FromBaht(30000), MinRank: 1},
+        {RuleId: 2, DependentType: "child", TaxYear: taxYear, Amount: money.FromBaht(60000), MinRank: 2, BornFromYear: &bornFromYear},
+        {RuleId: 4, DependentType: "disabled", TaxYear: taxYear, Amount: money.FromBaht(60000), MinRank: 1},
+        {RuleId: 3, DependentType: "parent", TaxYear: taxYear, Amount: money.FromBaht(30000), MinRank: 1, MaxCount: &maxParents},
+    }
+}
+
+// expenseRules builds the tax_expense_rule rows seeded in init.sql.
+func expenseRules(taxYear int) []repository.TaxExpenseRule {
+    salaryMax := money.FromBaht(100000)
+    return []repository.TaxExpenseRule{
+        {Category: "40(1)", TaxYear: taxYear, Rate: 0.5, MaxAmount: &salaryMax, CapGroup: "40(1)-40(2)", Description: "Salary and wages"},
+        {Category: "40(2)", TaxYear: taxYear, Rate: 0.5, MaxAmount: &salaryMax, CapGroup: "40(1)-40(2)", Description: "Fees and commissions"},
+        {Category: "40(5)", TaxYear: taxYear, Rate: 0.3, Description: "Rental of property"},
+        {Category: "40(8)", TaxYear: taxYear, Rate: 0.6, Description: "Business and commerce"},
+    }
+}
+
+// seededDeductConfigs builds the tax_deduct_config rows seeded in init.sql.
+func seededDeductConfigs(taxYear int) []repository.TaxDeductConfig {
+    return []repository.TaxDeductConfig{
+        {DeductId: constant.DEDUCT_DONATION_ID, TaxYear: taxYear, CapRule: constant.DEDUCT_CAP_RULE_PERCENT_OF_NET, Rate: 0.1, Multiplier: 1, Description: "Donation allowance"},
+        {DeductId: "donation-education", TaxYear: taxYear, CapRule: constant.DEDUCT_CAP_RULE_PERCENT_OF_NET, Rate: 0.1, Multiplier: 2, Description: "Education and hospital donation allowance"},
+        {DeductId: constant.DEDUCT_K_RECEIPT_ID, TaxYear: taxYear, Amount: money.FromBaht(50000), CapRule: constant.DEDUCT_CAP_RULE_MAX, Multiplier: 1, Description: "k-receipt allowance"},
+        {DeductId: constant.DEDUCT_PERSONAL_ID, TaxYear: taxYear, Amount: money.FromBaht(60000), CapRule: constant.DEDUCT_CAP_RULE_FIXED, Multiplier: 1, Description: "Personal allowance"},
+        {DeductId: constant.DEDUCT_SPOUSE_ID, TaxYear: taxYear, Amount: money.FromBaht(60000), CapRule: constant.DEDUCT_CAP_RULE_FIXED, Multiplier: 1, Description: "Spouse allowance"},
+    }
+}
+
+// mockDefaultDeductConfig sets up the deduction values seeded in init.sql.
+func mockDefaultDeductConfig(mockRepo *MockTaxDeductConfigPort) {
+    mockDeductConfigs(mockRepo, seededDeductConfigs(testTaxYear))
+}
+
+// mockDeductConfigs sets up the deductions of the test tax year with the
+// dependent and expense rules seeded in init.sql.
+func mockDeductConfigs(mockRepo *MockTaxDeductConfigPort, configs []repository.TaxDeductConfig) {
+    mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID, testTaxYear, mock.Anything).Return(&repository.TaxDeductConfig{Amount: money.FromBaht(60000)}, nil)
+    mockRepo.On("FindByTaxYear", testTaxYear, mock.Anything).Return(configs, nil)
+    mockRepo.On("FindDependentRules", testTaxYear).Return(dependentRules(testTaxYear), nil)
+    mockRepo.On("FindExpenseRules", testTaxYear).Return(expenseRules(testTaxYear), nil)
+}
+
+// testTaxService is a TaxService wired to mock repositories, with the
+// deductions of mockDefaultDeductConfig.
+type testTaxService struct {
+    *TaxService
+    deductRepo *MockTaxDeductConfigPort
+    filingRepo *MockTaxFilingPort
+    batchRepo  *MockTaxBatchPort
+}
+
+func newTestTaxService() *testTaxService {
+    mockRepo := new(MockTaxDeductConfigPort)
+    mockDefaultDeductConfig(mockRepo)
+    mockFilingRepo := newMockTaxFilingPort()
+    mockBatchRepo := new(MockTaxBatchPort)
+    taxService := NewTaxService(&zerolog.Logger{}, mockRepo, newMockTaxBracketPort(), mockFilingRepo, mockBatchRepo, &CSVParserImpl{})
+
+    return &testTaxService{
+        TaxService: taxService.(*TaxService),
+        deductRepo: mockRepo,
+        filingRepo: mockFilingRepo,
+        batchRepo:  mockBatchRepo,
+    }
+}
+
 func TestCalculationTax_deduct_donation(t *testing.T) {
     logger := &zerolog.Logger{}
     mockRepo := new(MockTaxDeductConfigPort)
     csvPaser := &CSVParserImpl{}
-    taxService := NewTaxService(logger, mockRepo,csvPaser)
+    taxService := NewTaxService(logger, mockRepo,newMockTaxBracketPort(),newMockTaxFilingPort(),new(MockTaxBatchPort),csvPaser)
 
     incomeDetail := &TaxRequest{
-        TotalIncome: 500000,
-        Allowances:  []Allowance{{AllowanceType: "donation", Amount: 200000} ,  },
+        TotalIncome: money.FromBaht(500000),
+        Allowances:  []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(200000)} ,  },
         WHT:         0,
     }
 
-    mockRepo.On("FindById", "personal").Return(&repository.TaxDeductConfig{Amount: 60000}, nil)
-  
+    mockDefaultDeductConfig(mockRepo)
 
     taxResponse, err := taxService.CalculationTax(incomeDetail)
 
     assert.NoError(t, err)
-    assert.Equal(t, 19000.0, taxResponse.Tax)
+    // the donation is capped at 10% of the 440,000 net income
+    assert.Equal(t, money.FromBaht(24600), taxResponse.Tax)
+}
+
+
+func TestCalculationTax_Explanation(t *testing.T) {
+    logger := &zerolog.Logger{}
+    mockRepo := new(MockTaxDeductConfigPort)
+    taxService := NewTaxService(logger, mockRepo,newMockTaxBracketPort(),newMockTaxFilingPort(),new(MockTaxBatchPort),&CSVParserImpl{})
+
+    incomeDetail := &TaxRequest{
+        TotalIncome: money.FromBaht(500000),
+        Allowances:  []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(200000)}},
+        WHT:         money.FromBaht(25000),
+    }
+
+    mockDefaultDeductConfig(mockRepo)
+
+    taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+    assert.NoError(t, err)
+    assert.Equal(t, &TaxExplanation{
+        TotalIncome:       money.FromBaht(500000),
+        PersonalAllowance: money.FromBaht(60000),
+        Allowances:        []AllowanceExplanation{{AllowanceType: "donation", Claimed: money.FromBaht(200000), Accepted: money.FromBaht(44000)}},
+        TaxableIncome:     money.FromBaht(396000),
+        GrossTax:          money.FromBaht(24600),
+        TaxMethod:         constant.TAX_METHOD_PROGRESSIVE,
+        WHT:               money.FromBaht(25000),
+    }, taxResponse.Explanation)
+    assert.Equal(t, money.FromBaht(400), taxResponse.TaxRefund)
+
+    // the effective rate is on the tax before WHT
+    incomeToNextBracket := money.FromBaht(104000)
+    assert.Equal(t, &TaxRates{EffectiveRate: 0.0492, MarginalRate: 0.1, MarginalLevel: "150,001-500,000", IncomeToNextBracket: &incomeToNextBracket}, taxResponse.Rates)
+}
+
+func TestCalculationTax_ExplanationIncomeBelowAllowances(t *testing.T) {
+    logger := &zerolog.Logger{}
+    mockRepo := new(MockTaxDeductConfigPort)
+    taxService := NewTaxService(logger, mockRepo,newMockTaxBracketPort(),newMockTaxFilingPort(),new(MockTaxBatchPort),&CSVParserImpl{})
+
+    mockDefaultDeductConfig(mockRepo)
+
+    taxResponse, err := taxService.CalculationTax(&TaxRequest{TotalIncome: money.FromBaht(50000)})
+
+    assert.NoError(t, err)
+    assert.Equal(t, money.Money(0), taxResponse.Explanation.TaxableIncome)
+    assert.Equal(t, money.Money(0), taxResponse.Explanation.GrossTax)
+    assert.Equal(t, []AllowanceExplanation{}, taxResponse.Explanation.Allowances)
 }
 
 
@@ -55,43 +240,111 @@ func TestCalculationTax_deduct_Kreceipt(t *testing.T) {
     logger := &zerolog.Logger{}
     mockRepo := new(MockTaxDeductConfigPort)
     csvPaser := &CSVParserImpl{}
-    taxService := NewTaxService(logger, mockRepo,csvPaser)
+    taxService := NewTaxService(logger, mockRepo,newMockTaxBracketPort(),newMockTaxFilingPort(),new(MockTaxBatchPort),csvPaser)
 
     incomeDetail := &TaxRequest{
-        TotalIncome: 500000,
-        Allowances:  []Allowance{ {AllowanceType: "k-receipt", Amount: 200000} },
+        TotalIncome: money.FromBaht(500000),
+        Allowances:  []Allowance{ {AllowanceType: "k-receipt", Amount: money.FromBaht(200000)} },
         WHT:         0,
     }
 
-    mockRepo.On("FindById", "k-receipt").Return(&repository.TaxDeductConfig{Amount: 50000.0}, nil)
-    mockRepo.On("FindById", "personal").Return(&repository.TaxDeductConfig{Amount: 60000.0}, nil)
+    mockDefaultDeductConfig(mockRepo)
 
     taxResponse, err := taxService.CalculationTax(incomeDetail)
 
     assert.NoError(t, err)
-    assert.Equal(t, 24000.0, taxResponse.Tax)
+    assert.Equal(t, money.FromBaht(24000), taxResponse.Tax)
 }
 
 func TestCalculateTax(t *testing.T) {
     logger := &zerolog.Logger{}
     mockRepo := new(MockTaxDeductConfigPort)
     csvPaser := &CSVParserImpl{}
-    taxService := NewTaxService(logger, mockRepo,csvPaser)
+    taxService := NewTaxService(logger, mockRepo,newMockTaxBracketPort(),newMockTaxFilingPort(),new(MockTaxBatchPort),csvPaser)
 
 
 
     incomeDetail := &TaxRequest{
-        TotalIncome: 500000,
+        TotalIncome: money.FromBaht(500000),
         Allowances:  []Allowance{{AllowanceType: "donation",Amount: 0}},
-        WHT:         25000,
+        WHT:         money.FromBaht(25000),
     }
 
-    mockRepo.On("FindById", "personal").Return(&repository.TaxDeductConfig{Amount: 60000}, nil)
+    mockDefaultDeductConfig(mockRepo)
 
 	taxResponse, err := taxService.CalculationTax(incomeDetail)	
 
     assert.NoError(t, err)
-    assert.Equal(t, 4000.0, taxResponse.Tax)
+    assert.Equal(t, money.FromBaht(4000), taxResponse.Tax)
+    assert.Equal(t, testTaxYear, taxResponse.TaxYear)
+}
+
+func TestCalculateTax_TaxYear(t *testing.T) {
+    logger := &zerolog.Logger{}
+    mockRepo := new(MockTaxDeductConfigPort)
+    mockBracketRepo := new(MockTaxBracketPort)
+    csvPaser := &CSVParserImpl{}
+    taxService := NewTaxService(logger, mockRepo,mockBracketRepo,newMockTaxFilingPort(),new(MockTaxBatchPort),csvPaser)
+
+    incomeDetail := &TaxRequest{
+        TaxYear:     2023,
+        TotalIncome: money.FromBaht(500000),
+        Allowances:  []Allowance{{AllowanceType: "donation",Amount: money.FromBaht(200000)}},
+    }
+
+    mockBracketRepo.On("FindByTaxYear", 2023).Return(defaultTaxBrackets(), nil)
+    mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID, 2023, mock.Anything).Return(&repository.TaxDeductConfig{Amount: money.FromBaht(70000)}, nil)
+    mockRepo.On("FindByTaxYear", 2023, mock.Anything).Return(deductConfigs(2023, money.FromBaht(70000), money.FromBaht(50000), money.FromBaht(50000)), nil)
+    mockRepo.On("FindDependentRules", 2023).Return(dependentRules(2023), nil)
+    mockRepo.On("FindExpenseRules", 2023).Return(expenseRules(2023), nil)
+
+    taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+    // 500,000 - 70,000 (personal) - 50,000 (donation) = 380,000
+    assert.NoError(t, err)
+    assert.Equal(t, money.FromBaht(23000), taxResponse.Tax)
+    assert.Equal(t, 2023, taxResponse.TaxYear)
+    mockBracketRepo.AssertNotCalled(t, "FindLatestTaxYear")
+}
+
+func TestCalculateTax_TaxYearNotFound(t *testing.T) {
+    logger := &zerolog.Logger{}
+    mockRepo := new(MockTaxDeductConfigPort)
+    mockBracketRepo := new(MockTaxBracketPort)
+    csvPaser := &CSVParserImpl{}
+    taxService := NewTaxService(logger, mockRepo,mockBracketRepo,newMockTaxFilingPort(),new(MockTaxBatchPort),csvPaser)
+
+    incomeDetail := &TaxRequest{
+        TaxYear:     1999,
+        TotalIncome: money.FromBaht(500000),
+    }
+
+    mockBracketRepo.On("FindByTaxYear", 1999).Return([]repository.TaxBracket{}, nil)
+
+    taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+    assert.Nil(t, taxResponse)
+    assert.EqualError(t, err, apperrs.NewBadRequestError(constant.MSG_BU_TAX_RULE_NOT_FOUND_FOR_YEAR + "1999").Error())
+}
+
+func TestCalculateTax_BracketConfigNotFound(t *testing.T) {
+    logger := &zerolog.Logger{}
+    mockRepo := new(MockTaxDeductConfigPort)
+    mockBracketRepo := new(MockTaxBracketPort)
+    csvPaser := &CSVParserImpl{}
+    taxService := &TaxService{logger: logger, DeductRepo: mockRepo, BracketRepo: mockBracketRepo, csvParser: csvPaser}
+
+    incomeDetail := &TaxRequest{
+        TotalIncome: money.FromBaht(500000),
+        Allowances:  []Allowance{{AllowanceType: "donation",Amount: 0}},
+    }
+
+    mockBracketRepo.On("FindLatestTaxYear").Return(0, errors.New("tax bracket not found for any tax year"))
+
+    taxResponse, err := taxService.CalculateTax(incomeDetail)
+
+    assert.Nil(t, taxResponse)
+    assert.EqualError(t, err, apperrs.NewInternalServerError(constant.MSG_BU_TAX_BRACKET_CONFIG_NOT_FOUND).Error())
 }
 
 
@@ -100,17 +353,17 @@ func TestUpdatePersonalAllowance(t *testing.T) {
     logger := &zerolog.Logger{}
     mockRepo := new(MockTaxDeductConfigPort)
     csvPaser := &CSVParserImpl{}
-    taxService := NewTaxService(logger, mockRepo,csvPaser)
+    taxService := NewTaxService(logger, mockRepo,newMockTaxBracketPort(),newMockTaxFilingPort(),new(MockTaxBatchPort),csvPaser)
 
-    updateReq := UpdateDeductRequest{Amount: 60000.0}
+    updateReq := UpdateDeductRequest{Amount: money.FromBaht(60000)}
 
-    mockRepo.On("UpdateById", constant.DEDUCT_PERSONAL_ID, 60000.0).Return(1, nil)
-    mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID).Return(&repository.TaxDeductConfig{Amount: 60000.0}, nil)
+    mockRepo.On("UpdateById", constant.DEDUCT_PERSONAL_ID, testTaxYear, money.FromBaht(60000), "", mock.Anything).Return(1, nil)
+    mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID, testTaxYear, mock.Anything).Return(&repository.TaxDeductConfig{DeductId: constant.DEDUCT_PERSONAL_ID, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000)}, nil)
 
     updDeductResponse, err := taxService.UpdatePersonalAllowance(&updateReq)
 
     assert.NoError(t, err)
-    assert.Equal(t, 60000.0, updDeductResponse.Amount)
+    assert.Equal(t, money.FromBaht(60000), updDeductResponse.Amount)
 }
 
 
@@ -118,17 +371,17 @@ func TestUpdateKreceiptAllowance(t *testing.T) {
     logger := &zerolog.Logger{}
     mockRepo := new(MockTaxDeductConfigPort)
     csvPaser := &CSVParserImpl{}
-    taxService := NewTaxService(logger, mockRepo,csvPaser)
+    taxService := NewTaxService(logger, mockRepo,newMockTaxBracketPort(),newMockTaxFilingPort(),new(MockTaxBatchPort),csvPaser)
 
-    updateReq := UpdateDeductRequest{Amount: 60000.0}
+    updateReq := UpdateDeductRequest{Amount: money.FromBaht(60000)}
 
-    mockRepo.On("UpdateById", constant.DEDUCT_K_RECEIPT_ID, 60000.0).Return(1, nil)
-    mockRepo.On("FindById", constant.DEDUCT_K_RECEIPT_ID).Return(&repository.TaxDeductConfig{Amount: 60000.0}, nil)
+    mockRepo.On("UpdateById", constant.DEDUCT_K_RECEIPT_ID, testTaxYear, money.FromBaht(60000), "", mock.Anything).Return(1, nil)
+    mockRepo.On("FindById", constant.DEDUCT_K_RECEIPT_ID, testTaxYear, mock.Anything).Return(&repository.TaxDeductConfig{DeductId: constant.DEDUCT_K_RECEIPT_ID, Amount: money.FromBaht(60000), MinAmount: money.FromBaht(1), MaxAmount: money.FromBaht(100000)}, nil)
 
     updDeductResponse, err := taxService.UpdateKreceiptAllowance(&updateReq)
 
     assert.NoError(t, err)
-    assert.Equal(t, 60000.0, updDeductResponse.Amount)
+    assert.Equal(t, money.FromBaht(60000), updDeductResponse.Amount)
 }
 
 
@@ -177,7 +430,7 @@ func TestGetPersonalAllowance(t *testing.T) {
     logger := &zerolog.Logger{}
     mockRepo := new(MockTaxDeductConfigPort)
     csvPaser := &CSVParserImpl{}
-    mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID).Return(&repository.TaxDeductConfig{Amount: 60000.0}, nil)
+    mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID, testTaxYear, mock.Anything).Return(&repository.TaxDeductConfig{Amount: money.FromBaht(60000)}, nil)
 
     // Creating a TaxService instance with the mocked logger and repository
     taxService := TaxService{logger: logger, DeductRepo: mockRepo,csvParser: csvPaser}
@@ -186,33 +439,11 @@ func TestGetPersonalAllowance(t *testing.T) {
     
 
     // Calling the method under test
-    amount, err := taxService.getPersonalAllowance()
+    amount, err := taxService.getPersonalAllowance(testTaxYear, time.Now())
 
     // Assertions
     assert.NoError(t, err)
-    assert.Equal(t, 60000.0, amount)
-}
-
-
-
-func TestGetKreceiptAllowance(t *testing.T) {
-    // Mocking the logger
-    logger := zerolog.Logger{}
-
-    // Mocking the repository
-    mockRepo := new(MockTaxDeductConfigPort)
-    mockRepo.On("FindById", constant.DEDUCT_K_RECEIPT_ID).Return(&repository.TaxDeductConfig{Amount: 70000.0}, nil)
-
-    // Creating a TaxService instance with the mocked logger and repository
-    taxService := &TaxService{logger: &logger, DeductRepo: mockRepo}
-
-
-    // Calling the method under test
-    amount, err := taxService.getKreceiptAllowance()
-
-    // Assertions
-    assert.NoError(t, err)
-    assert.Equal(t, 70000.0, amount)
+    assert.Equal(t, money.FromBaht(60000), amount)
 }
 
 
@@ -236,16 +467,16 @@ func TestGetKreceiptAllowance(t *testing.T) {
 func TestGetTaxUpload(t *testing.T) {
 	// Create sample TaxRequest and TaxResponse
 	taxRequest := &TaxRequest{
-		TotalIncome: 1000,
-		WHT:         200,
+		TotalIncome: money.FromBaht(1000),
+		WHT:         money.FromBaht(200),
 		Allowances: []Allowance{
-			{AllowanceType: "donation", Amount: 50},
-			{AllowanceType: "k-receipt", Amount: 100},
+			{AllowanceType: "donation", Amount: money.FromBaht(50)},
+			{AllowanceType: "k-receipt", Amount: money.FromBaht(100)},
 		},
 	}
 	taxResponse := &TaxResponse{
-		Tax:       150,
-		TaxRefund: 50,
+		Tax:       money.FromBaht(150),
+		TaxRefund: money.FromBaht(50),
 	}
 
 	// Call the function to get TaxUpload
@@ -265,21 +496,21 @@ func TestDeductWht(t *testing.T) {
 
 	testCases := []struct {
 		name          string
-		taxAmount     float64
-		wht           float64
-		expectedDiff  float64
+		taxAmount     money.Money
+		wht           money.Money
+		expectedDiff  money.Money
 	}{
 		{
 			name:          "PositiveTaxAmount",
-			taxAmount:     1000,
-			wht:           200,
-			expectedDiff:  800, // Tax amount (1000) - WHT (200)
+			taxAmount:     money.FromBaht(1000),
+			wht:           money.FromBaht(200),
+			expectedDiff:  money.FromBaht(800), // Tax amount (1000) - WHT (200)
 		},
 		{
 			name:          "ZeroTaxAmount",
 			taxAmount:     0,
-			wht:           100,
-			expectedDiff:  -100, // Negative because WHT is greater than tax amount
+			wht:           money.FromBaht(100),
+			expectedDiff:  -money.FromBaht(100), // Negative because WHT is greater than tax amount
 		},
 	}
 
@@ -291,94 +522,16 @@ func TestDeductWht(t *testing.T) {
 	}
 }
 
-func TestAdjustMaximumDonationAllowanceDeduct(t *testing.T) {
-	taxService := &TaxService{}
+func TestLoadTaxRule_ConfigNotFound(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := &TaxService{logger: logger, DeductRepo: mockRepo, BracketRepo: newMockTaxBracketPort()}
 
-	testCases := []struct {
-		name              string
-		allowance         float64
-		expectedAdjusted  float64
-	}{
-		{
-			name:             "AllowanceBelowMax",
-			allowance:        50,
-			expectedAdjusted: 50, // No adjustment needed
-		},
-		{
-			name:             "AllowanceAboveMax",
-			allowance:        200000,
-			expectedAdjusted: constant.MAX_ALLOWANCE_DONATION_DEDUCT, // Should be adjusted to the max allowance
-		},
-		{
-			name:             "AllowanceEqualMax",
-			allowance:        constant.MAX_ALLOWANCE_DONATION_DEDUCT,
-			expectedAdjusted: constant.MAX_ALLOWANCE_DONATION_DEDUCT, // No adjustment needed, already at max
-		},
-	}
+	mockRepo.On("FindById", constant.DEDUCT_PERSONAL_ID, testTaxYear, mock.Anything).Return(&repository.TaxDeductConfig{Amount: money.FromBaht(60000)}, nil)
+	mockRepo.On("FindByTaxYear", testTaxYear, mock.Anything).Return([]repository.TaxDeductConfig(nil), errors.New("connection refused"))
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			adjusted := taxService.adjustMaximumDonationAllowanceDeduct(tc.allowance)
-			assert.Equal(t, tc.expectedAdjusted, adjusted)
-		})
-	}
-}
-
-type mockDeductRepo struct{}
-
-func (m *mockDeductRepo) FindById(id string) (*repository.TaxDeductConfig, error) {
-	// Check the ID to determine which config to return
-	if id == constant.DEDUCT_K_RECEIPT_ID {
-		// Mock implementation to return the fixed value for K-receipt config
-		return &repository.TaxDeductConfig{Amount: 50000}, nil
-	}
-	// Return nil for other IDs
-	return nil, errors.New("unexpected ID")
-}
+	taxRule, err := taxService.loadTaxRule(0)
 
-func (m *mockDeductRepo) UpdateById(id string, amount float64) (int64, error) {
-	// Mock implementation for the UpdateById method
-	return 1, nil
+	assert.Nil(t, taxRule)
+	assert.EqualError(t, err, apperrs.NewInternalServerError(constant.MSG_BU_DEDUCT_LOAD_FAILED).Error())
 }
-
-func TestAdjustMaximumKreceiptAllowanceDeduct(t *testing.T) {
-	mockDeductRepo := &mockDeductRepo{}
-
-	mockTaxService := &TaxService{
-		DeductRepo: mockDeductRepo,
-	}
-
-	testCases := []struct {
-		name                    string
-		allowance               float64
-		expectedAdjusted        float64
-		expectedErr             error
-	}{
-		{
-			name:             "AllowanceBelowMax",
-			allowance:        40000,
-			expectedAdjusted: 40000, // No adjustment needed
-			expectedErr:      nil,
-		},
-		{
-			name:             "AllowanceAboveMax",
-			allowance:        60000,
-			expectedAdjusted: 50000, // Should be adjusted to the max allowance (50000)
-			expectedErr:      nil,
-		},
-		{
-			name:             "AllowanceEqualMax",
-			allowance:        50000,
-			expectedAdjusted: 50000, // No adjustment needed, already at max
-			expectedErr:      nil,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			adjusted, err := mockTaxService.adjustMaximumKreceiptAllowanceDeduct(tc.allowance)
-			assert.Equal(t, tc.expectedAdjusted, adjusted)
-			assert.Equal(t, tc.expectedErr, err)
-		})
-	}
-}
\ No newline at end of file
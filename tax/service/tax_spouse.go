@@ -0,0 +1,109 @@
+package service
+
+import (
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+)
+
+// calculateSpouseTax works out both filing options of a couple and returns
+// the return of the requested filing status. Filing jointly taxes the summed
+// incomes with the spouse allowance in place of the spouse's personal
+// allowance. Filing separately taxes each spouse on their own, a spouse
+// without income files no return and the taxpayer claims the spouse
+// allowance instead.
+func (t *TaxService) calculateSpouseTax(incomeDetail *TaxRequest, taxRule *TaxRule) *TaxResponse {
+	jointReturn := t.calculateJointReturn(incomeDetail, taxRule)
+	taxpayerReturn, spouseReturn := t.calculateSeparateReturns(incomeDetail, taxRule)
+
+	filingOptions := []FilingOption{
+		newFilingOption(constant.FILING_STATUS_JOINT, jointReturn),
+		newFilingOption(constant.FILING_STATUS_SEPARATE, taxpayerReturn, spouseReturn),
+	}
+
+	taxResponse := jointReturn
+	if incomeDetail.FilingStatus == constant.FILING_STATUS_SEPARATE {
+		taxResponse = taxpayerReturn
+		taxResponse.Spouse = spouseReturn
+	}
+	taxResponse.FilingStatus = incomeDetail.FilingStatus
+	taxResponse.FilingOptions = filingOptions
+	taxResponse.RecommendedFilingStatus = recommendFilingStatus(incomeDetail.FilingStatus, filingOptions)
+
+	return taxResponse
+}
+
+func (t *TaxService) calculateJointReturn(incomeDetail *TaxRequest, taxRule *TaxRule) *TaxResponse {
+	spouse := incomeDetail.Spouse
+
+	explanation := newTaxpayerExplanation(incomeDetail, taxRule)
+	explanation.TotalIncome += spouse.TotalIncome
+	explanation.SpouseIncomes = taxRule.Expenses.Explain(spouse.Incomes)
+	explanation.SpouseAllowance = taxRule.spouseAllowance()
+	explanation.SpouseAllowances = taxRule.Allowances.Explain(spouse.Allowances)
+	explanation.WHT += spouse.WHT
+
+	return t.calculateTaxReturn(&explanation, taxRule)
+}
+
+// calculateSeparateReturns returns the return of the taxpayer and of the
+// spouse, nil when the spouse has no income.
+func (t *TaxService) calculateSeparateReturns(incomeDetail *TaxRequest, taxRule *TaxRule) (*TaxResponse, *TaxResponse) {
+	spouse := incomeDetail.Spouse
+
+	taxpayerExplanation := newTaxpayerExplanation(incomeDetail, taxRule)
+
+	if spouse.TotalIncome == 0 {
+		taxpayerExplanation.SpouseAllowance = taxRule.spouseAllowance()
+		return t.calculateTaxReturn(&taxpayerExplanation, taxRule), nil
+	}
+
+	spouseReturn := t.calculateTaxReturn(&TaxExplanation{
+		TotalIncome:       spouse.TotalIncome,
+		Incomes:           taxRule.Expenses.Explain(spouse.Incomes),
+		PersonalAllowance: taxRule.PersonalAllowance,
+		Allowances:        taxRule.Allowances.Explain(spouse.Allowances),
+		WHT:               spouse.WHT,
+	}, taxRule)
+
+	return t.calculateTaxReturn(&taxpayerExplanation, taxRule), spouseReturn
+}
+
+func (r *TaxRule) spouseAllowance() money.Money {
+	if r.SpouseAllowance == nil {
+		return 0
+	}
+	return *r.SpouseAllowance
+}
+
+func newFilingOption(filingStatus string, taxReturns ...*TaxResponse) FilingOption {
+	filingOption := FilingOption{FilingStatus: filingStatus}
+	for _, taxReturn := range taxReturns {
+		if taxReturn == nil {
+			continue
+		}
+		filingOption.Tax += taxReturn.Tax
+		filingOption.TaxRefund += taxReturn.TaxRefund
+	}
+	return filingOption
+}
+
+// recommendFilingStatus picks the filing option paying the least, the
+// requested filing status wins a tie.
+func recommendFilingStatus(filingStatus string, filingOptions []FilingOption) string {
+	var recommended *FilingOption
+	for i := range filingOptions {
+		filingOption := &filingOptions[i]
+		payment := filingOption.Tax - filingOption.TaxRefund
+
+		if recommended == nil {
+			recommended = filingOption
+			continue
+		}
+
+		recommendedPayment := recommended.Tax - recommended.TaxRefund
+		if payment < recommendedPayment || (payment == recommendedPayment && filingOption.FilingStatus == filingStatus) {
+			recommended = filingOption
+		}
+	}
+	return recommended.FilingStatus
+}
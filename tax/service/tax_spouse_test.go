@@ -0,0 +1,203 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCalculationTax_JointFiling(t *testing.T) {
+	taxService := newTestTaxService()
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome:  money.FromBaht(1000000),
+		FilingStatus: constant.FILING_STATUS_JOINT,
+		Spouse:       &SpouseIncome{TotalIncome: money.FromBaht(300000), WHT: money.FromBaht(10000)},
+	})
+
+	assert.NoError(t, err)
+	// (1,300,000 - 60,000 personal - 60,000 spouse) taxed is 146,000 less the spouse's WHT
+	assert.Equal(t, constant.FILING_STATUS_JOINT, taxResponse.FilingStatus)
+	assert.Equal(t, money.FromBaht(136000), taxResponse.Tax)
+	assert.Equal(t, money.FromBaht(1300000), taxResponse.Explanation.TotalIncome)
+	assert.Equal(t, money.FromBaht(60000), taxResponse.Explanation.SpouseAllowance)
+	assert.Equal(t, money.FromBaht(1180000), taxResponse.Explanation.TaxableIncome)
+	assert.Nil(t, taxResponse.Spouse)
+
+	// separately the taxpayer pays 101,000 and the spouse 9,000 less 10,000 WHT
+	assert.Equal(t, []FilingOption{
+		{FilingStatus: constant.FILING_STATUS_JOINT, Tax: money.FromBaht(136000)},
+		{FilingStatus: constant.FILING_STATUS_SEPARATE, Tax: money.FromBaht(101000), TaxRefund: money.FromBaht(1000)},
+	}, taxResponse.FilingOptions)
+	assert.Equal(t, constant.FILING_STATUS_SEPARATE, taxResponse.RecommendedFilingStatus)
+}
+
+func TestCalculationTax_JointFilingDonationCap(t *testing.T) {
+	taxService := newTestTaxService()
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome:  money.FromBaht(620000),
+		FilingStatus: constant.FILING_STATUS_JOINT,
+		Allowances:   []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(100000)}},
+		Spouse: &SpouseIncome{
+			TotalIncome: money.FromBaht(500000),
+			Allowances:  []Allowance{{AllowanceType: "donation", Amount: money.FromBaht(100000)}},
+		},
+	})
+
+	assert.NoError(t, err)
+	// both donations share one cap of 10% of the 1,000,000 left after the
+	// personal and spouse allowances
+	assert.Equal(t, money.FromBaht(100000), taxResponse.Explanation.Allowances[0].Accepted)
+	assert.Equal(t, money.Money(0), taxResponse.Explanation.SpouseAllowances[0].Accepted)
+	assert.Equal(t, money.FromBaht(900000), taxResponse.Explanation.TaxableIncome)
+	assert.Equal(t, money.FromBaht(95000), taxResponse.Tax)
+}
+
+func TestCalculationTax_SeparateFiling(t *testing.T) {
+	taxService := newTestTaxService()
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome:  money.FromBaht(1000000),
+		FilingStatus: constant.FILING_STATUS_SEPARATE,
+		Spouse: &SpouseIncome{
+			TotalIncome: money.FromBaht(300000),
+			Allowances:  []Allowance{{AllowanceType: "k-receipt", Amount: money.FromBaht(50000)}},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, constant.FILING_STATUS_SEPARATE, taxResponse.FilingStatus)
+	assert.Equal(t, money.FromBaht(101000), taxResponse.Tax)
+	assert.Equal(t, money.Money(0), taxResponse.Explanation.SpouseAllowance)
+	assert.Equal(t, money.FromBaht(4000), taxResponse.Spouse.Tax)
+	assert.Equal(t, money.FromBaht(190000), taxResponse.Spouse.Explanation.TaxableIncome)
+	assert.Equal(t, constant.FILING_STATUS_SEPARATE, taxResponse.RecommendedFilingStatus)
+}
+
+func TestCalculationTax_SpouseWithoutIncome(t *testing.T) {
+	taxService := newTestTaxService()
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome:  money.FromBaht(1000000),
+		FilingStatus: constant.FILING_STATUS_SEPARATE,
+		Spouse:       &SpouseIncome{},
+	})
+
+	assert.NoError(t, err)
+	// the taxpayer claims the spouse allowance, both options pay the same
+	assert.Equal(t, money.FromBaht(92000), taxResponse.Tax)
+	assert.Equal(t, money.FromBaht(60000), taxResponse.Explanation.SpouseAllowance)
+	assert.Nil(t, taxResponse.Spouse)
+	assert.Equal(t, money.FromBaht(92000), taxResponse.FilingOptions[0].Tax)
+	assert.Equal(t, constant.FILING_STATUS_SEPARATE, taxResponse.RecommendedFilingStatus)
+}
+
+func TestCalculationTax_JointFilingCheaper(t *testing.T) {
+	taxService := newTestTaxService()
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome:  money.FromBaht(1000000),
+		FilingStatus: constant.FILING_STATUS_SEPARATE,
+		Spouse:       &SpouseIncome{TotalIncome: money.FromBaht(10000)},
+	})
+
+	assert.NoError(t, err)
+	// the spouse allowance of the joint return outweighs the spouse's income
+	assert.Equal(t, money.FromBaht(101000), taxResponse.Tax)
+	assert.Equal(t, money.FromBaht(93500), taxResponse.FilingOptions[0].Tax)
+	assert.Equal(t, constant.FILING_STATUS_JOINT, taxResponse.RecommendedFilingStatus)
+}
+
+func TestCalculationTax_SpouseAllowanceNotConfigured(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	mockDeductConfigs(mockRepo, deductConfigs(testTaxYear, money.FromBaht(60000), money.FromBaht(50000), money.FromBaht(100000)))
+	mockFilingRepo := newMockTaxFilingPort()
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), mockFilingRepo, new(MockTaxBatchPort), &CSVParserImpl{})
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome:  money.FromBaht(1000000),
+		FilingStatus: constant.FILING_STATUS_JOINT,
+		Spouse:       &SpouseIncome{Allowances: []Allowance{{AllowanceType: "invalid", Amount: money.FromBaht(1)}}},
+	})
+
+	assert.Nil(t, taxResponse)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.Contains(t, err.Error(), `spouse allowanceType "invalid" is not supported`)
+	assert.Contains(t, err.Error(), constant.MSG_BU_DEDUCT_SPOUSE_CONFIG_NOT_FOUND+"2024")
+	mockFilingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestCalculationTax_SaveSpouseFiling(t *testing.T) {
+	testCases := []struct {
+		name         string
+		filingStatus string
+		totalIncome  money.Money
+	}{
+		{name: "Joint", filingStatus: constant.FILING_STATUS_JOINT, totalIncome: money.FromBaht(1300000)},
+		{name: "Separate", filingStatus: constant.FILING_STATUS_SEPARATE, totalIncome: money.FromBaht(1000000)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taxService := newTestTaxService()
+
+			_, err := taxService.CalculationTax(&TaxRequest{
+				TotalIncome:  money.FromBaht(1000000),
+				FilingStatus: tc.filingStatus,
+				Spouse:       &SpouseIncome{TotalIncome: money.FromBaht(300000)},
+			})
+
+			// the filing is listed under the income of the return filed
+			assert.NoError(t, err)
+			saved := taxService.filingRepo.Calls[0].Arguments.Get(0).(*repository.TaxFiling)
+			assert.Equal(t, tc.totalIncome, saved.TotalIncome)
+		})
+	}
+}
+
+func TestCalculationTax_SpouseIncomes(t *testing.T) {
+	taxService := newTestTaxService()
+
+	incomeDetail := &TaxRequest{
+		TotalIncome:  money.FromBaht(1000000),
+		FilingStatus: constant.FILING_STATUS_JOINT,
+		Spouse:       &SpouseIncome{Incomes: []Income{{Category: "40(1)", Amount: money.FromBaht(300000)}}},
+	}
+	taxResponse, err := taxService.CalculationTax(incomeDetail)
+
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromBaht(300000), incomeDetail.Spouse.TotalIncome)
+	// 1,300,000 - 100,000 spouse salary expense - 60,000 personal - 60,000
+	// spouse allowance
+	assert.Equal(t, []IncomeExplanation{{Category: "40(1)", Amount: money.FromBaht(300000), Expense: money.FromBaht(100000), Net: money.FromBaht(200000)}}, taxResponse.Explanation.SpouseIncomes)
+	assert.Equal(t, money.FromBaht(1080000), taxResponse.Explanation.TaxableIncome)
+	assert.Equal(t, money.FromBaht(126000), taxResponse.Tax)
+
+	// filing separately the spouse's 140,000 taxable income is below the
+	// first bracket
+	assert.Equal(t, FilingOption{FilingStatus: constant.FILING_STATUS_SEPARATE, Tax: money.FromBaht(101000)}, taxResponse.FilingOptions[1])
+	assert.Equal(t, constant.FILING_STATUS_SEPARATE, taxResponse.RecommendedFilingStatus)
+}
+
+func TestCalculationTax_SpouseIncomesInvalid(t *testing.T) {
+	taxService := newTestTaxService()
+
+	taxResponse, err := taxService.CalculationTax(&TaxRequest{
+		TotalIncome:  money.FromBaht(1000000),
+		FilingStatus: constant.FILING_STATUS_SEPARATE,
+		Spouse:       &SpouseIncome{TotalIncome: money.FromBaht(100000), Incomes: []Income{{Category: "40(3)", Amount: money.FromBaht(300000)}}},
+	})
+
+	assert.Nil(t, taxResponse)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.Contains(t, err.Error(), "spouse "+constant.MSG_BU_INVALID_TOTAL_INCOME_NOT_SUM_OF_INCOMES)
+}
@@ -1,107 +1,358 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
+	"errors"
+	"fmt"
 	"io"
-	"strconv"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/meteedev/assessment-tax/apperrs"
 	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
 )
 
+// csvRowIdColumns are the header names accepted for the optional row
+// identifier, matched case-insensitively.
+var csvRowIdColumns = []string{"id", "employeeid", "employee_id", "rowid"}
+
+// uploadHeader maps the columns of an upload file by their header name.
+type uploadHeader struct {
+	names       []string
+	totalIncome int
+	wht         int
+	rowId       int            // -1 when the file has no row identifier
+	allowances  map[int]string // column index to allowance type
+	ignored     []string
+}
+
+// parseUploadHeader maps the header row, columns may come in any order. A
+// column that is neither known nor one of allowanceTypes is ignored.
+func parseUploadHeader(record []string, allowanceTypes []string) (*uploadHeader, error) {
+	header := uploadHeader{totalIncome: -1, wht: -1, rowId: -1, allowances: map[int]string{}}
+
+	seen := map[string]bool{}
+	for i, name := range record {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) // excel exports start with a BOM
+		header.names = append(header.names, name)
+
+		key := strings.ToLower(name)
+		if seen[key] {
+			return nil, fmt.Errorf("%s%s", constant.MSG_UPLOAD_DUPLICATE_COLUMN, name)
+		}
+		seen[key] = true
+
+		switch {
+		case key == strings.ToLower(constant.CSV_COLUMN_TOTAL_INCOME):
+			header.totalIncome = i
+		case key == constant.CSV_COLUMN_WHT:
+			header.wht = i
+		case slices.Contains(csvRowIdColumns, key):
+			header.rowId = i
+		case slices.Contains(allowanceTypes, key):
+			header.allowances[i] = key
+		default:
+			header.ignored = append(header.ignored, name)
+		}
+	}
+
+	if header.totalIncome < 0 || header.wht < 0 {
+		return nil, errors.New(constant.MSG_UPLOAD_MISSING_COLUMN)
+	}
+
+	return &header, nil
+}
+
 type CSVParserImpl struct{}
 
-func (c *CSVParserImpl) ParseCSVToTaxRequest(file io.Reader) (*[]TaxRequest, error) {
+// ParseCSVToTaxRequest fails on the first row that can not be parsed.
+func (c *CSVParserImpl) ParseCSVToTaxRequest(file io.Reader, allowanceTypes []string) (*[]TaxRequest, error) {
+	uploadFile, err := c.ParseCSVToTaxUploadRows(file, allowanceTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	taxRequests := make([]TaxRequest, 0, len(uploadFile.Rows))
+	for _, row := range uploadFile.Rows {
+		if len(row.Errors) > 0 {
+			return nil, apperrs.NewBadRequestError(taxUploadErrorMessage(row.Errors))
+		}
+		taxRequests = append(taxRequests, row.TaxRequest)
+	}
+
+	return &taxRequests, nil
+}
+
+// ParseCSVToTaxUploadRows parses every row of the file, a row that can not be
+// parsed carries its errors instead of stopping the whole file. Only an
+// unreadable file or header is returned as error.
+func (c *CSVParserImpl) ParseCSVToTaxUploadRows(file io.Reader, allowanceTypes []string) (*TaxUploadFile, error) {
+	reader, err := c.NewCSVTaxUploadReader(file, allowanceTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return readTaxUploadFile(reader)
+}
+
+// NewCSVTaxUploadReader reads the header, the rows are then read one by one.
+func (c *CSVParserImpl) NewCSVTaxUploadReader(file io.Reader, allowanceTypes []string) (TaxUploadReader, error) {
 	reader := csv.NewReader(file)
-	_, err := reader.Read() // Skip the header row
+	reader.FieldsPerRecord = -1 // the column count is checked per row
+
+	record, err := reader.Read()
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	header, err := parseUploadHeader(record, allowanceTypes)
 	if err != nil {
 		return nil, apperrs.NewBadRequestError(err.Error())
 	}
 
-	var taxRequests []TaxRequest
+	return &csvTaxUploadReader{reader: reader, header: header}, nil
+}
+
+type csvTaxUploadReader struct {
+	reader *csv.Reader
+	header *uploadHeader
+}
+
+func (r *csvTaxUploadReader) Header() []string {
+	return r.header.names
+}
+
+func (r *csvTaxUploadReader) IgnoredColumns() []string {
+	return r.header.ignored
+}
+
+func (r *csvTaxUploadReader) Close() error {
+	return nil
+}
+
+func (r *csvTaxUploadReader) Read() (*TaxUploadRow, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &TaxUploadRow{
+			Line:   parseErr.Line,
+			Errors: []TaxUploadError{{Line: parseErr.Line, Reason: parseErr.Err.Error()}},
+		}, nil
+	}
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(err.Error())
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	row := parseTaxUploadRow(r.header, line, record)
+	return &row, nil
+}
+
+// readTaxUploadFile reads all rows of an upload into memory.
+func readTaxUploadFile(reader TaxUploadReader) (*TaxUploadFile, error) {
+	uploadFile := TaxUploadFile{Header: reader.Header(), IgnoredColumns: reader.IgnoredColumns()}
 	for {
-		record, err := reader.Read()
+		row, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, apperrs.NewBadRequestError(err.Error())
+			return nil, err
 		}
+		uploadFile.Rows = append(uploadFile.Rows, *row)
+	}
+	return &uploadFile, nil
+}
 
-		if len(record)!= constant.CSV_UPLOAD_COLUMN{
-			return nil, apperrs.NewBadRequestError(constant.MSG_UPLOAD_CSV_WRONG_FORMAT)
-		}
+// parseTaxUploadRow reads a row through the header mapping, an empty
+// allowance cell means the allowance is not claimed.
+func parseTaxUploadRow(header *uploadHeader, line int, record []string) TaxUploadRow {
+	row := TaxUploadRow{Line: line, Record: record}
+
+	if len(record) != len(header.names) {
+		row.Errors = []TaxUploadError{{Line: line, Reason: constant.MSG_UPLOAD_CSV_WRONG_FORMAT}}
+		return row
+	}
+
+	if header.rowId >= 0 {
+		row.Id = strings.TrimSpace(record[header.rowId])
+	}
 
-		taxRequest, err := parseTaxRequestRecord(record)
+	parseAmount := func(column int) money.Money {
+		amount, err := money.Parse(strings.TrimSpace(record[column]))
 		if err != nil {
-			return nil, apperrs.NewBadRequestError(err.Error())
+			row.Errors = append(row.Errors, TaxUploadError{Line: line, Column: header.names[column], Reason: constant.MSG_BU_VALIDATE_CSV_DIGIT_ONLY})
 		}
+		return amount
+	}
+
+	row.TaxRequest.TotalIncome = parseAmount(header.totalIncome)
+	row.TaxRequest.WHT = parseAmount(header.wht)
 
-		taxRequests = append(taxRequests, *taxRequest)
+	row.TaxRequest.Allowances = []Allowance{}
+	for column := range record {
+		allowanceType, ok := header.allowances[column]
+		if !ok || strings.TrimSpace(record[column]) == "" {
+			continue
+		}
+		row.TaxRequest.Allowances = append(row.TaxRequest.Allowances, Allowance{
+			AllowanceType: allowanceType,
+			Amount:        parseAmount(column),
+		})
 	}
 
-	return &taxRequests, nil
+	if len(row.Errors) > 0 {
+		row.TaxRequest = TaxRequest{}
+	}
+	return row
 }
 
-func parseTaxRequestRecord(record []string) (*TaxRequest, error) {
-	
-	totalIncome, err := strconv.ParseFloat(record[0], 64)
+// UploadCalculationTax calculates every row of the file with the tax rule of
+// the requested year. By default the first invalid row fails the upload, in
+// partial mode the valid rows are calculated and the invalid ones reported.
+func (t *TaxService) UploadCalculationTax(file io.Reader, options *TaxUploadOptions) (*TaxUploadResponse, error) {
+	//t.logger.Debug().Msg("Uploading calculation tax from reader")
+
+	taxRule, err := t.loadTaxRule(options.TaxYear)
 	if err != nil {
+		t.logger.Debug().Msg(err.Error())
 		return nil, err
 	}
 
-	wht, err := strconv.ParseFloat(record[1], 64)
+	uploadFile, err := t.parseUploadFile(file, options.ContentType, taxRule.Allowances.Types())
 	if err != nil {
+		t.logger.Debug().Msg(err.Error())
 		return nil, err
 	}
 
-	donation, err := strconv.ParseFloat(record[2], 64)
-	if err != nil {
-		return nil, err
+	uploadResponse := newTaxUploadResponse(uploadFile.Header, uploadFile.IgnoredColumns, taxRule)
+	for i := range uploadFile.Rows {
+		err = t.addTaxUploadRow(uploadResponse, &uploadFile.Rows[i], taxRule, options.Partial)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	allowance := Allowance{
-		AllowanceType: "donation",
-		Amount:        donation,
+	return uploadResponse, nil
+}
+
+func newTaxUploadResponse(header []string, ignoredColumns []string, taxRule *TaxRule) *TaxUploadResponse {
+	sheet := TaxUploadSheet{Header: header}
+	for _, bracket := range taxRule.Brackets {
+		sheet.Levels = append(sheet.Levels, bracket.Level)
 	}
+	return &TaxUploadResponse{IgnoredColumns: ignoredColumns, Sheet: &sheet}
+}
 
-	taxRequest := TaxRequest{
-		TotalIncome: totalIncome,
-		WHT:         wht,
-		Allowances:  []Allowance{allowance},
+// addTaxUploadRow calculates a row into the upload response. An invalid row
+// is returned as error unless partial, then it is reported with the response.
+func (t *TaxService) addTaxUploadRow(uploadResponse *TaxUploadResponse, row *TaxUploadRow, taxRule *TaxRule, partial bool) error {
+	rowErrors := row.Errors
+	if len(rowErrors) == 0 {
+		row.TaxRequest.TaxYear = taxRule.TaxYear
+		rowErrors = validateTaxUploadRow(row, taxRule)
 	}
 
-	return &taxRequest, nil
-}
+	sheet := uploadResponse.Sheet
+	if len(rowErrors) > 0 {
+		if !partial {
+			return apperrs.NewBadRequestError(taxUploadErrorMessage(rowErrors))
+		}
+		uploadResponse.Errors = append(uploadResponse.Errors, rowErrors...)
+		sheet.Rows = append(sheet.Rows, TaxUploadSheetRow{Record: row.Record, Errors: rowErrors})
+		return nil
+	}
 
+	taxResponse := t.calculateTaxWithRule(&row.TaxRequest, taxRule)
+	sheet.Rows = append(sheet.Rows, TaxUploadSheetRow{Record: row.Record, TaxResponse: taxResponse})
 
-func (t *TaxService) UploadCalculationTax(file io.Reader) (*TaxUploadResponse, error) {
-	//t.logger.Debug().Msg("Uploading calculation tax from reader")
+	taxUpload := getTaxUpload(&row.TaxRequest, taxResponse)
+	taxUpload.Id = row.Id
+	uploadResponse.Taxes = append(uploadResponse.Taxes, taxUpload)
+	return nil
+}
+
+// xlsxMagic is the zip local file header every .xlsx file starts with.
+var xlsxMagic = []byte("PK\x03\x04")
 
-	taxRequests, err := t.csvParser.ParseCSVToTaxRequest(file)
+// parseUploadFile picks the parser from the content type sent with the file
+// or, when that is missing or generic, from the first bytes of the file.
+func (t *TaxService) parseUploadFile(file io.Reader, contentType string, allowanceTypes []string) (*TaxUploadFile, error) {
+	file, isXLSX, err := detectXLSXUpload(file, contentType)
 	if err != nil {
-		t.logger.Debug().Msg(err.Error())
 		return nil, err
 	}
 
-	var taxUploads []TaxUpload
-	for _, taxRequest := range *taxRequests {
-		if err := ValidateTaxRequest(&taxRequest); err != nil {
-			return nil, apperrs.NewBadRequestError(err.Error())
-		}
+	if isXLSX {
+		return t.xlsxParser.ParseXLSXToTaxUploadRows(file, allowanceTypes)
+	}
+	return t.csvParser.ParseCSVToTaxUploadRows(file, allowanceTypes)
+}
 
-		taxResponse, err := t.CalculateTax(&taxRequest)
-		if err != nil {
-			t.logger.Debug().Msg(err.Error())
-			return nil, apperrs.NewInternalServerError(constant.MSG_BU_GENERAL_ERROR)
-		}
+// openUploadReader is parseUploadFile for reading the rows one by one.
+func (t *TaxService) openUploadReader(file io.Reader, contentType string, allowanceTypes []string) (TaxUploadReader, error) {
+	file, isXLSX, err := detectXLSXUpload(file, contentType)
+	if err != nil {
+		return nil, err
+	}
 
-		taxUpload := getTaxUpload(&taxRequest, taxResponse)
-		taxUploads = append(taxUploads, taxUpload)
+	if isXLSX {
+		return t.xlsxParser.NewXLSXTaxUploadReader(file, allowanceTypes)
 	}
+	return t.csvParser.NewCSVTaxUploadReader(file, allowanceTypes)
+}
 
-	return &TaxUploadResponse{Taxes: taxUploads}, nil
+func detectXLSXUpload(file io.Reader, contentType string) (io.Reader, bool, error) {
+	file, head, err := peekUpload(file, len(xlsxMagic))
+	if err != nil {
+		return nil, false, apperrs.NewBadRequestError(err.Error())
+	}
+	return file, contentType == constant.MIME_XLSX || bytes.Equal(head, xlsxMagic), nil
 }
 
+// peekUpload reads the first n bytes without consuming them. Uploaded files
+// can seek back, any other reader is buffered.
+func peekUpload(file io.Reader, n int) (io.Reader, []byte, error) {
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		head := make([]byte, n)
+		read, err := io.ReadFull(seeker, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, nil, err
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+		return file, head[:read], nil
+	}
 
+	reader := bufio.NewReader(file)
+	head, err := reader.Peek(n)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return reader, head, nil
+}
 
+// csvAllowanceTypes lists the allowance columns an upload of the tax year
+// may have.
+func (t *TaxService) csvAllowanceTypes(taxYear int) ([]string, error) {
+	taxYear, err := t.resolveTaxYear(taxYear)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := t.getAllowanceRegistry(taxYear, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return registry.Types(), nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"encoding/csv"
+	"io"
+	"regexp"
+
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/xuri/excelize/v2"
+)
+
+const taxUploadSheetName = "Sheet1"
+
+// records returns the uploaded rows with tax, taxRefund and the tax of every
+// bracket level appended. An error column is added when a row is invalid.
+func (s *TaxUploadSheet) records() [][]string {
+	withErrors := false
+	for _, row := range s.Rows {
+		if len(row.Errors) > 0 {
+			withErrors = true
+		}
+	}
+
+	header := append([]string{}, s.Header...)
+	header = append(header, "tax", "taxRefund")
+	header = append(header, s.Levels...)
+	if withErrors {
+		header = append(header, "error")
+	}
+
+	records := [][]string{header}
+	for _, row := range s.Rows {
+		record := make([]string, len(s.Header), len(header))
+		copy(record, row.Record)
+
+		if row.TaxResponse != nil {
+			record = append(record, row.TaxResponse.Tax.String(), row.TaxResponse.TaxRefund.String())
+			for _, step := range row.TaxResponse.TaxStep {
+				record = append(record, step.TaxAmount.String())
+			}
+		}
+		if withErrors {
+			for len(record) < len(header)-1 {
+				record = append(record, "")
+			}
+			record = append(record, taxUploadErrorMessage(row.Errors))
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func (s *TaxUploadSheet) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(s.records()); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// WriteXLSX writes the records to a single sheet, numbers are written as
+// numeric cells so they can be summed in the spreadsheet.
+func (s *TaxUploadSheet) WriteXLSX(w io.Writer) error {
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+
+	for i, record := range s.records() {
+		cells := make([]interface{}, len(record))
+		for j, value := range record {
+			cells[j] = xlsxCellValue(value, i == 0)
+		}
+
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := workbook.SetSheetRow(taxUploadSheetName, cell, &cells); err != nil {
+			return err
+		}
+	}
+
+	return workbook.Write(w)
+}
+
+// xlsxAmountPattern matches plain amounts, an identifier like 001234 keeps
+// its leading zeros as text.
+var xlsxAmountPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+func xlsxCellValue(value string, header bool) interface{} {
+	if header || !xlsxAmountPattern.MatchString(value) {
+		return value
+	}
+	amount, err := money.Parse(value)
+	if err != nil {
+		return value
+	}
+	return amount.Float64()
+}
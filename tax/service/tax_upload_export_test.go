@@ -0,0 +1,72 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func newTestTaxUploadSheet(t *testing.T, csvData string) *TaxUploadSheet {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	response, err := taxService.UploadCalculationTax(bytes.NewBufferString(csvData), &TaxUploadOptions{Partial: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.Sheet
+}
+
+func TestTaxUploadSheet_WriteCSV(t *testing.T) {
+	sheet := newTestTaxUploadSheet(t, "employeeId,totalIncome,wht\nE001,500000,0\nE002,600000,40000\n")
+
+	var buffer bytes.Buffer
+	err := sheet.WriteCSV(&buffer)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "employeeId,totalIncome,wht,tax,taxRefund,\"0-150,000\",\"150,001-500,000\",\"500,001-1,000,000\",\"1,000,001-2,000,000\",\"2,000,001 ขึ้นไป\"\n"+
+		"E001,500000,0,29000.00,0.00,0.00,29000.00,0.00,0.00,0.00\n"+
+		"E002,600000,40000,1000.00,0.00,0.00,35000.00,6000.00,0.00,0.00\n", buffer.String())
+}
+
+func TestTaxUploadSheet_WriteCSV_Errors(t *testing.T) {
+	sheet := newTestTaxUploadSheet(t, "totalIncome,wht\n500000,0\n600000,abc\n")
+
+	var buffer bytes.Buffer
+	err := sheet.WriteCSV(&buffer)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "totalIncome,wht,tax,taxRefund,\"0-150,000\",\"150,001-500,000\",\"500,001-1,000,000\",\"1,000,001-2,000,000\",\"2,000,001 ขึ้นไป\",error\n"+
+		"500000,0,29000.00,0.00,0.00,29000.00,0.00,0.00,0.00,\n"+
+		"600000,abc,,,,,,,,\"line 3, wht: column data in csv must only digits\"\n", buffer.String())
+}
+
+func TestTaxUploadSheet_WriteXLSX(t *testing.T) {
+	sheet := newTestTaxUploadSheet(t, "employeeId,totalIncome,wht\n001234,500000,0\n")
+
+	var buffer bytes.Buffer
+	err := sheet.WriteXLSX(&buffer)
+	assert.NoError(t, err)
+
+	workbook, err := excelize.OpenReader(&buffer)
+	assert.NoError(t, err)
+	defer workbook.Close()
+
+	rows, err := workbook.GetRows(taxUploadSheetName)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"employeeId", "totalIncome", "wht", "tax", "taxRefund", "0-150,000", "150,001-500,000", "500,001-1,000,000", "1,000,001-2,000,000", "2,000,001 ขึ้นไป"}, rows[0])
+
+	employeeId, err := workbook.GetCellType(taxUploadSheetName, "A2")
+	assert.NoError(t, err)
+	assert.NotEqual(t, excelize.CellTypeNumber, employeeId)
+
+	tax, err := workbook.GetCellValue(taxUploadSheetName, "D2")
+	assert.NoError(t, err)
+	assert.Equal(t, "29000", tax)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// uploadStreamWorkers is the number of rows calculated in parallel.
+var uploadStreamWorkers = runtime.GOMAXPROCS(0)
+
+// uploadStreamJob is a row on its way through the worker pool, result is
+// buffered so a worker never waits for the writer.
+type uploadStreamJob struct {
+	row    *TaxUploadRow
+	result chan *TaxUploadResult
+}
+
+// StreamCalculationTax calculates an upload row by row and hands every
+// result to emit in file order, without holding the file in memory. The tax
+// rule is loaded once. Errors with the file itself are returned before the
+// first emit, an invalid row is emitted with its errors and in strict mode
+// ends the stream.
+func (t *TaxService) StreamCalculationTax(ctx context.Context, file io.Reader, options *TaxUploadOptions, emit func(*TaxUploadResult) error) error {
+	taxRule, err := t.loadTaxRule(options.TaxYear)
+	if err != nil {
+		t.logger.Debug().Msg(err.Error())
+		return err
+	}
+
+	reader, err := t.openUploadReader(file, options.ContentType, taxRule.Allowances.Types())
+	if err != nil {
+		t.logger.Debug().Msg(err.Error())
+		return err
+	}
+	defer reader.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// pending keeps the results in file order and bounds the rows in flight
+	pending := make(chan chan *TaxUploadResult, uploadStreamWorkers*2)
+	jobs := make(chan uploadStreamJob)
+
+	var wg sync.WaitGroup
+	var readErr error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		defer close(jobs)
+
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+
+			job := uploadStreamJob{row: row, result: make(chan *TaxUploadResult, 1)}
+			select {
+			case pending <- job.result:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < uploadStreamWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job.result <- t.calculateUploadRow(job.row, taxRule)
+			}
+		}()
+	}
+
+	err = t.emitUploadResults(ctx, pending, options, emit)
+	cancel()
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	return readErr
+}
+
+func (t *TaxService) emitUploadResults(ctx context.Context, pending chan chan *TaxUploadResult, options *TaxUploadOptions, emit func(*TaxUploadResult) error) error {
+	for result := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var uploadResult *TaxUploadResult
+		select {
+		case uploadResult = <-result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := emit(uploadResult); err != nil {
+			return err
+		}
+
+		if len(uploadResult.Errors) > 0 && !options.Partial {
+			return nil
+		}
+	}
+	// the reader stops early when ctx is done
+	return ctx.Err()
+}
+
+func (t *TaxService) calculateUploadRow(row *TaxUploadRow, taxRule *TaxRule) *TaxUploadResult {
+	uploadResult := TaxUploadResult{Line: row.Line, Id: row.Id}
+
+	rowErrors := row.Errors
+	if len(rowErrors) == 0 {
+		row.TaxRequest.TaxYear = taxRule.TaxYear
+		rowErrors = validateTaxUploadRow(row, taxRule)
+	}
+	if len(rowErrors) > 0 {
+		uploadResult.Errors = rowErrors
+		return &uploadResult
+	}
+
+	taxResponse := t.calculateTaxWithRule(&row.TaxRequest, taxRule)
+	taxUpload := getTaxUpload(&row.TaxRequest, taxResponse)
+	uploadResult.TaxUpload = &taxUpload
+	return &uploadResult
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// collectResults is an emit func keeping every result
+func collectResults(results *[]*TaxUploadResult) func(*TaxUploadResult) error {
+	return func(result *TaxUploadResult) error {
+		*results = append(*results, result)
+		return nil
+	}
+}
+
+func TestStreamCalculationTax_Order(t *testing.T) {
+	taxService := newTestTaxService()
+
+	var csvData strings.Builder
+	csvData.WriteString("id,totalIncome,wht\n")
+	for i := 1; i <= 500; i++ {
+		fmt.Fprintf(&csvData, "E%03d,%d,0\n", i, 100000*i)
+	}
+
+	var results []*TaxUploadResult
+	err := taxService.StreamCalculationTax(context.Background(), strings.NewReader(csvData.String()), &TaxUploadOptions{}, collectResults(&results))
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 500)
+	for i, result := range results {
+		assert.Equal(t, i+2, result.Line)
+		assert.Equal(t, fmt.Sprintf("E%03d", i+1), result.Id)
+		assert.Equal(t, money.FromBaht(int64(100000*(i+1))), result.TotalIncome)
+	}
+	assert.Equal(t, money.FromBaht(29000), results[4].Tax)
+
+	// the deduction config is loaded once for the whole file
+	taxService.deductRepo.AssertNumberOfCalls(t, "FindByTaxYear", 1)
+	taxService.deductRepo.AssertNumberOfCalls(t, "FindById", 1)
+}
+
+func TestStreamCalculationTax_InvalidRow(t *testing.T) {
+	csvData := "totalIncome,wht\n500000,0\n600000,700000\n700000,0\n"
+
+	t.Run("Strict", func(t *testing.T) {
+		taxService := newTestTaxService()
+
+		var results []*TaxUploadResult
+		err := taxService.StreamCalculationTax(context.Background(), strings.NewReader(csvData), &TaxUploadOptions{}, collectResults(&results))
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		assert.Nil(t, results[1].TaxUpload)
+		assert.Equal(t, []TaxUploadError{{Line: 3, Column: "wht", Reason: constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME}}, results[1].Errors)
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		taxService := newTestTaxService()
+
+		var results []*TaxUploadResult
+		err := taxService.StreamCalculationTax(context.Background(), strings.NewReader(csvData), &TaxUploadOptions{Partial: true}, collectResults(&results))
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 3)
+		assert.NotEmpty(t, results[1].Errors)
+		assert.Equal(t, 4, results[2].Line)
+		assert.NotNil(t, results[2].TaxUpload)
+	})
+}
+
+func TestStreamCalculationTax_InvalidHeader(t *testing.T) {
+	taxService := newTestTaxService()
+
+	var results []*TaxUploadResult
+	err := taxService.StreamCalculationTax(context.Background(), strings.NewReader("totalIncome\n500000\n"), &TaxUploadOptions{}, collectResults(&results))
+
+	assert.EqualError(t, err, apperrs.NewBadRequestError(constant.MSG_UPLOAD_MISSING_COLUMN).Error())
+	assert.Empty(t, results)
+}
+
+func TestStreamCalculationTax_EmitFailed(t *testing.T) {
+	taxService := newTestTaxService()
+
+	var csvData strings.Builder
+	csvData.WriteString("totalIncome,wht\n")
+	for i := 0; i < 1000; i++ {
+		csvData.WriteString("500000,0\n")
+	}
+
+	emitted := 0
+	errClosed := errors.New("connection closed")
+	err := taxService.StreamCalculationTax(context.Background(), strings.NewReader(csvData.String()), &TaxUploadOptions{}, func(result *TaxUploadResult) error {
+		emitted++
+		if emitted == 3 {
+			return errClosed
+		}
+		return nil
+	})
+
+	assert.ErrorIs(t, err, errClosed)
+	assert.Equal(t, 3, emitted)
+}
+
+func TestStreamCalculationTax_Canceled(t *testing.T) {
+	taxService := newTestTaxService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := taxService.StreamCalculationTax(ctx, strings.NewReader("totalIncome,wht\n500000,0\n600000,0\n"), &TaxUploadOptions{}, func(result *TaxUploadResult) error {
+		return nil
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -5,39 +5,81 @@ import (
 	"testing"
 	"io"	
 
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/rs/zerolog"
-	"github.com/meteedev/assessment-tax/tax/repository"
 )
 
-func TestParseTaxRequestRecord(t *testing.T) {
+var testAllowanceTypes = []string{constant.DEDUCT_DONATION_ID, constant.DEDUCT_K_RECEIPT_ID}
+
+func TestParseTaxUploadRow(t *testing.T) {
+	header, err := parseUploadHeader([]string{"totalIncome", "wht", "donation"}, testAllowanceTypes)
+	assert.NoError(t, err)
+
 	tests := []struct {
 		record   []string
-		expected *TaxRequest
-		err      error
+		expected TaxRequest
 	}{
 		// Test case: Valid input
 		{
 			record: []string{"1000", "200", "50"},
-			expected: &TaxRequest{
-				TotalIncome: 1000,
-				WHT:         200,
+			expected: TaxRequest{
+				TotalIncome: money.FromBaht(1000),
+				WHT:         money.FromBaht(200),
+				Allowances: []Allowance{
+					{AllowanceType: "donation", Amount: money.FromBaht(50)},
+				},
+			},
+		},
+		// Test case: satang amounts are kept exactly
+		{
+			record: []string{"2160001", "200000.35", "20000000"},
+			expected: TaxRequest{
+				TotalIncome: money.FromBaht(2160001),
+				WHT:         money.Money(20000035),
 				Allowances: []Allowance{
-					{AllowanceType: "donation", Amount: 50},
+					{AllowanceType: "donation", Amount: money.FromBaht(20000000)},
 				},
 			},
-			err: nil,
+		},
+		// Test case: an empty allowance cell is not claimed
+		{
+			record: []string{"1000", "200", ""},
+			expected: TaxRequest{
+				TotalIncome: money.FromBaht(1000),
+				WHT:         money.FromBaht(200),
+				Allowances:  []Allowance{},
+			},
 		},
 	}
 
 	for _, test := range tests {
-		result, err := parseTaxRequestRecord(test.record)
-		assert.Equal(t, test.err, err, "Error mismatch")
-		assert.Equal(t, test.expected, result, "Result mismatch")
+		row := parseTaxUploadRow(header, 2, test.record)
+		assert.Empty(t, row.Errors, "Error mismatch")
+		assert.Equal(t, test.expected, row.TaxRequest, "Result mismatch")
 	}
 }
 
+func TestParseCSVUploadHeader(t *testing.T) {
+	header, err := parseUploadHeader([]string{"\ufeffEmployeeId", "K-Receipt", "WHT", " TotalIncome ", "name", "donation"}, testAllowanceTypes)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, header.rowId)
+	assert.Equal(t, 3, header.totalIncome)
+	assert.Equal(t, 2, header.wht)
+	assert.Equal(t, map[int]string{1: "k-receipt", 5: "donation"}, header.allowances)
+	assert.Equal(t, []string{"name"}, header.ignored)
+
+	_, err = parseUploadHeader([]string{"totalIncome", "donation"}, testAllowanceTypes)
+	assert.EqualError(t, err, constant.MSG_UPLOAD_MISSING_COLUMN)
+
+	_, err = parseUploadHeader([]string{"totalIncome", "wht", "WHT"}, testAllowanceTypes)
+	assert.EqualError(t, err, constant.MSG_UPLOAD_DUPLICATE_COLUMN+"WHT")
+}
+
 func TestParseCSVToTaxRequest(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -46,7 +88,7 @@ func TestParseCSVToTaxRequest(t *testing.T) {
 	}{
 		{
 			name:    "Valid CSV",
-			csvData: "1000,50,25\n2000,75,30\n",
+			csvData: "totalIncome,wht,donation\n1000,50,25\n2000,75,30\n",
 		},
 	}
 
@@ -55,7 +97,7 @@ func TestParseCSVToTaxRequest(t *testing.T) {
 			csvParser := CSVParserImpl{}
 			csvData := strings.NewReader(tc.csvData)
 			
-			taxRequests, err := csvParser.ParseCSVToTaxRequest(csvData)
+			taxRequests, err := csvParser.ParseCSVToTaxRequest(csvData, testAllowanceTypes)
 			
 			assert.NoError(t, err)
 			assert.NotNil(t, taxRequests)
@@ -71,11 +113,21 @@ type MockCSVParser struct {
 }
 
 // ParseCSVToTaxRequest mocks parsing CSV to tax request.
-func (m *MockCSVParser) ParseCSVToTaxRequest(file io.Reader) (*[]TaxRequest, error) {
-	args := m.Called(file)
+func (m *MockCSVParser) ParseCSVToTaxRequest(file io.Reader, allowanceTypes []string) (*[]TaxRequest, error) {
+	args := m.Called(file, allowanceTypes)
 	return args.Get(0).(*[]TaxRequest), args.Error(1)
 }
 
+func (m *MockCSVParser) NewCSVTaxUploadReader(file io.Reader, allowanceTypes []string) (TaxUploadReader, error) {
+	args := m.Called(file, allowanceTypes)
+	return args.Get(0).(TaxUploadReader), args.Error(1)
+}
+
+func (m *MockCSVParser) ParseCSVToTaxUploadRows(file io.Reader, allowanceTypes []string) (*TaxUploadFile, error) {
+	args := m.Called(file, allowanceTypes)
+	return args.Get(0).(*TaxUploadFile), args.Error(1)
+}
+
 
 
 
@@ -85,22 +137,22 @@ func TestUploadCalculationTax(t *testing.T) {
 	logger := &zerolog.Logger{}
 	mockRepo := new(MockTaxDeductConfigPort)
 	mockCSVParser := new(MockCSVParser)
-	mockTaxService := NewTaxService(logger, mockRepo, mockCSVParser)
+	mockTaxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), mockCSVParser)
 
 	// Test cases
 	testCases := []struct {
 		name          string
 		csvData       io.Reader
-		mockReturn    *[]TaxRequest
+		mockReturn    *TaxUploadFile
 		mockErr       error
 		expectedError error
 	}{
 		{
 			name:    "Valid CSV",
 			csvData: strings.NewReader("1000,50,25\n2000,75,30\n"),
-			mockReturn: &[]TaxRequest{
-				{TotalIncome: 500000, WHT: 0, Allowances: []Allowance{{AllowanceType: "donation", Amount: 0}}},
-			},
+			mockReturn: &TaxUploadFile{Rows: []TaxUploadRow{
+				{Line: 2, TaxRequest: TaxRequest{TotalIncome: money.FromBaht(500000), WHT: 0, Allowances: []Allowance{{AllowanceType: "donation", Amount: 0}}}},
+			}},
 			mockErr:       nil,
 			expectedError: nil,
 		},
@@ -108,9 +160,9 @@ func TestUploadCalculationTax(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			mockCSVParser.On("ParseCSVToTaxRequest", tc.csvData).Return(tc.mockReturn, tc.mockErr).Once()
-			mockRepo.On("FindById", "personal").Return(&repository.TaxDeductConfig{Amount: 60000}, nil)
-			response, err := mockTaxService.UploadCalculationTax(tc.csvData)
+			mockCSVParser.On("ParseCSVToTaxUploadRows", tc.csvData, []string{"donation", "donation-education", "k-receipt"}).Return(tc.mockReturn, tc.mockErr).Once()
+			mockDefaultDeductConfig(mockRepo)
+			response, err := mockTaxService.UploadCalculationTax(tc.csvData, &TaxUploadOptions{})
 
 			if tc.expectedError != nil {
 				assert.EqualError(t, err, tc.expectedError.Error())
@@ -123,4 +175,98 @@ func TestUploadCalculationTax(t *testing.T) {
 			mockCSVParser.AssertExpectations(t)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestParseCSVToTaxUploadRows(t *testing.T) {
+	csvParser := CSVParserImpl{}
+	csvData := strings.NewReader("totalIncome,wht,donation\n500000,0,0\n600000,abc,0\n700000,0\n\"800000,0,0\n")
+
+	uploadFile, err := csvParser.ParseCSVToTaxUploadRows(csvData, testAllowanceTypes)
+	rows := uploadFile.Rows
+
+	assert.NoError(t, err)
+	assert.Len(t, rows, 4)
+	assert.Equal(t, TaxUploadRow{Line: 2, Record: []string{"500000", "0", "0"}, TaxRequest: TaxRequest{TotalIncome: money.FromBaht(500000), Allowances: []Allowance{{AllowanceType: "donation", Amount: 0}}}}, rows[0])
+	assert.Equal(t, []TaxUploadError{{Line: 3, Column: "wht", Reason: constant.MSG_BU_VALIDATE_CSV_DIGIT_ONLY}}, rows[1].Errors)
+	assert.Equal(t, []TaxUploadError{{Line: 4, Reason: constant.MSG_UPLOAD_CSV_WRONG_FORMAT}}, rows[2].Errors)
+	assert.Equal(t, 5, rows[3].Line)
+	assert.NotEmpty(t, rows[3].Errors)
+}
+
+func TestParseCSVToTaxRequest_InvalidRow(t *testing.T) {
+	csvParser := CSVParserImpl{}
+	csvData := strings.NewReader("totalIncome,wht,donation\n500000,0,0\n600000,abc,0\n")
+
+	taxRequests, err := csvParser.ParseCSVToTaxRequest(csvData, testAllowanceTypes)
+
+	assert.Nil(t, taxRequests)
+	assert.EqualError(t, err, apperrs.NewBadRequestError("line 3, wht: "+constant.MSG_BU_VALIDATE_CSV_DIGIT_ONLY).Error())
+}
+
+func TestUploadCalculationTax_Partial(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	csvData := "totalIncome,wht,donation\n500000,0,0\n600000,700000,0\n700000,0,-1\n800000,x,0\n"
+
+	response, err := taxService.UploadCalculationTax(strings.NewReader(csvData), &TaxUploadOptions{Partial: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxUpload{{TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(29000)}}, response.Taxes)
+	assert.Equal(t, []TaxUploadError{
+		{Line: 3, Column: "wht", Reason: constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME},
+		{Line: 4, Column: "donation", Reason: "donation allowance must not be less than 0"},
+		{Line: 5, Column: "wht", Reason: constant.MSG_BU_VALIDATE_CSV_DIGIT_ONLY},
+	}, response.Errors)
+	assert.Equal(t, "line 3, wht: wht can not greater than Total income", response.Errors[0].Error())
+}
+
+func TestUploadCalculationTax_Strict(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	csvData := "totalIncome,wht,donation\n500000,0,0\n-1,0,0\n600000,700000,0\n"
+
+	response, err := taxService.UploadCalculationTax(strings.NewReader(csvData), &TaxUploadOptions{})
+
+	assert.Nil(t, response)
+	assert.EqualError(t, err, apperrs.NewBadRequestError("line 3, totalIncome: "+constant.MSG_BU_INVALID_TOTAL_INCOME_LESS_THAN_OR_EQUAL_ZERO+"; line 3, wht: "+constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME).Error())
+}
+
+func TestUploadCalculationTax_HeaderMapping(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	csvData := "employeeId,Name,WHT,TotalIncome,k-receipt,donation\nE001,Somchai,0,500000,200000,\nE002,Somsri,0,500000,,200000\n"
+
+	response, err := taxService.UploadCalculationTax(strings.NewReader(csvData), &TaxUploadOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxUpload{
+		{Id: "E001", TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(24000)},
+		{Id: "E002", TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(24600)},
+	}, response.Taxes)
+	assert.Equal(t, []string{"Name"}, response.IgnoredColumns)
+}
+
+func TestUploadCalculationTax_MissingColumn(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	response, err := taxService.UploadCalculationTax(strings.NewReader("totalIncome,donation\n500000,0\n"), &TaxUploadOptions{})
+
+	assert.Nil(t, response)
+	assert.EqualError(t, err, apperrs.NewBadRequestError(constant.MSG_UPLOAD_MISSING_COLUMN).Error())
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"io"
+	"strings"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/xuri/excelize/v2"
+)
+
+type XLSXParser interface {
+	ParseXLSXToTaxUploadRows(file io.Reader, allowanceTypes []string) (*TaxUploadFile, error)
+	NewXLSXTaxUploadReader(file io.Reader, allowanceTypes []string) (TaxUploadReader, error)
+}
+
+type XLSXParserImpl struct{}
+
+// ParseXLSXToTaxUploadRows parses the first sheet of a workbook with the same
+// columns as the csv upload, Line is the row number in the sheet.
+func (x *XLSXParserImpl) ParseXLSXToTaxUploadRows(file io.Reader, allowanceTypes []string) (*TaxUploadFile, error) {
+	reader, err := x.NewXLSXTaxUploadReader(file, allowanceTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return readTaxUploadFile(reader)
+}
+
+// NewXLSXTaxUploadReader reads the header of the first sheet, the rows of the
+// sheet are then read one by one.
+func (x *XLSXParserImpl) NewXLSXTaxUploadReader(file io.Reader, allowanceTypes []string) (TaxUploadReader, error) {
+	workbook, err := excelize.OpenReader(file)
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(constant.MSG_UPLOAD_XLSX_INVALID)
+	}
+
+	reader := xlsxTaxUploadReader{workbook: workbook}
+	if err := reader.readHeader(allowanceTypes); err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return &reader, nil
+}
+
+type xlsxTaxUploadReader struct {
+	workbook *excelize.File
+	rows     *excelize.Rows
+	line     int
+	header   *uploadHeader
+}
+
+func (r *xlsxTaxUploadReader) readHeader(allowanceTypes []string) error {
+	sheets := r.workbook.GetSheetList()
+	if len(sheets) == 0 {
+		return apperrs.NewBadRequestError(constant.MSG_UPLOAD_XLSX_INVALID)
+	}
+
+	rows, err := r.workbook.Rows(sheets[0])
+	if err != nil {
+		return apperrs.NewBadRequestError(constant.MSG_UPLOAD_XLSX_INVALID)
+	}
+	r.rows = rows
+
+	record, err := r.next()
+	if err == io.EOF {
+		return apperrs.NewBadRequestError(constant.MSG_UPLOAD_MISSING_COLUMN)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.header, err = parseUploadHeader(record, allowanceTypes)
+	if err != nil {
+		return apperrs.NewBadRequestError(err.Error())
+	}
+	return nil
+}
+
+// next returns the cells of the next row, a row missing from the sheet is
+// returned empty so line keeps matching the row number.
+func (r *xlsxTaxUploadReader) next() ([]string, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Error(); err != nil {
+			return nil, apperrs.NewBadRequestError(constant.MSG_UPLOAD_XLSX_INVALID)
+		}
+		return nil, io.EOF
+	}
+	r.line++
+
+	// raw values, a formatted cell would read "500,000.00"
+	record, err := r.rows.Columns(excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, apperrs.NewBadRequestError(constant.MSG_UPLOAD_XLSX_INVALID)
+	}
+	return record, nil
+}
+
+func (r *xlsxTaxUploadReader) Header() []string {
+	return r.header.names
+}
+
+func (r *xlsxTaxUploadReader) IgnoredColumns() []string {
+	return r.header.ignored
+}
+
+func (r *xlsxTaxUploadReader) Read() (*TaxUploadRow, error) {
+	for {
+		record, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if isEmptyRecord(record) {
+			continue
+		}
+
+		// trailing empty cells are not returned by excelize
+		for len(record) < len(r.header.names) {
+			record = append(record, "")
+		}
+
+		row := parseTaxUploadRow(r.header, r.line, record)
+		return &row, nil
+	}
+}
+
+func (r *xlsxTaxUploadReader) Close() error {
+	if r.rows != nil {
+		r.rows.Close()
+	}
+	return r.workbook.Close()
+}
+
+func isEmptyRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/meteedev/assessment-tax/apperrs"
+	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+// newTestWorkbook writes the rows to the first sheet of a new workbook.
+func newTestWorkbook(t *testing.T, rows [][]interface{}) *bytes.Buffer {
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := workbook.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buffer, err := workbook.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer
+}
+
+func TestParseXLSXToTaxUploadRows(t *testing.T) {
+	xlsxParser := XLSXParserImpl{}
+	workbook := newTestWorkbook(t, [][]interface{}{
+		{"employeeId", "totalIncome", "wht", "donation"},
+		{"E001", 500000, 0, 100.5},
+		{},
+		{"E002", 600000, "abc"},
+	})
+
+	uploadFile, err := xlsxParser.ParseXLSXToTaxUploadRows(workbook, testAllowanceTypes)
+
+	assert.NoError(t, err)
+	assert.Len(t, uploadFile.Rows, 2)
+	assert.Equal(t, TaxUploadRow{Line: 2, Id: "E001", Record: []string{"E001", "500000", "0", "100.5"}, TaxRequest: TaxRequest{TotalIncome: money.FromBaht(500000), Allowances: []Allowance{{AllowanceType: "donation", Amount: money.Money(10050)}}}}, uploadFile.Rows[0])
+	assert.Equal(t, []TaxUploadError{{Line: 4, Column: "wht", Reason: constant.MSG_BU_VALIDATE_CSV_DIGIT_ONLY}}, uploadFile.Rows[1].Errors)
+}
+
+func TestParseXLSXToTaxUploadRows_Invalid(t *testing.T) {
+	xlsxParser := XLSXParserImpl{}
+
+	_, err := xlsxParser.ParseXLSXToTaxUploadRows(bytes.NewBufferString("totalIncome,wht\n"), testAllowanceTypes)
+	assert.Error(t, err)
+
+	_, err = xlsxParser.ParseXLSXToTaxUploadRows(newTestWorkbook(t, [][]interface{}{{"totalIncome", "donation"}}), testAllowanceTypes)
+	assert.EqualError(t, err, apperrs.NewBadRequestError(constant.MSG_UPLOAD_MISSING_COLUMN).Error())
+}
+
+func TestUploadCalculationTax_XLSX(t *testing.T) {
+	logger := &zerolog.Logger{}
+	mockRepo := new(MockTaxDeductConfigPort)
+	taxService := NewTaxService(logger, mockRepo, newMockTaxBracketPort(), newMockTaxFilingPort(), new(MockTaxBatchPort), &CSVParserImpl{})
+
+	mockDefaultDeductConfig(mockRepo)
+
+	rows := [][]interface{}{
+		{"totalIncome", "wht", "k-receipt"},
+		{500000, 0, 200000},
+	}
+
+	testCases := []struct {
+		name        string
+		contentType string
+	}{
+		{name: "Content type", contentType: constant.MIME_XLSX},
+		{name: "Magic bytes", contentType: "application/octet-stream"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response, err := taxService.UploadCalculationTax(newTestWorkbook(t, rows), &TaxUploadOptions{ContentType: tc.contentType})
+
+			assert.NoError(t, err)
+			assert.Equal(t, []TaxUpload{{TotalIncome: money.FromBaht(500000), Tax: money.FromBaht(24000)}}, response.Taxes)
+		})
+	}
+}
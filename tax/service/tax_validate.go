@@ -4,22 +4,27 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
 )
 
 
-var validAllowanceTypes = []string{"donation", "k-receipt"}
+var deductTypePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,49}$`)
 
 
 func ValidateTaxRequest(taxRequest *TaxRequest) error {
 	//fmt.Println("taxRequest.WHT ",taxRequest.WHT)
 	var errMsgs []string
 	
+	validateTaxYear(taxRequest.TaxYear,&errMsgs)
 	validateTotalIncome(taxRequest.TotalIncome,&errMsgs)
 	validateWht(taxRequest.WHT,taxRequest.TotalIncome, &errMsgs)
-	validateAllowances(taxRequest,&errMsgs)
+	validateIncomes(taxRequest.TotalIncome,taxRequest.Incomes,&errMsgs)
+	validateFilingStatus(taxRequest,&errMsgs)
 
 	if len(errMsgs) > 0 {
 		return errors.New(strings.Join(errMsgs, "; "))
@@ -29,26 +34,89 @@ func ValidateTaxRequest(taxRequest *TaxRequest) error {
 }
 
 
-func validateTotalIncome(totalIncome float64,errMsgs *[]string){
+// validateIncomes checks the incomes by category add up to the total income
+func validateIncomes(totalIncome money.Money,incomes []Income,errMsgs *[]string){
+	if len(incomes) == 0 {
+		return
+	}
+
+	var sum money.Money
+	for _, income := range incomes {
+		if income.Amount < 0 {
+			*errMsgs = append(*errMsgs, fmt.Sprintf("income %s amount must not be less than 0", income.Category))
+		}
+		sum += income.Amount
+	}
+
+	if sum != totalIncome {
+		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_TOTAL_INCOME_NOT_SUM_OF_INCOMES)
+	}
+}
+
+
+// validateFilingStatus accepts an empty filing status as single, a spouse is
+// required for joint and separate filings and not allowed otherwise
+func validateFilingStatus(taxRequest *TaxRequest,errMsgs *[]string){
+	switch taxRequest.FilingStatus {
+	case "", constant.FILING_STATUS_SINGLE:
+		if taxRequest.Spouse != nil {
+			*errMsgs = append(*errMsgs, constant.MSG_BU_SPOUSE_NOT_ALLOWED)
+		}
+	case constant.FILING_STATUS_JOINT, constant.FILING_STATUS_SEPARATE:
+		if taxRequest.Spouse == nil {
+			*errMsgs = append(*errMsgs, constant.MSG_BU_SPOUSE_REQUIRED)
+		} else {
+			validateSpouseIncome(taxRequest.Spouse,errMsgs)
+		}
+	default:
+		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_FILING_STATUS)
+	}
+}
+
+
+func validateSpouseIncome(spouse *SpouseIncome,errMsgs *[]string){
+	if spouse.TotalIncome < 0 {
+		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_SPOUSE_TOTAL_INCOME_LESS_THAN_ZERO)
+	}
+
+	var spouseErrMsgs []string
+	validateWht(spouse.WHT,spouse.TotalIncome,&spouseErrMsgs)
+	validateIncomes(spouse.TotalIncome,spouse.Incomes,&spouseErrMsgs)
+	for _, errMsg := range spouseErrMsgs {
+		*errMsgs = append(*errMsgs, "spouse "+errMsg)
+	}
+}
+
+
+// validateTaxYear accepts 0 as "not specified", the latest configured year is used then
+func validateTaxYear(taxYear int,errMsgs *[]string){
+	if taxYear < 0 {
+		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_TAX_YEAR)
+	}
+}
+
+
+func validateTotalIncome(totalIncome money.Money,errMsgs *[]string){
 	//onlyDigits(totalIncome , errMsgs)
 	validateTotalIncomeGreaterThanOrEqualZero(totalIncome,errMsgs)
 }
 
 
-func validateWht(wht float64,totalIncome float64,errMsgs *[]string){
+func validateWht(wht money.Money,totalIncome money.Money,errMsgs *[]string){
 	validateWhtGreaterThanOrEqualZero(wht , errMsgs)
 	validateWhtNotGreaterThanTotalIncome(wht,totalIncome,errMsgs)
 }
 
 
 
-func ValidateKreceiptAllowance(amount float64) error {
-	//fmt.Println("taxRequest.WHT ",taxRequest.WHT)
+// ValidateDeductAmount checks an amount against the bounds stored with the
+// deduction config
+func ValidateDeductAmount(amount money.Money,config *repository.TaxDeductConfig) error {
 	var errMsgs []string
 
-	validateKreceiptAllowanceGreaterThanOrEqualZero(amount,&errMsgs)
-	validateKreceiptAllowanceMinimum(amount,&errMsgs)
-	validateKreceiptAllowanceMaximum(amount,&errMsgs)
+	validateDeductAmountGreaterThanOrEqualZero(amount,&errMsgs)
+	validateDeductAmountMinimum(amount,config,&errMsgs)
+	validateDeductAmountMaximum(amount,config,&errMsgs)
 
 	if len(errMsgs) > 0 {
 		return errors.New(strings.Join(errMsgs, "; "))
@@ -58,116 +126,103 @@ func ValidateKreceiptAllowance(amount float64) error {
 }
 
 
-func ValidatePersonaAllowance(amount float64) error {
-	//fmt.Println("taxRequest.WHT ",taxRequest.WHT)
+func ValidateCreateDeductRequest(createReq *CreateDeductRequest) error {
 	var errMsgs []string
-	
-	validatePersonalAllowanceGreaterThanOrEqualZero(amount,&errMsgs)
-	validatePersonalAllowanceMinimum(amount,&errMsgs)
-	validatePersonalAllowanceMaximum(amount,&errMsgs)
 
-	if len(errMsgs) > 0 {
-		return errors.New(strings.Join(errMsgs, "; "))
+	if !deductTypePattern.MatchString(createReq.DeductType) {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_DEDUCT_TYPE)
 	}
 
-	return nil
-}
+	validateTaxYear(createReq.TaxYear,&errMsgs)
 
+	validateCapRule(createReq.CapRule,&errMsgs)
 
-func validateWhtGreaterThanOrEqualZero(wht float64, errMsgs *[]string) {		
-	//fmt.Println("wht ",wht)
-	if wht < 0 {
-		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_WHT_LESS_THAN_ZERO)
+	if createReq.CapRule == constant.DEDUCT_CAP_RULE_PERCENT_OF_NET && (createReq.Rate <= 0 || createReq.Rate > 1) {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_DEDUCT_RATE)
+	}
+	if createReq.Multiplier < 0 {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_DEDUCT_MULTIPLIER)
 	}
-}
 
-func validateWhtNotGreaterThanTotalIncome(wht float64,totalIncome float64, errMsgs *[]string) {		
-	//fmt.Println("wht ",wht)
-	if wht > totalIncome {
-		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME) 
+	if createReq.MinAmount < 0 || createReq.MaxAmount < 0 {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_DEDUCT_AMOUNT_LESS_THAN_ZERO)
 	}
-}
 
+	if createReq.MinAmount > createReq.MaxAmount {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_DEDUCT_MIN_MAX)
+	} else {
+		config := repository.TaxDeductConfig{
+			DeductId:  createReq.DeductType,
+			MinAmount: createReq.MinAmount,
+			MaxAmount: createReq.MaxAmount,
+		}
+		validateDeductAmountMinimum(createReq.Amount,&config,&errMsgs)
+		validateDeductAmountMaximum(createReq.Amount,&config,&errMsgs)
+	}
 
-func validateAllowances(taxRequest *TaxRequest, errMsgs *[]string) error {
-	
-	for _, allowance := range taxRequest.Allowances {
-		validateAllowanceTypes(allowance.AllowanceType, errMsgs)
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
 	}
 
 	return nil
 }
 
 
-func validateAllowanceTypes(allowanceType string, errMsgs *[]string) {
-	if !contains(validAllowanceTypes, allowanceType) {
-		*errMsgs = append(*errMsgs, fmt.Sprintf("Allowance must be one of: %s", strings.Join(validAllowanceTypes, ", ")))
+// validateCapRule accepts an empty cap rule, the deduction is then claimable
+// up to its amount
+func validateCapRule(capRule string,errMsgs *[]string){
+	if capRule == "" {
+		return
 	}
-}
-
-func contains(arr []string, str string) bool {
-	for _, a := range arr {
-		if a == str {
-			return true
-		}
+	if _, ok := capRuleCalculators[capRule]; ok {
+		return
 	}
-	return false
-}
-
 
-
-
-func validatePersonalAllowanceGreaterThanOrEqualZero(amount float64, errMsgs *[]string) {		
-	//fmt.Println("wht ",wht)
-	if amount < 0 {
-		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_PERSONAL_ALLOW_LESS_THAN_ZERO)
+	var capRules []string
+	for rule := range capRuleCalculators {
+		capRules = append(capRules, rule)
 	}
+	sort.Strings(capRules)
+	*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_DEDUCT_CAP_RULE + strings.Join(capRules, ", "))
 }
 
-func validatePersonalAllowanceMinimum(amount float64, errMsgs *[]string) {		
+
+func validateWhtGreaterThanOrEqualZero(wht money.Money, errMsgs *[]string) {		
 	//fmt.Println("wht ",wht)
-	if amount < constant.MIN_ALLOWANCE_PERSONAL {
-		msg := fmt.Sprintf("Personal deductibles start at %.2f baht", constant.MIN_ALLOWANCE_PERSONAL)
-		*errMsgs = append(*errMsgs,msg)
+	if wht < 0 {
+		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_WHT_LESS_THAN_ZERO)
 	}
 }
 
-func validatePersonalAllowanceMaximum(amount float64, errMsgs *[]string) {		
+func validateWhtNotGreaterThanTotalIncome(wht money.Money,totalIncome money.Money, errMsgs *[]string) {		
 	//fmt.Println("wht ",wht)
-	if amount > constant.MAX_ALLOWANCE_PERSONAL {
-		msg := fmt.Sprintf("Maximum Personal deductibles %.2f baht", constant.MAX_ALLOWANCE_PERSONAL)
-		*errMsgs = append(*errMsgs,msg)
+	if wht > totalIncome {
+		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME) 
 	}
 }
 
 
-
-
-
-func validateKreceiptAllowanceGreaterThanOrEqualZero(amount float64, errMsgs *[]string) {		
-	//fmt.Println("wht ",wht)
+func validateDeductAmountGreaterThanOrEqualZero(amount money.Money, errMsgs *[]string) {
 	if amount < 0 {
-		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_K_RECEIPT_ALLOW_LESS_THAN_ZERO)
+		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_DEDUCT_AMOUNT_LESS_THAN_ZERO)
 	}
 }
 
-func validateKreceiptAllowanceMinimum(amount float64, errMsgs *[]string) {		
-	//fmt.Println("wht ",wht)
-	if amount < constant.MIN_ALLOWANCE_K_RECEIPT {
-		msg := fmt.Sprintf("k-receipt deductibles start at %.2f baht", constant.MIN_ALLOWANCE_K_RECEIPT)
+func validateDeductAmountMinimum(amount money.Money, config *repository.TaxDeductConfig, errMsgs *[]string) {
+	if amount < config.MinAmount {
+		msg := fmt.Sprintf("%s deductibles start at %s baht", config.DeductId, config.MinAmount)
 		*errMsgs = append(*errMsgs,msg)
 	}
 }
 
-func validateKreceiptAllowanceMaximum(amount float64, errMsgs *[]string) {		
-	//fmt.Println("wht ",wht)
-	if amount > constant.MAX_ALLOWANCE_K_RECEIPT {
-		msg := fmt.Sprintf("Maximum k-receipt deductibles %.2f baht", constant.MAX_ALLOWANCE_K_RECEIPT)
+func validateDeductAmountMaximum(amount money.Money, config *repository.TaxDeductConfig, errMsgs *[]string) {
+	if amount > config.MaxAmount {
+		msg := fmt.Sprintf("Maximum %s deductibles %s baht", config.DeductId, config.MaxAmount)
 		*errMsgs = append(*errMsgs,msg)
 	}
 }
 
-func validateTotalIncomeGreaterThanOrEqualZero(amount float64, errMsgs *[]string) {		
+func validateTotalIncomeGreaterThanOrEqualZero(amount money.Money, errMsgs *[]string) {		
 	//fmt.Println("wht ",wht)
 	if amount <= 0 {
 		*errMsgs = append(*errMsgs, constant.MSG_BU_INVALID_TOTAL_INCOME_LESS_THAN_OR_EQUAL_ZERO)
@@ -211,4 +266,126 @@ func ValidateUploadTaxCsvRecord(record []string ) error {
 	}  
 	
 	return nil
-}
\ No newline at end of file
+}
+
+
+
+// validateTaxUploadRow validates a parsed upload row column by column, the
+// allowance columns are named after their allowance type.
+func validateTaxUploadRow(row *TaxUploadRow, taxRule *TaxRule) []TaxUploadError {
+	var uploadErrors []TaxUploadError
+	addErrors := func(column string, errMsgs []string) {
+		for _, errMsg := range errMsgs {
+			uploadErrors = append(uploadErrors, TaxUploadError{Line: row.Line, Column: column, Reason: errMsg})
+		}
+	}
+
+	var incomeErrMsgs []string
+	validateTotalIncome(row.TaxRequest.TotalIncome, &incomeErrMsgs)
+	addErrors(constant.CSV_COLUMN_TOTAL_INCOME, incomeErrMsgs)
+
+	var whtErrMsgs []string
+	validateWht(row.TaxRequest.WHT, row.TaxRequest.TotalIncome, &whtErrMsgs)
+	addErrors(constant.CSV_COLUMN_WHT, whtErrMsgs)
+
+	for _, allowance := range row.TaxRequest.Allowances {
+		if err := taxRule.Allowances.Validate([]Allowance{allowance}); err != nil {
+			addErrors(allowance.AllowanceType, []string{err.Error()})
+		}
+	}
+
+	return uploadErrors
+}
+
+
+func taxUploadErrorMessage(uploadErrors []TaxUploadError) string {
+	errMsgs := make([]string, 0, len(uploadErrors))
+	for _, uploadError := range uploadErrors {
+		errMsgs = append(errMsgs, uploadError.Error())
+	}
+	return strings.Join(errMsgs, "; ")
+}
+
+
+func ValidateTaxFilingQuery(query *TaxFilingQuery) error {
+	var errMsgs []string
+
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_FILING_DATE_RANGE)
+	}
+
+	if query.MinIncome != nil && query.MaxIncome != nil && *query.MinIncome > *query.MaxIncome {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_FILING_INCOME_RANGE)
+	}
+
+	if query.Outcome != "" && query.Outcome != constant.TAX_FILING_OUTCOME_PAYABLE && query.Outcome != constant.TAX_FILING_OUTCOME_REFUND {
+		errMsgs = append(errMsgs, fmt.Sprintf("outcome must be one of: %s, %s", constant.TAX_FILING_OUTCOME_PAYABLE, constant.TAX_FILING_OUTCOME_REFUND))
+	}
+
+	if query.Limit < 0 || query.Limit > constant.TAX_FILING_PAGE_SIZE_MAX {
+		errMsgs = append(errMsgs, fmt.Sprintf("limit must be between 1 and %d", constant.TAX_FILING_PAGE_SIZE_MAX))
+	}
+
+	if query.Cursor < 0 {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_FILING_CURSOR)
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
+
+
+func ValidateGrossUpRequest(grossUpReq *GrossUpRequest) error {
+	var errMsgs []string
+
+	validateTaxYear(grossUpReq.TaxYear, &errMsgs)
+	if grossUpReq.NetIncome < 0 {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_NET_INCOME_LESS_THAN_ZERO)
+	}
+	if grossUpReq.NetIncome > constant.GROSS_UP_MAX_INCOME {
+		errMsgs = append(errMsgs, constant.MSG_BU_INVALID_NET_INCOME_TOO_LARGE)
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
+
+
+func ValidateTaxCompareRequest(compareReq *TaxCompareRequest) error {
+	var errMsgs []string
+
+	if len(compareReq.Scenarios) == 0 {
+		errMsgs = append(errMsgs, constant.MSG_BU_COMPARE_SCENARIOS_EMPTY)
+	}
+	if len(compareReq.Scenarios) > constant.TAX_COMPARE_SCENARIOS_MAX {
+		errMsgs = append(errMsgs, fmt.Sprintf("scenarios must not be more than %d", constant.TAX_COMPARE_SCENARIOS_MAX))
+	}
+
+	names := map[string]bool{}
+	emptyName := false
+	for _, scenario := range compareReq.Scenarios {
+		if strings.TrimSpace(scenario.Name) == "" {
+			emptyName = true
+			continue
+		}
+		if names[scenario.Name] {
+			errMsgs = append(errMsgs, constant.MSG_BU_COMPARE_SCENARIO_NAME_DUPLICATE+scenario.Name)
+		}
+		names[scenario.Name] = true
+	}
+	if emptyName {
+		errMsgs = append(errMsgs, constant.MSG_BU_COMPARE_SCENARIO_NAME_EMPTY)
+	}
+
+	if len(errMsgs) > 0 {
+		return errors.New(strings.Join(errMsgs, "; "))
+	}
+
+	return nil
+}
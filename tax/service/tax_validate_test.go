@@ -2,16 +2,18 @@ package service
 
 import (
 	"errors"
-	"fmt"
 	"testing"
+	"time"
 
 	"github.com/meteedev/assessment-tax/constant"
+	"github.com/meteedev/assessment-tax/money"
+	"github.com/meteedev/assessment-tax/tax/repository"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestValidateTotalIncomeGreaterThanOrEqualZero(t *testing.T) {
     // Test case 1: amount is greater than zero
-    amount := 100.0
+    amount := money.FromBaht(100)
     errMsgs := []string{}
     validateTotalIncomeGreaterThanOrEqualZero(amount, &errMsgs)
     assert.Empty(t, errMsgs, "Expected no error messages for amount greater than zero")
@@ -24,7 +26,7 @@ func TestValidateTotalIncomeGreaterThanOrEqualZero(t *testing.T) {
     assert.Equal(t, errMsgs[0], constant.MSG_BU_INVALID_TOTAL_INCOME_LESS_THAN_OR_EQUAL_ZERO, "Incorrect error message for amount equal to zero")
 
     // Test case 3: amount is less than zero
-    amount = -50.0
+    amount = -money.FromBaht(50)
     errMsgs = []string{}
     validateTotalIncomeGreaterThanOrEqualZero(amount, &errMsgs)
     assert.NotEmpty(t, errMsgs, "Expected error message for amount less than zero")
@@ -41,39 +43,72 @@ func TestValidateTaxRequest(t *testing.T) {
 		{
 			name: "ValidTaxRequest",
 			taxRequest: &TaxRequest{
-				WHT:         100.0,
-				TotalIncome: 1000.0,
+				WHT:         money.FromBaht(100),
+				TotalIncome: money.FromBaht(1000),
 			},
 			expectErr: false,
 		},
 		{
 			name: "NegativeWHT",
 			taxRequest: &TaxRequest{
-				WHT:         -100.0,
-				TotalIncome: 1000.0,
+				WHT:         -money.FromBaht(100),
+				TotalIncome: money.FromBaht(1000),
 			},
 			expectErr: true,
 		},
 		{
 			name: "WHTGreaterThanTotalIncome",
 			taxRequest: &TaxRequest{
-				WHT:         1100.0,
-				TotalIncome: 1000.0,
+				WHT:         money.FromBaht(1100),
+				TotalIncome: money.FromBaht(1000),
 			},
 			expectErr: true,
 		},
-
 		{
-			name: "InvalidAllowanceType",
+			name: "JointFiling",
+			taxRequest: &TaxRequest{
+				TotalIncome:  money.FromBaht(1000),
+				FilingStatus: constant.FILING_STATUS_JOINT,
+				Spouse:       &SpouseIncome{},
+			},
+			expectErr: false,
+		},
+		{
+			name: "InvalidFilingStatus",
+			taxRequest: &TaxRequest{
+				TotalIncome:  money.FromBaht(1000),
+				FilingStatus: "married",
+			},
+			expectErr:    true,
+			expectedMsgs: []string{constant.MSG_BU_INVALID_FILING_STATUS},
+		},
+		{
+			name: "SpouseMissing",
 			taxRequest: &TaxRequest{
-				TotalIncome: 1000.0,
-				WHT:         100.0,
-				Allowances: []Allowance{
-					{AllowanceType: "invalid", Amount: 200.0},
-				},
+				TotalIncome:  money.FromBaht(1000),
+				FilingStatus: constant.FILING_STATUS_SEPARATE,
 			},
 			expectErr:    true,
-			expectedMsgs: []string{"donation", "k-receipt"},
+			expectedMsgs: []string{constant.MSG_BU_SPOUSE_REQUIRED},
+		},
+		{
+			name: "SpouseWithSingleFiling",
+			taxRequest: &TaxRequest{
+				TotalIncome: money.FromBaht(1000),
+				Spouse:      &SpouseIncome{},
+			},
+			expectErr:    true,
+			expectedMsgs: []string{constant.MSG_BU_SPOUSE_NOT_ALLOWED},
+		},
+		{
+			name: "InvalidSpouseIncome",
+			taxRequest: &TaxRequest{
+				TotalIncome:  money.FromBaht(1000),
+				FilingStatus: constant.FILING_STATUS_JOINT,
+				Spouse:       &SpouseIncome{TotalIncome: -money.FromBaht(1), WHT: money.FromBaht(100)},
+			},
+			expectErr:    true,
+			expectedMsgs: []string{constant.MSG_BU_INVALID_SPOUSE_TOTAL_INCOME_LESS_THAN_ZERO, "spouse " + constant.MSG_BU_INVALID_WHT_GREATER_THAN_TOTALINCOME},
 		},
 	}
 
@@ -131,63 +166,136 @@ func TestValidateUploadTaxCsvRecord(t *testing.T) {
 }
 
 
-func TestValidatePersonalAllowanceMinimum(t *testing.T) {
-	t.Parallel()
+func TestValidateDeductAmount(t *testing.T) {
+	config := &repository.TaxDeductConfig{DeductId: "personal", MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(100000)}
 
 	tests := []struct {
-		name       string
-		amount     float64
-		expected   []string
+		name     string
+		amount   money.Money
+		expected error
 	}{
 		{
-			name:       "Amount less than minimum",
-			amount:     100,
-			expected:   []string{fmt.Sprintf("Personal deductibles start at %.2f baht", constant.MIN_ALLOWANCE_PERSONAL)},
+			name:     "Amount less than minimum",
+			amount:   money.FromBaht(100),
+			expected: errors.New("personal deductibles start at 10000.00 baht"),
 		},
 		{
-			name:       "Amount equal to minimum",
-			amount:     constant.MIN_ALLOWANCE_PERSONAL,
-			expected:   []string{},
+			name:     "Amount equal to minimum",
+			amount:   money.FromBaht(10000),
+			expected: nil,
 		},
 		{
-			name:       "Amount greater than minimum",
-			amount:     20000,
-			expected:    []string{},
+			name:     "Amount equal to maximum",
+			amount:   money.FromBaht(100000),
+			expected: nil,
+		},
+		{
+			name:     "Amount exceeds maximum",
+			amount:   money.FromBaht(100001),
+			expected: errors.New("Maximum personal deductibles 100000.00 baht"),
+		},
+		{
+			name:     "Amount less than zero",
+			amount:   money.FromBaht(-1),
+			expected: errors.New(constant.MSG_BU_INVALID_DEDUCT_AMOUNT_LESS_THAN_ZERO + "; personal deductibles start at 10000.00 baht"),
 		},
 	}
 
 	for _, tc := range tests {
 		tc := tc // capture range variable
 		t.Run(tc.name, func(t *testing.T) {
-			errMsgs := make([]string, 0)
-			validatePersonalAllowanceMinimum(tc.amount, &errMsgs)
-			assert.Equal(t, tc.expected, errMsgs)
+			err := ValidateDeductAmount(tc.amount, config)
+			assert.Equal(t, tc.expected, err)
 		})
 	}
 }
 
 
-func TestValidatePersonalAllowanceMaximum(t *testing.T) {
-	
+func TestValidateCreateDeductRequest(t *testing.T) {
 	tests := []struct {
-		name       string
-		amount     float64
-		expected   []string
+		name      string
+		createReq CreateDeductRequest
+		expected  error
 	}{
 		{
-			name:       "Amount exceeds maximum",
-			amount:     100001,
-			expected:   []string{fmt.Sprintf("Maximum Personal deductibles %.2f baht",  constant.MAX_ALLOWANCE_PERSONAL)},
+			name:      "Valid request",
+			createReq: CreateDeductRequest{DeductType: "life-insurance", Amount: money.FromBaht(100000), MaxAmount: money.FromBaht(100000)},
+			expected:  nil,
+		},
+		{
+			name:      "Invalid deduct type",
+			createReq: CreateDeductRequest{DeductType: "Life Insurance", Amount: money.FromBaht(100000), MaxAmount: money.FromBaht(100000)},
+			expected:  errors.New(constant.MSG_BU_INVALID_DEDUCT_TYPE),
+		},
+		{
+			name:      "Min greater than max",
+			createReq: CreateDeductRequest{DeductType: "social-security", Amount: money.FromBaht(9000), MinAmount: money.FromBaht(10000), MaxAmount: money.FromBaht(9000)},
+			expected:  errors.New(constant.MSG_BU_INVALID_DEDUCT_MIN_MAX),
+		},
+		{
+			name:      "Unknown cap rule",
+			createReq: CreateDeductRequest{DeductType: "social-security", Amount: money.FromBaht(9000), MaxAmount: money.FromBaht(9000), CapRule: "percent"},
+			expected:  errors.New(constant.MSG_BU_INVALID_DEDUCT_CAP_RULE + "fixed, max, percent-of-net"),
+		},
+		{
+			name:      "Percent of net without rate",
+			createReq: CreateDeductRequest{DeductType: "donation-sport", MaxAmount: money.FromBaht(9000), CapRule: constant.DEDUCT_CAP_RULE_PERCENT_OF_NET},
+			expected:  errors.New(constant.MSG_BU_INVALID_DEDUCT_RATE),
+		},
+		{
+			name:      "Negative multiplier",
+			createReq: CreateDeductRequest{DeductType: "donation-sport", MaxAmount: money.FromBaht(9000), CapRule: constant.DEDUCT_CAP_RULE_PERCENT_OF_NET, Rate: 0.1, Multiplier: -1},
+			expected:  errors.New(constant.MSG_BU_INVALID_DEDUCT_MULTIPLIER),
+		},
+		{
+			name:      "Percent of net",
+			createReq: CreateDeductRequest{DeductType: "donation-sport", MaxAmount: money.FromBaht(9000), CapRule: constant.DEDUCT_CAP_RULE_PERCENT_OF_NET, Rate: 0.1, Multiplier: 2},
+			expected:  nil,
+		},
+		{
+			name:      "Amount exceeds maximum",
+			createReq: CreateDeductRequest{DeductType: "social-security", Amount: money.FromBaht(10000), MaxAmount: money.FromBaht(9000)},
+			expected:  errors.New("Maximum social-security deductibles 9000.00 baht"),
 		},
-	
 	}
 
 	for _, tc := range tests {
 		tc := tc // capture range variable
 		t.Run(tc.name, func(t *testing.T) {
-			errMsgs := make([]string, 0)
-			validatePersonalAllowanceMaximum(tc.amount, &errMsgs)
-			assert.Equal(t, tc.expected, errMsgs)
+			err := ValidateCreateDeductRequest(&tc.createReq)
+			assert.Equal(t, tc.expected, err)
+		})
+	}
+}
+
+
+func TestValidateTaxFilingQuery(t *testing.T) {
+	from := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	minIncome := money.FromBaht(200000)
+	maxIncome := money.FromBaht(100000)
+
+	tests := []struct {
+		name        string
+		query       *TaxFilingQuery
+		expectedMsg string
+	}{
+		{"Empty query", &TaxFilingQuery{}, ""},
+		{"Date range reversed", &TaxFilingQuery{From: &from, To: &to}, constant.MSG_BU_INVALID_FILING_DATE_RANGE},
+		{"Income range reversed", &TaxFilingQuery{MinIncome: &minIncome, MaxIncome: &maxIncome}, constant.MSG_BU_INVALID_FILING_INCOME_RANGE},
+		{"Unknown outcome", &TaxFilingQuery{Outcome: "paid"}, "outcome must be one of"},
+		{"Limit too large", &TaxFilingQuery{Limit: constant.TAX_FILING_PAGE_SIZE_MAX + 1}, "limit must be between"},
+		{"Negative cursor", &TaxFilingQuery{Cursor: -1}, constant.MSG_BU_INVALID_FILING_CURSOR},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateTaxFilingQuery(test.query)
+			if test.expectedMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, test.expectedMsg)
 		})
 	}
-}
\ No newline at end of file
+}